@@ -62,6 +62,10 @@ func (m *ReqAddOperation) Validate() error {
 		}
 	}
 
+	// no validation rules for Service
+
+	// no validation rules for RequestId
+
 	return nil
 }
 
@@ -127,6 +131,8 @@ func (m *RspAddOperation) Validate() error {
 		return nil
 	}
 
+	// no validation rules for Id
+
 	return nil
 }
 
@@ -402,3 +408,401 @@ var _ interface {
 	Cause() error
 	ErrorName() string
 } = RspGetsPlatformValidationError{}
+
+// Validate checks the field values on ReqCheckPermission with the rules
+// defined in the proto definition for this message. If any rules are violated,
+// an error is returned.
+func (m *ReqCheckPermission) Validate() error {
+	if m == nil {
+		return nil
+	}
+
+	if utf8.RuneCountInString(m.GetUserId()) < 1 {
+		return ReqCheckPermissionValidationError{
+			field:  "UserId",
+			reason: "value length must be at least 1 runes",
+		}
+	}
+
+	if m.GetAuthObj() <= 0 {
+		return ReqCheckPermissionValidationError{
+			field:  "AuthObj",
+			reason: "value must be greater than 0",
+		}
+	}
+
+	if m.GetAuthAct() <= 0 {
+		return ReqCheckPermissionValidationError{
+			field:  "AuthAct",
+			reason: "value must be greater than 0",
+		}
+	}
+
+	// no validation rules for Department
+
+	// no validation rules for Platform
+
+	return nil
+}
+
+// ReqCheckPermissionValidationError is the validation error returned by
+// ReqCheckPermission.Validate if the designated constraints aren't met.
+type ReqCheckPermissionValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ReqCheckPermissionValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ReqCheckPermissionValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ReqCheckPermissionValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ReqCheckPermissionValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ReqCheckPermissionValidationError) ErrorName() string {
+	return "ReqCheckPermissionValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ReqCheckPermissionValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sReqCheckPermission.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ReqCheckPermissionValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ReqCheckPermissionValidationError{}
+
+// Validate checks the field values on RspCheckPermission with the rules
+// defined in the proto definition for this message. If any rules are violated,
+// an error is returned.
+func (m *RspCheckPermission) Validate() error {
+	if m == nil {
+		return nil
+	}
+
+	// no validation rules for Allowed
+
+	// no validation rules for Reason
+
+	return nil
+}
+
+// RspCheckPermissionValidationError is the validation error returned by
+// RspCheckPermission.Validate if the designated constraints aren't met.
+type RspCheckPermissionValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e RspCheckPermissionValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e RspCheckPermissionValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e RspCheckPermissionValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e RspCheckPermissionValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e RspCheckPermissionValidationError) ErrorName() string {
+	return "RspCheckPermissionValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e RspCheckPermissionValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sRspCheckPermission.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = RspCheckPermissionValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = RspCheckPermissionValidationError{}
+
+// Validate checks the field values on ReqGetEffectivePermissions with the
+// rules defined in the proto definition for this message. If any rules are
+// violated, an error is returned.
+func (m *ReqGetEffectivePermissions) Validate() error {
+	if m == nil {
+		return nil
+	}
+
+	if utf8.RuneCountInString(m.GetUserId()) < 1 {
+		return ReqGetEffectivePermissionsValidationError{
+			field:  "UserId",
+			reason: "value length must be at least 1 runes",
+		}
+	}
+
+	// no validation rules for Platform
+
+	return nil
+}
+
+// ReqGetEffectivePermissionsValidationError is the validation error returned
+// by ReqGetEffectivePermissions.Validate if the designated constraints aren't
+// met.
+type ReqGetEffectivePermissionsValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ReqGetEffectivePermissionsValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ReqGetEffectivePermissionsValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ReqGetEffectivePermissionsValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ReqGetEffectivePermissionsValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ReqGetEffectivePermissionsValidationError) ErrorName() string {
+	return "ReqGetEffectivePermissionsValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ReqGetEffectivePermissionsValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sReqGetEffectivePermissions.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ReqGetEffectivePermissionsValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ReqGetEffectivePermissionsValidationError{}
+
+// Validate checks the field values on Permission with the rules defined in the
+// proto definition for this message. If any rules are violated, an error is
+// returned.
+func (m *Permission) Validate() error {
+	if m == nil {
+		return nil
+	}
+
+	// no validation rules for AuthObj
+
+	// no validation rules for AuthActs
+
+	return nil
+}
+
+// PermissionValidationError is the validation error returned by
+// Permission.Validate if the designated constraints aren't met.
+type PermissionValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e PermissionValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e PermissionValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e PermissionValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e PermissionValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e PermissionValidationError) ErrorName() string { return "PermissionValidationError" }
+
+// Error satisfies the builtin error interface
+func (e PermissionValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sPermission.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = PermissionValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = PermissionValidationError{}
+
+// Validate checks the field values on RspGetEffectivePermissions with the
+// rules defined in the proto definition for this message. If any rules are
+// violated, an error is returned.
+func (m *RspGetEffectivePermissions) Validate() error {
+	if m == nil {
+		return nil
+	}
+
+	for idx, item := range m.GetAuths() {
+		_, _ = idx, item
+
+		if v, ok := interface{}(item).(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return RspGetEffectivePermissionsValidationError{
+					field:  fmt.Sprintf("Auths[%v]", idx),
+					reason: "embedded message failed validation",
+					cause:  err,
+				}
+			}
+		}
+
+	}
+
+	// no validation rules for DataScope
+
+	// no validation rules for Departments
+
+	// no validation rules for Roles
+
+	return nil
+}
+
+// RspGetEffectivePermissionsValidationError is the validation error returned
+// by RspGetEffectivePermissions.Validate if the designated constraints aren't
+// met.
+type RspGetEffectivePermissionsValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e RspGetEffectivePermissionsValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e RspGetEffectivePermissionsValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e RspGetEffectivePermissionsValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e RspGetEffectivePermissionsValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e RspGetEffectivePermissionsValidationError) ErrorName() string {
+	return "RspGetEffectivePermissionsValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e RspGetEffectivePermissionsValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sRspGetEffectivePermissions.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = RspGetEffectivePermissionsValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = RspGetEffectivePermissionsValidationError{}
@@ -22,6 +22,10 @@ type AccountClient interface {
 	AddOperation(ctx context.Context, in *ReqAddOperation, opts ...grpc.CallOption) (*RspAddOperation, error)
 	// 数据来源
 	GetsPlatform(ctx context.Context, in *ReqGetsPlatform, opts ...grpc.CallOption) (*RspGetsPlatform, error)
+	// 权限校验
+	CheckPermission(ctx context.Context, in *ReqCheckPermission, opts ...grpc.CallOption) (*RspCheckPermission, error)
+	// 有效权限
+	GetEffectivePermissions(ctx context.Context, in *ReqGetEffectivePermissions, opts ...grpc.CallOption) (*RspGetEffectivePermissions, error)
 }
 
 type accountClient struct {
@@ -50,6 +54,24 @@ func (c *accountClient) GetsPlatform(ctx context.Context, in *ReqGetsPlatform, o
 	return out, nil
 }
 
+func (c *accountClient) CheckPermission(ctx context.Context, in *ReqCheckPermission, opts ...grpc.CallOption) (*RspCheckPermission, error) {
+	out := new(RspCheckPermission)
+	err := c.cc.Invoke(ctx, "/account.Account/CheckPermission", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accountClient) GetEffectivePermissions(ctx context.Context, in *ReqGetEffectivePermissions, opts ...grpc.CallOption) (*RspGetEffectivePermissions, error) {
+	out := new(RspGetEffectivePermissions)
+	err := c.cc.Invoke(ctx, "/account.Account/GetEffectivePermissions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AccountServer is the server API for Account service.
 // All implementations must embed UnimplementedAccountServer
 // for forward compatibility
@@ -58,6 +80,10 @@ type AccountServer interface {
 	AddOperation(context.Context, *ReqAddOperation) (*RspAddOperation, error)
 	// 数据来源
 	GetsPlatform(context.Context, *ReqGetsPlatform) (*RspGetsPlatform, error)
+	// 权限校验
+	CheckPermission(context.Context, *ReqCheckPermission) (*RspCheckPermission, error)
+	// 有效权限
+	GetEffectivePermissions(context.Context, *ReqGetEffectivePermissions) (*RspGetEffectivePermissions, error)
 	mustEmbedUnimplementedAccountServer()
 }
 
@@ -71,6 +97,12 @@ func (UnimplementedAccountServer) AddOperation(context.Context, *ReqAddOperation
 func (UnimplementedAccountServer) GetsPlatform(context.Context, *ReqGetsPlatform) (*RspGetsPlatform, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetsPlatform not implemented")
 }
+func (UnimplementedAccountServer) CheckPermission(context.Context, *ReqCheckPermission) (*RspCheckPermission, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckPermission not implemented")
+}
+func (UnimplementedAccountServer) GetEffectivePermissions(context.Context, *ReqGetEffectivePermissions) (*RspGetEffectivePermissions, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetEffectivePermissions not implemented")
+}
 func (UnimplementedAccountServer) mustEmbedUnimplementedAccountServer() {}
 
 // UnsafeAccountServer may be embedded to opt out of forward compatibility for this service.
@@ -120,6 +152,42 @@ func _Account_GetsPlatform_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Account_CheckPermission_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReqCheckPermission)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountServer).CheckPermission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/account.Account/CheckPermission",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccountServer).CheckPermission(ctx, req.(*ReqCheckPermission))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Account_GetEffectivePermissions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReqGetEffectivePermissions)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountServer).GetEffectivePermissions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/account.Account/GetEffectivePermissions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccountServer).GetEffectivePermissions(ctx, req.(*ReqGetEffectivePermissions))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Account_ServiceDesc is the grpc.ServiceDesc for Account service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -135,6 +203,14 @@ var Account_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetsPlatform",
 			Handler:    _Account_GetsPlatform_Handler,
 		},
+		{
+			MethodName: "CheckPermission",
+			Handler:    _Account_CheckPermission_Handler,
+		},
+		{
+			MethodName: "GetEffectivePermissions",
+			Handler:    _Account_GetEffectivePermissions_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "account.proto",
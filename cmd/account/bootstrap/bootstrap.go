@@ -0,0 +1,70 @@
+package bootstrap
+
+import (
+	handler "github.com/SeeJson/account/cmd/account/handler/http"
+	radarerror "github.com/SeeJson/account/error"
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/SeeJson/account/service"
+)
+
+type Config struct {
+	SuperAdminRole string `mapstructure:"super_admin_role"` // 超级管理员角色名，拥有全部权限
+	RootDepartment string `mapstructure:"root_department"`  // 初始管理员所在的顶级部门名
+	AdminAccount   string `mapstructure:"admin_account"`    // 初始管理员账号，为空则不创建；初始密码为默认密码
+	AdminName      string `mapstructure:"admin_name"`       // 初始管理员显示名
+
+	Platforms []service.PlatformPreset `mapstructure:"platforms"` // 系统预设平台
+}
+
+var cfg Config
+
+func SetConfig(c Config) {
+	cfg = c
+}
+
+/*
+ * 初始化部署所需的数据，可重复执行
+ */
+func Run() error {
+	var cerr *radarerror.CommonError
+
+	// 权限对象、权限动作登记表
+	svcAuth := service.NewAuthService(nil)
+	cerr = svcAuth.SyncObjs(handler.AuthObjs)
+	if cerr != nil {
+		return cerr
+	}
+	cerr = svcAuth.SyncActs(handler.AuthActs)
+	if cerr != nil {
+		return cerr
+	}
+
+	// 系统预设平台
+	svcPlatform := service.NewPlatformService(nil)
+	cerr = svcPlatform.InitPresets(cfg.Platforms)
+	if cerr != nil {
+		return cerr
+	}
+
+	// 旧用户的单个角色迁移为角色列表
+	svcUser := service.NewUserService(nil)
+	cerr = svcUser.MigrateRoles()
+	if cerr != nil {
+		return cerr
+	}
+
+	// 旧角色补上数据范围
+	svcRole := service.NewRoleService(nil)
+	cerr = svcRole.MigrateDataScope(handler.AuthObjTransDepartment)
+	if cerr != nil {
+		return cerr
+	}
+
+	// 默认租户的超级管理员角色和初始管理员
+	return service.InitTenantAdmin(modelbase.TenantDefault, service.TenantAdmin{
+		SuperAdminRole: cfg.SuperAdminRole,
+		RootDepartment: cfg.RootDepartment,
+		Account:        cfg.AdminAccount,
+		Name:           cfg.AdminName,
+	}, handler.FullAuthMp())
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"strings"
 
+	"github.com/SeeJson/account/cmd/account/bootstrap"
 	handler "github.com/SeeJson/account/cmd/account/handler/http"
 	httpserver "github.com/SeeJson/account/cmd/account/server/http"
 	rpcserver "github.com/SeeJson/account/cmd/account/server/rpc"
@@ -20,15 +21,26 @@ const (
 )
 
 type Config struct {
-	LogConfig     mlog.Config        `mapstructure:"log_config"`
-	HttpConfig    httpserver.Config  `mapstructure:"http_config"`
-	RpcConfig     rpcserver.Config   `mapstructure:"rpc_config"`
-	MongoConfig   mongodao.Config    `mapstructure:"mongo_config"`
-	JwtConfig     jwt.Config         `mapstructure:"jwt_config"`
-	CaptchaConfig captcha.Config     `mapstructure:"captcha_config"`
-	UserConfig    service.UserConfig `mapstructure:"user_config"`
-	RedisConfig   redisdao.Config    `mapstructure:"redis_config"`
-	HandlerConfig handler.Config     `mapstructure:"handler_config"`
+	LogConfig           mlog.Config                 `mapstructure:"log_config"`
+	HttpConfig          httpserver.Config           `mapstructure:"http_config"`
+	RpcConfig           rpcserver.Config            `mapstructure:"rpc_config"`
+	MongoConfig         mongodao.Config             `mapstructure:"mongo_config"`
+	JwtConfig           jwt.Config                  `mapstructure:"jwt_config"`
+	CaptchaConfig       captcha.Config              `mapstructure:"captcha_config"`
+	UserConfig          service.UserConfig          `mapstructure:"user_config"`
+	SessionConfig       service.SessionConfig       `mapstructure:"session_config"`
+	DeviceConfig        service.DeviceConfig        `mapstructure:"device_config"`
+	EventConfig         service.EventConfig         `mapstructure:"event_config"`
+	BreakGlassConfig    service.BreakGlassConfig    `mapstructure:"break_glass_config"`
+	GrantConfig         service.GrantConfig         `mapstructure:"grant_config"`
+	AccessRequestConfig service.AccessRequestConfig `mapstructure:"access_request_config"`
+	ReviewConfig        service.ReviewConfig        `mapstructure:"review_config"`
+	TenantConfig        service.TenantConfig        `mapstructure:"tenant_config"`
+	AuditChainConfig    service.AuditChainConfig    `mapstructure:"audit_chain_config"`
+	ArchiveConfig       service.ArchiveConfig       `mapstructure:"archive_config"`
+	RedisConfig         redisdao.Config             `mapstructure:"redis_config"`
+	HandlerConfig       handler.Config              `mapstructure:"handler_config"`
+	BootstrapConfig     bootstrap.Config            `mapstructure:"bootstrap_config"`
 }
 
 /*
@@ -68,6 +80,17 @@ func applyConfig(cfg *Config) {
 	jwt.SetConfig(cfg.JwtConfig)
 	captcha.SetConfig(cfg.CaptchaConfig)
 	service.SetUserConfig(cfg.UserConfig)
+	service.SetSessionConfig(cfg.SessionConfig)
+	service.SetDeviceConfig(cfg.DeviceConfig)
+	service.SetEventConfig(cfg.EventConfig)
+	service.SetBreakGlassConfig(cfg.BreakGlassConfig)
+	service.SetGrantConfig(cfg.GrantConfig)
+	service.SetAccessRequestConfig(cfg.AccessRequestConfig)
+	service.SetReviewConfig(cfg.ReviewConfig)
+	service.SetTenantConfig(cfg.TenantConfig)
+	service.SetAuditChainConfig(cfg.AuditChainConfig)
+	service.SetArchiveConfig(cfg.ArchiveConfig)
 	redisdao.SetConfig(cfg.RedisConfig)
 	handler.SetConfig(cfg.HandlerConfig)
+	bootstrap.SetConfig(cfg.BootstrapConfig)
 }
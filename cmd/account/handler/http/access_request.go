@@ -0,0 +1,380 @@
+package httphandler
+
+import (
+	"net/http"
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Request: SubmitAccessRequest
+type ReqSubmitAccessRequest struct {
+	Roles         []string        `json:"roles" binding:"omitempty"`        // 申请的角色id
+	Auths         map[int64]int64 `json:"auths" binding:"omitempty"`        // 申请的权限集，必须同时给出到期时间
+	ExpireTime    int64           `json:"expire_time" binding:"omitempty"`  // 到期时间-时间戳，不传则申请的角色长期有效
+	Justification string          `json:"justification" binding:"required"` // 申请理由
+}
+
+// Response: SubmitAccessRequest
+type RspSubmitAccessRequest struct {
+	Id string `json:"id"` // 审批单id
+}
+
+// @Tags 审批
+// @Summary 提交角色或权限申请
+// @Description 审批人从申请人所在部门逐级向上查找；批准后用户需要重新登录
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqSubmitAccessRequest  true "请求参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspSubmitAccessRequest}
+// @Router /api/v3/access_request [post]
+func SubmitAccessRequest(c *gin.Context) {
+	// param
+	var req ReqSubmitAccessRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	if !IsValidAuths(req.Auths) {
+		log.Errorf("invalid auths: %v", req.Auths)
+		c.Error(&radarerror.InvalidAuths)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcAccessRequest := service.NewAccessRequestService(&me)
+
+	request := model.AccessRequest{
+		Roles:         hexIds(req.Roles),
+		Auths:         req.Auths,
+		Justification: req.Justification,
+	}
+	if req.ExpireTime > 0 {
+		request.ExpireTime = time.Unix(req.ExpireTime, 0)
+	}
+	id, cerr := svcAccessRequest.Submit(request)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspSubmitAccessRequest{
+			Id: id.Hex(),
+		}),
+	)
+}
+
+// Request: GetAccessRequestList
+type ReqGetAccessRequestList struct {
+	Page     int64   `form:"page"  binding:"required,gte=1"`                                                 // 分页数，默认1页开始
+	PageSize int64   `form:"page_size"  binding:"required,gte=0"`                                            // 每页数量，传0代表返回全部
+	Type     *string `form:"type" binding:"omitempty,oneof=mine todo"`                                       // mine)我提交的 todo)待我审批的，不传则返回与我相关的全部
+	Status   *string `form:"status" binding:"omitempty,oneof=pending approving approved rejected cancelled"` // 状态
+}
+
+// Response: GetAccessRequestList
+type RspGetAccessRequestList struct {
+	List  []RspAccessRequestData `json:"list"`
+	Total int64                  `json:"total"` // 结果集总数
+}
+
+// RspAccessRequestData
+type RspAccessRequestData struct {
+	Id            string                     `json:"id"`            // 主键
+	User          string                     `json:"user"`          // 申请人
+	UserId        string                     `json:"user_id"`       // 申请人id
+	Roles         []string                   `json:"roles"`         // 申请的角色名
+	RoleIds       []string                   `json:"role_ids"`      // 申请的角色id
+	Auths         map[int64]int64            `json:"auths"`         // 申请的权限集
+	ExpireTime    int64                      `json:"expire_time"`   // 到期时间-时间戳，0表示长期有效
+	Justification string                     `json:"justification"` // 申请理由
+	Approvers     []string                   `json:"approvers"`     // 审批人
+	Status        string                     `json:"status"`        // 状态 pending|approving|approved|rejected|cancelled
+	Steps         []RspAccessRequestStepData `json:"steps"`         // 处理记录
+	CreateTime    int64                      `json:"create_time"`   // 提交时间-时间戳
+}
+
+// RspAccessRequestStepData
+type RspAccessRequestStepData struct {
+	Action   string `json:"action"`   // 动作 submit|approve|reject|cancel
+	Operator string `json:"operator"` // 操作人
+	Comment  string `json:"comment"`  // 备注
+	Time     int64  `json:"time"`     // 操作时间-时间戳
+}
+
+// @Tags 审批
+// @Summary 审批单列表
+// @Description 只返回我提交的或由我审批的
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query ReqGetAccessRequestList true "查询参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetAccessRequestList}
+// @Router /api/v3/access_requests [get]
+func GetAccessRequestList(c *gin.Context) {
+	// param
+	req := ReqGetAccessRequestList{
+		PageSize: cfg.DefaultPageSize,
+	}
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	req.Page = req.Page - 1
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcAccessRequest := service.NewAccessRequestService(&me)
+
+	filter := service.FilterAccessRequest{
+		Status: req.Status,
+	}
+	if req.Type != nil {
+		filter.Mine = *req.Type == "mine"
+		filter.Todo = *req.Type == "todo"
+	}
+
+	requests, cerr := svcAccessRequest.Gets(req.Page, req.PageSize, filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	total, cerr := svcAccessRequest.GetCount(filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	list, cerr := accessRequestList(&me, requests)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetAccessRequestList{
+		List:  list,
+		Total: total,
+	}))
+}
+
+// @Tags 审批
+// @Summary 审批单详情
+// @Description 只有申请人和审批人可以查看
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "审批单id"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspAccessRequestData}
+// @Router /api/v3/access_request/:id [get]
+func GetAccessRequest(c *gin.Context) {
+	// param
+	id := mongodao.Hex2Id(c.Param("id"))
+	if id == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcAccessRequest := service.NewAccessRequestService(&me)
+
+	request, cerr := svcAccessRequest.GetById(id)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	list, cerr := accessRequestList(&me, []model.AccessRequest{request})
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(list[0]))
+}
+
+// Request: ProcessAccessRequest
+type ReqProcessAccessRequest struct {
+	Comment string `json:"comment" binding:"omitempty"` // 备注
+}
+
+// @Tags 审批
+// @Summary 批准申请
+// @Description 申请的角色加到用户上，带到期时间的以临时授权的方式授予
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqProcessAccessRequest  true "请求参数"
+// @Param id path string true "审批单id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/access_request/:id/approve [post]
+func ApproveAccessRequest(c *gin.Context) {
+	processAccessRequest(c, service.AccessRequestActApprove)
+}
+
+// @Tags 审批
+// @Summary 驳回申请
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqProcessAccessRequest  true "请求参数"
+// @Param id path string true "审批单id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/access_request/:id/reject [post]
+func RejectAccessRequest(c *gin.Context) {
+	processAccessRequest(c, service.AccessRequestActReject)
+}
+
+// @Tags 审批
+// @Summary 撤回申请
+// @Description 只有申请人可以撤回待审批的申请
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqProcessAccessRequest  true "请求参数"
+// @Param id path string true "审批单id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/access_request/:id/cancel [post]
+func CancelAccessRequest(c *gin.Context) {
+	processAccessRequest(c, service.AccessRequestActCancel)
+}
+
+func processAccessRequest(c *gin.Context, action string) {
+	// param
+	var req ReqProcessAccessRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	id := mongodao.Hex2Id(c.Param("id"))
+	if id == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcAccessRequest := service.NewAccessRequestService(&me)
+
+	switch action {
+	case service.AccessRequestActApprove:
+		cerr = svcAccessRequest.Approve(id, req.Comment)
+	case service.AccessRequestActReject:
+		cerr = svcAccessRequest.Reject(id, req.Comment)
+	case service.AccessRequestActCancel:
+		cerr = svcAccessRequest.Cancel(id, req.Comment)
+	}
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
+
+/*
+ * 组装审批单列表，补全用户名和角色名
+ */
+func accessRequestList(me *service.ME, requests []model.AccessRequest) ([]RspAccessRequestData, *radarerror.CommonError) {
+	var userIds, roleIds []primitive.ObjectID
+	for _, request := range requests {
+		userIds = append(userIds, request.User)
+		userIds = append(userIds, request.Approvers...)
+		for _, step := range request.Steps {
+			userIds = append(userIds, step.Operator)
+		}
+		roleIds = append(roleIds, request.Roles...)
+	}
+	svcUser := service.NewUserService(me)
+	userId2Name, cerr := svcUser.GetNameMap(userIds)
+	if cerr != nil {
+		return nil, cerr
+	}
+	svcRole := service.NewRoleService(me)
+	roleId2Name, cerr := svcRole.GetNameMap(roleIds)
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	list := make([]RspAccessRequestData, 0, len(requests))
+	for _, request := range requests {
+		data := RspAccessRequestData{
+			Id:            request.Id.Hex(),
+			User:          userId2Name[request.User],
+			UserId:        request.User.Hex(),
+			Roles:         roleNames(request.Roles, roleId2Name),
+			RoleIds:       idsHex(request.Roles),
+			Auths:         request.Auths,
+			Justification: request.Justification,
+			Approvers:     make([]string, 0, len(request.Approvers)),
+			Status:        request.Status,
+			Steps:         make([]RspAccessRequestStepData, 0, len(request.Steps)),
+			CreateTime:    request.CreateTime.Unix(),
+		}
+		if !request.ExpireTime.IsZero() {
+			data.ExpireTime = request.ExpireTime.Unix()
+		}
+		for _, approver := range request.Approvers {
+			data.Approvers = append(data.Approvers, userId2Name[approver])
+		}
+		for _, step := range request.Steps {
+			data.Steps = append(data.Steps, RspAccessRequestStepData{
+				Action:   step.Action,
+				Operator: userId2Name[step.Operator],
+				Comment:  step.Comment,
+				Time:     step.Time.Unix(),
+			})
+		}
+		list = append(list, data)
+	}
+	return list, nil
+}
@@ -0,0 +1,256 @@
+package httphandler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 审计日志的查询条件
+type ReqAuditLogFilter struct {
+	Actor     *string `form:"actor_id" binding:"omitempty"`                             // 操作人id
+	Action    *string `form:"action" binding:"omitempty"`                               // 动作，如 POST /api/v3/user、break_glass_login
+	Severity  *string `form:"severity" binding:"omitempty,oneof=info warning critical"` // 严重级别 info|warning|critical
+	Outcome   *string `form:"outcome" binding:"omitempty,oneof=success failure"`        // 结果 success|failure
+	Target    *string `form:"target" binding:"omitempty"`                               // 目标实体id
+	StartTime int64   `form:"start_time" binding:"omitempty,gte=0"`                     // 开始时间-时间戳
+	EndTime   int64   `form:"end_time" binding:"omitempty,gte=0"`                       // 结束时间-时间戳，0为不限
+}
+
+// Request: GetAuditLogList
+type ReqGetAuditLogList struct {
+	Page     int64 `form:"page"  binding:"required,gte=1"`      // 分页数，默认1页开始
+	PageSize int64 `form:"page_size"  binding:"required,gte=0"` // 每页数量，传0代表返回全部
+	ReqAuditLogFilter
+}
+
+// Response: GetAuditLogList
+type RspGetAuditLogList struct {
+	List  []RspAuditLogData `json:"list"`
+	Total int64             `json:"total"` // 结果集总数
+}
+
+// RspAuditLogData
+type RspAuditLogData struct {
+	Id           string             `json:"id"`            // 主键
+	ActorId      string             `json:"actor_id"`      // 操作人id
+	ActorAccount string             `json:"actor_account"` // 操作人账号
+	Action       string             `json:"action"`        // 动作
+	Severity     string             `json:"severity"`      // 严重级别 info|warning|critical
+	Ip           string             `json:"ip"`            // 来源ip
+	Method       string             `json:"method"`        // 请求方法
+	Path         string             `json:"path"`          // 请求路径
+	Desc         string             `json:"desc"`          // 描述
+	Target       string             `json:"target"`        // 目标实体id
+	Outcome      string             `json:"outcome"`       // 结果 success|failure
+	ErrorCode    int                `json:"error_code"`    // 失败时的错误码
+	RequestId    string             `json:"request_id"`    // 请求id
+	Changes      []modelbase.Change `json:"changes"`       // 数据变更，敏感字段已脱敏
+	ChainSeq     int64              `json:"chain_seq"`     // 链序号
+	Hash         string             `json:"hash"`          // 记录的哈希
+	Time         int64              `json:"time"`          // 记录时间-时间戳
+}
+
+// @Tags 操作记录
+// @Summary 审计日志列表
+// @Description 按记录时间倒序；数据范围不是全部的只返回本人的操作
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query ReqGetAuditLogList true "查询参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetAuditLogList}
+// @Router /api/v3/audit_logs [get]
+func GetAuditLogList(c *gin.Context) {
+	// param
+	req := ReqGetAuditLogList{
+		PageSize: cfg.DefaultPageSize,
+	}
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	req.Page = req.Page - 1
+	filter, ok := req.ReqAuditLogFilter.filter()
+	if !ok {
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcAudit := service.NewAuditService(&me)
+
+	auditLogs, cerr := svcAudit.Gets(req.Page, req.PageSize, filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	total, cerr := svcAudit.GetCount(filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetAuditLogList{
+		List:  auditLogList(auditLogs),
+		Total: total,
+	}))
+}
+
+// Request: ExportAuditLogList
+type ReqExportAuditLogList struct {
+	Format string `form:"format" binding:"required,oneof=csv jsonl"` // 导出格式 csv|jsonl
+	ReqAuditLogFilter
+}
+
+// @Tags 操作记录
+// @Summary 导出审计日志
+// @Description 导出全部查询结果，按记录时间倒序；jsonl每行一条记录，字段同审计日志列表，含数据变更；csv不含数据变更
+// @Accept application/json
+// @Produce text/csv
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query ReqExportAuditLogList true "查询参数"
+// @Success 200  {string} string "csv或jsonl文件"
+// @Router /api/v3/audit_logs/export [get]
+func ExportAuditLogList(c *gin.Context) {
+	// param
+	var req ReqExportAuditLogList
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	filter, ok := req.ReqAuditLogFilter.filter()
+	if !ok {
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcAudit := service.NewAuditService(&me)
+
+	auditLogs, cerr := svcAudit.Gets(0, 0, filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	list := auditLogList(auditLogs)
+
+	var sb strings.Builder
+	contentType := "text/csv; charset=utf-8"
+	if req.Format == ExportFormatJsonl {
+		contentType = "application/x-ndjson; charset=utf-8"
+		enc := json.NewEncoder(&sb)
+		for _, data := range list {
+			_ = enc.Encode(data)
+		}
+	} else {
+		w := csv.NewWriter(&sb)
+		_ = w.Write([]string{"记录时间", "操作人账号", "动作", "严重级别", "来源ip", "请求方法", "请求路径", "目标", "结果", "错误码", "描述", "请求id", "链序号"})
+		for _, data := range list {
+			_ = w.Write([]string{
+				formatReportTime(data.Time),
+				data.ActorAccount,
+				data.Action,
+				data.Severity,
+				data.Ip,
+				data.Method,
+				data.Path,
+				data.Target,
+				data.Outcome,
+				fmt.Sprint(data.ErrorCode),
+				data.Desc,
+				data.RequestId,
+				fmt.Sprint(data.ChainSeq),
+			})
+		}
+		w.Flush()
+	}
+
+	filename := fmt.Sprintf("audit_logs_%v.%v", time.Now().Format("20060102150405"), req.Format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%v", filename))
+	c.Data(http.StatusOK, contentType, []byte(sb.String()))
+}
+
+func (req ReqAuditLogFilter) filter() (service.FilterAuditLog, bool) {
+	filter := service.FilterAuditLog{
+		Action:   req.Action,
+		Severity: req.Severity,
+		Outcome:  req.Outcome,
+		Target:   req.Target,
+	}
+	if req.Actor != nil {
+		actorId := mongodao.Hex2Id(*req.Actor)
+		if actorId == primitive.NilObjectID {
+			log.Errorf("invalid actor_id: %v", *req.Actor)
+			return filter, false
+		}
+		filter.Actor = &actorId
+	}
+	if req.StartTime > 0 || req.EndTime > 0 {
+		if req.EndTime > 0 && req.EndTime < req.StartTime {
+			log.Errorf("invalid time range: %v - %v", req.StartTime, req.EndTime)
+			return filter, false
+		}
+		filter.Time = &service.TimeRange{Start: req.StartTime, End: req.EndTime}
+	}
+	return filter, true
+}
+
+func auditLogList(auditLogs []model.AuditLog) []RspAuditLogData {
+	list := make([]RspAuditLogData, 0, len(auditLogs))
+	for _, auditLog := range auditLogs {
+		list = append(list, RspAuditLogData{
+			Id:           auditLog.Id.Hex(),
+			ActorId:      auditLog.Actor.Hex(),
+			ActorAccount: auditLog.ActorAccount,
+			Action:       auditLog.Action,
+			Severity:     auditLog.Severity,
+			Ip:           auditLog.Ip,
+			Method:       auditLog.Method,
+			Path:         auditLog.Path,
+			Desc:         auditLog.Desc,
+			Target:       auditLog.Target,
+			Outcome:      auditLog.Outcome,
+			ErrorCode:    auditLog.ErrorCode,
+			RequestId:    auditLog.RequestId,
+			Changes:      auditLog.Changes,
+			ChainSeq:     auditLog.ChainSeq,
+			Hash:         auditLog.Hash,
+			Time:         auditLog.CreateTime.Unix(),
+		})
+	}
+	return list
+}
@@ -0,0 +1,317 @@
+package httphandler
+
+import (
+	"net/http"
+	"strings"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Response: GetAuthMatrix
+type RspGetAuthMatrix struct {
+	Modules []RspAuthModule  `json:"modules"` // 按模块分组的权限对象
+	Acts    []RspAuthActData `json:"acts"`    // 全部权限动作
+}
+
+// RspAuthModule
+type RspAuthModule struct {
+	Name string           `json:"name"` // 模块名
+	Objs []RspAuthObjData `json:"objs"` // 模块下的权限对象
+}
+
+// RspAuthObjData
+type RspAuthObjData struct {
+	BitMark int64  `json:"bit_mark"` // 权限对象的二进制掩码，即权限集的key
+	Name    string `json:"name"`     // 显示名
+}
+
+// RspAuthActData
+type RspAuthActData struct {
+	BitMark int64  `json:"bit_mark"` // 权限动作的二进制掩码，权限集的value由其取或
+	Name    string `json:"name"`     // 显示名
+}
+
+// Request: GetAuthMatrix
+type ReqGetAuthMatrix struct {
+	Platform int64 `form:"platform" binding:"omitempty,gte=0"` // 平台id，默认0即账号中心
+}
+
+// @Tags 权限
+// @Summary 权限矩阵
+// @Description 返回平台的全部权限对象（按模块分组）和权限动作，供角色编辑页渲染
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query ReqGetAuthMatrix false "查询参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetAuthMatrix}
+// @Router /api/v3/auths [get]
+func GetAuthMatrix(c *gin.Context) {
+	// param
+	var req ReqGetAuthMatrix
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcAuth := service.NewAuthService(&me)
+
+	objs, cerr := svcAuth.GetsObj(req.Platform)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	acts, cerr := svcAuth.GetsAct()
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	// 按模块分组，模块顺序取其第一个权限对象的顺序
+	modules := make([]RspAuthModule, 0)
+	module2Index := make(map[string]int)
+	for _, obj := range objs {
+		index, ok := module2Index[obj.Module]
+		if !ok {
+			index = len(modules)
+			module2Index[obj.Module] = index
+			modules = append(modules, RspAuthModule{
+				Name: obj.Module,
+				Objs: make([]RspAuthObjData, 0),
+			})
+		}
+		modules[index].Objs = append(modules[index].Objs, RspAuthObjData{
+			BitMark: obj.BitMark,
+			Name:    obj.Name,
+		})
+	}
+
+	actList := make([]RspAuthActData, 0, len(acts))
+	for _, act := range acts {
+		actList = append(actList, RspAuthActData{
+			BitMark: act.BitMark,
+			Name:    act.Name,
+		})
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetAuthMatrix{
+		Modules: modules,
+		Acts:    actList,
+	}))
+}
+
+// 公开接口的判定原因
+const explainReasonPublic = "public"
+
+// Request: ExplainPermission
+// 按路由（method+path）或权限（auth_obj+auth_act）二选一
+type ReqExplainPermission struct {
+	UserId     string  `form:"user_id" binding:"required"`        // 用户id
+	Method     *string `form:"method" binding:"omitempty"`        // 请求方法，如 PUT
+	Path       *string `form:"path" binding:"omitempty"`          // 请求路径，如 /api/v3/user/xxx 或 /api/v3/user/:id
+	AuthObj    *int64  `form:"auth_obj" binding:"omitempty,gt=0"` // 权限对象
+	AuthAct    *int64  `form:"auth_act" binding:"omitempty,gt=0"` // 权限动作，可多个动作按位或
+	Department *string `form:"department" binding:"omitempty"`    // 目标部门id，不传则不校验数据范围
+}
+
+// Response: ExplainPermission
+type RspExplainPermission struct {
+	Allowed       bool                        `json:"allowed"`         // 是否允许
+	Reason        string                      `json:"reason"`          // 判定原因：allowed/public/user_not_found/user_deleted/no_permission/need_reset_password/out_of_data_scope
+	Route         *RspExplainRoute            `json:"route,omitempty"` // 路由的权限声明，按权限查询时为空
+	UserStatus    string                      `json:"user_status"`     // 账号状态：active/deleted/not_found
+	PasswordReset bool                        `json:"password_reset"`  // 是否已重设初始密码，未重设时只能访问登录即可访问的接口
+	Roles         []RspExplainRole            `json:"roles"`           // 直接拥有及继承得到的角色
+	Requirements  []RspExplainRequirementData `json:"requirements"`    // 需要的权限及判定
+	DataScope     RspExplainScope             `json:"data_scope"`      // 数据范围判定
+}
+
+// RspExplainRoute
+type RspExplainRoute struct {
+	FullPath string `json:"full_path"` // 注册时的路径
+	Public   bool   `json:"public"`    // 公开接口，无需登录
+	AuthOnly bool   `json:"auth_only"` // 登录即可访问
+	Reauth   bool   `json:"reauth"`    // 需要近期重新验证过身份（与会话相关，此处不判定）
+}
+
+// RspExplainRole
+type RspExplainRole struct {
+	Id        string `json:"id"`        // 角色id
+	Name      string `json:"name"`      // 角色名
+	Inherited bool   `json:"inherited"` // 是否通过上级角色继承得到
+	Temporary bool   `json:"temporary"` // 是否通过临时授权得到
+}
+
+// RspExplainRequirementData
+type RspExplainRequirementData struct {
+	AuthObj     int64               `json:"auth_obj"`      // 权限对象
+	AuthObjName string              `json:"auth_obj_name"` // 权限对象显示名
+	AuthAct     int64               `json:"auth_act"`      // 权限动作
+	Granted     bool                `json:"granted"`       // 是否拥有
+	Bits        []RspExplainBitData `json:"bits"`          // 按权限动作逐位说明
+}
+
+// RspExplainBitData
+type RspExplainBitData struct {
+	AuthAct     int64    `json:"auth_act"`      // 权限动作
+	AuthActName string   `json:"auth_act_name"` // 权限动作显示名
+	Granted     bool     `json:"granted"`       // 是否拥有
+	GrantedBy   []string `json:"granted_by"`    // 授予该权限的角色名，临时授权为 grant:{id}
+	LackedBy    []string `json:"lacked_by"`     // 缺少该权限的角色名
+}
+
+// RspExplainScope
+type RspExplainScope struct {
+	DataScope   string   `json:"data_scope"`           // 数据范围
+	Departments []string `json:"departments"`          // 数据范围内的部门id，范围为all时为空
+	Department  string   `json:"department,omitempty"` // 目标部门id
+	InScope     bool     `json:"in_scope"`             // 目标部门是否在数据范围内，未传目标部门时为true
+}
+
+// @Tags 权限
+// @Summary 权限判定解释
+// @Description 给出用户访问某路由或某权限时的完整判定过程：需要的权限、各角色授予或缺少的权限位、数据范围、是否已重设密码和账号状态
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query ReqExplainPermission true "查询参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspExplainPermission}
+// @Router /api/v3/auths/explain [get]
+func ExplainPermission(c *gin.Context) {
+	var req ReqExplainPermission
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	userId := mongodao.Hex2Id(req.UserId)
+	if userId == primitive.NilObjectID {
+		log.Errorf("invalid user_id: %v", req.UserId)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	deptId := primitive.NilObjectID
+	if req.Department != nil {
+		deptId = mongodao.Hex2Id(*req.Department)
+		if deptId == primitive.NilObjectID {
+			log.Errorf("invalid department: %v", *req.Department)
+			c.Error(&radarerror.InvalidArgs)
+			return
+		}
+	}
+
+	// 需要的权限
+	var route *RspExplainRoute
+	var reqs []service.PermRequirement
+	if req.Method != nil && req.Path != nil {
+		routePerm, ok := RoutePerm{}, false
+		if routePermResolver != nil {
+			routePerm, ok = routePermResolver(strings.ToUpper(*req.Method), *req.Path)
+		}
+		if !ok {
+			log.Errorf("route not found: %v %v", *req.Method, *req.Path)
+			c.Error(&radarerror.InvalidArgs)
+			return
+		}
+		route = &RspExplainRoute{
+			FullPath: routePerm.FullPath,
+			Public:   routePerm.Public,
+			AuthOnly: routePerm.AuthOnly,
+			Reauth:   routePerm.Reauth,
+		}
+		for _, auth := range routePerm.Auths {
+			reqs = append(reqs, service.PermRequirement{Obj: auth.Obj, Act: auth.Act})
+		}
+	} else if req.AuthObj != nil && req.AuthAct != nil {
+		reqs = append(reqs, service.PermRequirement{Obj: *req.AuthObj, Act: *req.AuthAct})
+	} else {
+		log.Errorf("need route or auth")
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	explain, cerr := service.ExplainPermission(&me, userId, reqs, deptId)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	rsp := RspExplainPermission{
+		Allowed:       explain.Allowed,
+		Reason:        explain.Reason,
+		Route:         route,
+		UserStatus:    explain.UserStatus,
+		PasswordReset: explain.PasswordReset,
+		Roles:         make([]RspExplainRole, 0, len(explain.Roles)),
+		Requirements:  make([]RspExplainRequirementData, 0, len(explain.Requirements)),
+		DataScope: RspExplainScope{
+			DataScope:   explain.DataScope.DataScope,
+			Departments: idsHex(explain.DataScope.Departments),
+			InScope:     explain.DataScope.InScope,
+		},
+	}
+	// 公开接口不需要登录，与账号状态无关
+	if route != nil && route.Public {
+		rsp.Allowed = true
+		rsp.Reason = explainReasonPublic
+	}
+	if deptId != primitive.NilObjectID {
+		rsp.DataScope.Department = deptId.Hex()
+	}
+	for _, role := range explain.Roles {
+		rsp.Roles = append(rsp.Roles, RspExplainRole{
+			Id:        role.Id.Hex(),
+			Name:      role.Name,
+			Inherited: role.Inherited,
+			Temporary: role.Temporary,
+		})
+	}
+	for _, requirement := range explain.Requirements {
+		data := RspExplainRequirementData{
+			AuthObj:     requirement.Obj,
+			AuthObjName: AuthObjName(requirement.Obj),
+			AuthAct:     requirement.Act,
+			Granted:     requirement.Granted,
+			Bits:        make([]RspExplainBitData, 0, len(requirement.Bits)),
+		}
+		for _, bit := range requirement.Bits {
+			data.Bits = append(data.Bits, RspExplainBitData{
+				AuthAct:     bit.Act,
+				AuthActName: AuthActName(bit.Act),
+				Granted:     bit.Granted,
+				GrantedBy:   bit.GrantedBy,
+				LackedBy:    bit.LackedBy,
+			})
+		}
+		rsp.Requirements = append(rsp.Requirements, data)
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(rsp))
+}
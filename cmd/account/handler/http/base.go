@@ -1,9 +1,23 @@
 package httphandler
 
-import "github.com/SeeJson/account/service"
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/SeeJson/account/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
 
 type Config struct {
-	DefaultPageSize int64 `mapstructure:"default_page_size"`
+	DefaultPageSize int64    `mapstructure:"default_page_size"`
+	ReauthMaxAge    int64    `mapstructure:"reauth_max_age"`  // 重新验证身份后的有效期，单位：秒
+	TrustedProxies  []string `mapstructure:"trusted_proxies"` // 可信的反向代理ip，只有经过它们转发时才采信X-Forwarded-For
 }
 
 var cfg Config
@@ -13,19 +27,28 @@ func SetConfig(c Config) {
 }
 
 const (
-	SessME = "me"
+	SessME    = "me"
+	SessToken = "token" // 本次请求的令牌
+
+	HeaderDeviceToken = "X-Device-Token" // 设备令牌
+	CookieDeviceToken = "device_token"   // 设备令牌
+	HeaderTenant      = "X-Tenant-Id"    // 租户uid，登录时指定；登录后以令牌里的为准
 )
 
 const (
 	// 权限对象的bit-mark
-	AuthObjTransDepartment  = 1  // 跨部门
+	AuthObjTransDepartment  = 1  // 跨部门（已由角色的数据范围取代，仅用于迁移旧角色）
 	AuthObjLogoLibPublic    = 4  // 图标库（公共）
 	AuthObjFaceLibPublic    = 6  // 人脸库（公共）
-	AuthObjImageLibPublic   = 8  // 人脸库（公共）
+	AuthObjImageLibPublic   = 8  // 图片库（公共）
 	AuthObjKeywordLibPublic = 10 // 关键词库（公共）
 	AuthObjDepartment       = 17 // 部门管理
 	AuthObjRole             = 18 // 角色管理
 	AuthObjUser             = 19 // 用户管理
+	AuthObjAccessReview     = 20 // 访问审查
+	AuthObjPlatform         = 21 // 平台管理
+	AuthObjTenant           = 22 // 租户管理
+	AuthObjOperationRecord  = 23 // 操作记录
 
 	// 权限动作的bit-mark
 	AuthActGet      = 1  // 2^0
@@ -37,6 +60,77 @@ const (
 	AuthActFeedBack = 64 // 2^6 提交错误反馈
 )
 
+// 权限对象所属模块
+const (
+	AuthModuleSystem = "系统管理"
+	AuthModuleLib    = "公共资源库"
+)
+
+// 所有权限对象，启动时同步到model.auth_obj
+var AuthObjs = []model.AuthObj{
+	{BitMark: AuthObjDepartment, Name: "部门管理", Module: AuthModuleSystem, Sort: 1},
+	{BitMark: AuthObjRole, Name: "角色管理", Module: AuthModuleSystem, Sort: 2},
+	{BitMark: AuthObjUser, Name: "用户管理", Module: AuthModuleSystem, Sort: 3},
+	{BitMark: AuthObjAccessReview, Name: "访问审查", Module: AuthModuleSystem, Sort: 4},
+	{BitMark: AuthObjPlatform, Name: "平台管理", Module: AuthModuleSystem, Sort: 5},
+	{BitMark: AuthObjTenant, Name: "租户管理", Module: AuthModuleSystem, Sort: 6},
+	{BitMark: AuthObjOperationRecord, Name: "操作记录", Module: AuthModuleSystem, Sort: 7},
+	{BitMark: AuthObjLogoLibPublic, Name: "图标库（公共）", Module: AuthModuleLib, Sort: 11},
+	{BitMark: AuthObjFaceLibPublic, Name: "人脸库（公共）", Module: AuthModuleLib, Sort: 12},
+	{BitMark: AuthObjImageLibPublic, Name: "图片库（公共）", Module: AuthModuleLib, Sort: 13},
+	{BitMark: AuthObjKeywordLibPublic, Name: "关键词库（公共）", Module: AuthModuleLib, Sort: 14},
+}
+
+// 所有权限动作，启动时同步到model.auth_act
+var AuthActs = []model.AuthAct{
+	{BitMark: AuthActGet, Name: "查看"},
+	{BitMark: AuthActAdd, Name: "新增"},
+	{BitMark: AuthActUpdate, Name: "编辑"},
+	{BitMark: AuthActDelete, Name: "删除"},
+	{BitMark: AuthActDownload, Name: "下载"},
+	{BitMark: AuthActUpload, Name: "上传"},
+	{BitMark: AuthActFeedBack, Name: "错误反馈"},
+}
+
+// 内置角色模板
+type RoleTemplate struct {
+	Key       string          // 模板标识
+	Name      string          // 默认角色名
+	Auths     map[int64]int64 // 权限集
+	DataScope string          // 数据范围
+}
+
+/*
+ * 内置角色模板：只读、操作员、部门管理员、超级管理员
+ */
+func RoleTemplates() []RoleTemplate {
+	var allActs, writeActs int64
+	for _, act := range AuthActs {
+		allActs |= act.BitMark
+		if act.BitMark != AuthActDelete {
+			writeActs |= act.BitMark
+		}
+	}
+
+	viewer := make(map[int64]int64, len(AuthObjs))
+	operator := make(map[int64]int64, len(AuthObjs))
+	for _, obj := range AuthObjs {
+		viewer[obj.BitMark] = AuthActGet
+		operator[obj.BitMark] = writeActs
+	}
+
+	return []RoleTemplate{
+		{Key: "viewer", Name: "只读", Auths: viewer, DataScope: service.DataScopeDepartment},
+		{Key: "operator", Name: "操作员", Auths: operator, DataScope: service.DataScopeDepartment},
+		{Key: "department_admin", Name: "部门管理员", Auths: map[int64]int64{
+			AuthObjDepartment: AuthActGet,
+			AuthObjRole:       AuthActGet,
+			AuthObjUser:       allActs,
+		}, DataScope: service.DataScopeSubtree},
+		{Key: "super_admin", Name: "超级管理员", Auths: FullAuthMp(), DataScope: service.DataScopeAll},
+	}
+}
+
 type Auth struct {
 	Obj int64 // 权限对象的二进制掩码 model.auth_obj.bit_mark
 	Act int64 // 权限动作的二进制掩码 model.auth_act.bit_mark
@@ -46,6 +140,10 @@ type Auth struct {
  * 检查是否拥有指定的权限（可以要求同时拥有多个）
  */
 func CheckAuth(me *service.ME, auths []Auth) bool {
+	// 其他平台的令牌只携带该平台的权限，不能访问账号中心需要权限的接口
+	if me.Platform != 0 && len(auths) > 0 {
+		return false
+	}
 	for _, auth := range auths {
 		acts, ok := me.AuthMp[auth.Obj]
 		if !ok || (acts&auth.Act) == 0 {
@@ -54,3 +152,132 @@ func CheckAuth(me *service.ME, auths []Auth) bool {
 	}
 	return true
 }
+
+/*
+ * 拥有全部权限的权限集
+ */
+func FullAuthMp() map[int64]int64 {
+	var allActs int64
+	for _, act := range AuthActs {
+		allActs |= act.BitMark
+	}
+	authMp := make(map[int64]int64, len(AuthObjs))
+	for _, obj := range AuthObjs {
+		authMp[obj.BitMark] = allActs
+	}
+	return authMp
+}
+
+/*
+ * 校验权限集里的权限对象和权限动作是否都已定义
+ */
+func IsValidAuths(auths map[int64]int64) bool {
+	fullAuthMp := FullAuthMp()
+	for obj, acts := range auths {
+		allActs, ok := fullAuthMp[obj]
+		if !ok || acts == 0 || acts&^allActs != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 权限对象显示名，未定义的返回掩码本身
+func AuthObjName(obj int64) string {
+	for _, o := range AuthObjs {
+		if o.BitMark == obj {
+			return o.Name
+		}
+	}
+	return fmt.Sprint(obj)
+}
+
+// 权限动作显示名，未定义的返回掩码本身
+func AuthActName(act int64) string {
+	for _, a := range AuthActs {
+		if a.BitMark == act {
+			return a.Name
+		}
+	}
+	return fmt.Sprint(act)
+}
+
+/*
+ * 检查是否在有效期内重新验证过身份（敏感操作前需要）
+ */
+func CheckReauth(me *service.ME) bool {
+	if me.ReauthTime == 0 {
+		return false
+	}
+	return time.Now().Unix()-me.ReauthTime <= cfg.ReauthMaxAge
+}
+
+// 路由的权限声明，由server注册路由时提供
+type RoutePerm struct {
+	FullPath string // 注册时的路径，如 /api/v3/user/:id
+	Public   bool   // 公开接口，无需登录
+	AuthOnly bool   // 登录即可访问
+	Auths    []Auth // 需要同时拥有的权限
+	Reauth   bool   // 敏感操作，需要近期重新验证过身份
+}
+
+var routePermResolver func(method, uri string) (RoutePerm, bool)
+
+/*
+ * 设置按请求方法和路径查找路由权限声明的函数
+ */
+func SetRoutePermResolver(f func(method, uri string) (RoutePerm, bool)) {
+	routePermResolver = f
+}
+
+/*
+ * 获取请求头指定的租户，不传为默认租户
+ */
+func GetHeaderTenant(c *gin.Context) (tenant int64, ok bool) {
+	value := c.GetHeader(HeaderTenant)
+	if value == "" {
+		return modelbase.TenantDefault, true
+	}
+	tenant, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || tenant < 0 {
+		log.Errorf("invalid tenant header: %v", value)
+		return 0, false
+	}
+	return tenant, true
+}
+
+/*
+ * 请求方的ip，用于应急账号的ip白名单和审计
+ * 不用c.ClientIP()：它直接采信客户端可伪造的X-Forwarded-For、X-Real-IP
+ * 直连方是可信代理时，从右往左取X-Forwarded-For里第一个不可信的地址
+ */
+func RemoteIP(c *gin.Context) string {
+	ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		ip = strings.TrimSpace(c.Request.RemoteAddr)
+	}
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	hops := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrustedProxy(ip string) bool {
+	for _, proxy := range cfg.TrustedProxies {
+		if proxy == ip {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package httphandler
+
+import (
+	"net/http"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Response: GetDepartmentTree
+type RspGetDepartmentTree struct {
+	List []*RspDepartmentNode `json:"list"` // 顶级部门
+}
+
+// RspDepartmentNode
+type RspDepartmentNode struct {
+	Id             string               `json:"id"`               // 主键
+	Name           string               `json:"name"`             // 部门名
+	Parent         string               `json:"parent"`           // 上级部门id
+	Sort           int64                `json:"sort"`             // 同级排序
+	UserCount      int64                `json:"user_count"`       // 本部门用户数
+	TotalUserCount int64                `json:"total_user_count"` // 本部门及所有下级部门用户数
+	Children       []*RspDepartmentNode `json:"children"`         // 下级部门
+}
+
+func newRspDepartmentNode(node *service.DepartmentNode) *RspDepartmentNode {
+	parent := ""
+	if node.Parent != primitive.NilObjectID {
+		parent = node.Parent.Hex()
+	}
+	data := &RspDepartmentNode{
+		Id:             node.Id.Hex(),
+		Name:           node.Name,
+		Parent:         parent,
+		Sort:           node.Sort,
+		UserCount:      node.UserCount,
+		TotalUserCount: node.TotalUserCount,
+		Children:       make([]*RspDepartmentNode, 0, len(node.Children)),
+	}
+	for _, child := range node.Children {
+		data.Children = append(data.Children, newRspDepartmentNode(child))
+	}
+	return data
+}
+
+// @Tags 部门
+// @Summary 部门树
+// @Description 返回完整的部门树，附带各节点的用户数
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetDepartmentTree}
+// @Router /api/v3/departments [get]
+func GetDepartmentTree(c *gin.Context) {
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcDepartment := service.NewDepartmentService(&me)
+
+	roots, cerr := svcDepartment.GetTree()
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	list := make([]*RspDepartmentNode, 0, len(roots))
+	for _, root := range roots {
+		list = append(list, newRspDepartmentNode(root))
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetDepartmentTree{
+		List: list,
+	}))
+}
+
+// Request: AddDepartment
+type ReqAddDepartment struct {
+	Name   string `json:"name" binding:"required"`    // 部门名
+	Parent string `json:"parent" binding:"omitempty"` // 上级部门id，不传表示顶级部门
+	Sort   int64  `json:"sort" binding:"omitempty"`   // 同级排序，越小越靠前
+}
+
+// Response: AddDepartment
+type RspAddDepartment struct {
+	Id string `json:"id"` // 部门id
+}
+
+// @Tags 部门
+// @Summary 新增部门
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqAddDepartment  true "请求参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspAddDepartment}
+// @Router /api/v3/department [post]
+func AddDepartment(c *gin.Context) {
+	// param
+	var req ReqAddDepartment
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	parent := primitive.NilObjectID
+	if req.Parent != "" {
+		parent = mongodao.Hex2Id(req.Parent)
+		if parent == primitive.NilObjectID {
+			log.Errorf("invalid parent: %v", req.Parent)
+			c.Error(&radarerror.InvalidArgs)
+			return
+		}
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcDepartment := service.NewDepartmentService(&me)
+
+	id, cerr := svcDepartment.Add(model.Department{
+		Name:   req.Name,
+		Parent: parent,
+		Sort:   req.Sort,
+	})
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspAddDepartment{
+			Id: id.Hex(),
+		}),
+	)
+}
+
+// Request: UpdateDepartment
+type ReqUpdateDepartment struct {
+	Set service.SetDepartment `json:"set" binding:"required"` // 增量修改
+}
+
+// @Tags 部门
+// @Summary 编辑部门
+// @Description 重命名、移动（修改上级部门）、调整同级排序
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqUpdateDepartment true "请求参数"
+// @Param id path string true "部门id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/department/:id [put]
+func UpdateDepartment(c *gin.Context) {
+	// param
+	var req ReqUpdateDepartment
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	deptId := mongodao.Hex2Id(c.Param("id"))
+	if deptId == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcDepartment := service.NewDepartmentService(&me)
+
+	cerr = svcDepartment.Update(deptId, req.Set)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
+
+// @Tags 部门
+// @Summary 删除部门
+// @Description 部门下仍有下级部门或用户时不允许删除
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "部门id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/department/:id [delete]
+func DeleteDepartment(c *gin.Context) {
+	// param
+	deptId := mongodao.Hex2Id(c.Param("id"))
+	if deptId == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcDepartment := service.NewDepartmentService(&me)
+
+	cerr = svcDepartment.Delete(deptId)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
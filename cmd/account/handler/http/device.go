@@ -0,0 +1,109 @@
+package httphandler
+
+import (
+	"net/http"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Response: GetMyDeviceList
+type RspGetMyDeviceList struct {
+	List []RspDeviceData `json:"list"`
+}
+
+// RspDeviceData
+type RspDeviceData struct {
+	Id        string `json:"id"`         // 主键
+	UserAgent string `json:"user_agent"` // 最近一次登录的User-Agent
+	Ip        string `json:"ip"`         // 最近一次登录的ip
+	FirstSeen int64  `json:"first_seen"` // 首次登录时间-时间戳
+	LastSeen  int64  `json:"last_seen"`  // 最近登录时间-时间戳
+}
+
+// @Tags 用户
+// @Summary 我的受信任设备列表
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetMyDeviceList}
+// @Router /api/v3/user/devices [get]
+func GetMyDeviceList(c *gin.Context) {
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcDevice := service.NewDeviceService(&me)
+
+	devices, cerr := svcDevice.GetsByUser(me.Id)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	list := make([]RspDeviceData, 0, len(devices))
+	for _, device := range devices {
+		data := RspDeviceData{
+			Id:        device.Id.Hex(),
+			UserAgent: device.UserAgent,
+			Ip:        device.Ip,
+			FirstSeen: device.FirstSeen.Unix(),
+			LastSeen:  device.LastSeen.Unix(),
+		}
+		list = append(list, data)
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetMyDeviceList{
+		List: list,
+	}))
+}
+
+// @Tags 用户
+// @Summary 移除我的受信任设备
+// @Description 移除后该设备再次登录将视为新设备
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "设备id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/user/device/:id [delete]
+func DeleteMyDevice(c *gin.Context) {
+	// param
+	deviceId := mongodao.Hex2Id(c.Param("id"))
+	if deviceId == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcDevice := service.NewDeviceService(&me)
+
+	cerr = svcDevice.Delete(me.Id, deviceId)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
@@ -0,0 +1,220 @@
+package httphandler
+
+import (
+	"net/http"
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Request: AddGrant
+type ReqAddGrant struct {
+	Auths      map[int64]int64 `json:"auths" binding:"omitempty"`      // 额外的权限集 key是权限对象的二进制掩码，value是权限动作的二进制掩码取或
+	Roles      []string        `json:"roles" binding:"omitempty"`      // 额外的角色id
+	StartTime  int64           `json:"start_time" binding:"omitempty"` // 生效时间-时间戳，不传则立即生效
+	ExpireTime int64           `json:"expire_time" binding:"required"` // 到期时间-时间戳
+	Reason     string          `json:"reason" binding:"required"`      // 授权原因
+}
+
+// Response: AddGrant
+type RspAddGrant struct {
+	Id string `json:"id"` // 临时授权id
+}
+
+// @Tags 用户
+// @Summary 新增临时授权
+// @Description 给用户临时增加权限或角色，到期后自动撤销；生效和到期时用户需要重新登录。不能给自己授权，直接授予的权限不能超出自己拥有的
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqAddGrant  true "请求参数"
+// @Param id path string true "用户id"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspAddGrant}
+// @Router /api/v3/user/:id/grant [post]
+func AddGrant(c *gin.Context) {
+	// param
+	var req ReqAddGrant
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	userId := mongodao.Hex2Id(c.Param("id"))
+	if userId == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	if !IsValidAuths(req.Auths) {
+		log.Errorf("invalid auths: %v", req.Auths)
+		c.Error(&radarerror.InvalidAuths)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcGrant := service.NewGrantService(&me)
+
+	grant := model.Grant{
+		User:       userId,
+		Auths:      req.Auths,
+		Roles:      hexIds(req.Roles),
+		ExpireTime: time.Unix(req.ExpireTime, 0),
+		Reason:     req.Reason,
+	}
+	if req.StartTime > 0 {
+		grant.StartTime = time.Unix(req.StartTime, 0)
+	}
+	id, cerr := svcGrant.Add(grant)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspAddGrant{
+			Id: id.Hex(),
+		}),
+	)
+}
+
+// Response: GetGrantList
+type RspGetGrantList struct {
+	List []RspGrantData `json:"list"`
+}
+
+// RspGrantData
+type RspGrantData struct {
+	Id         string          `json:"id"`          // 主键
+	Auths      map[int64]int64 `json:"auths"`       // 额外的权限集
+	Roles      []string        `json:"roles"`       // 额外的角色名
+	RoleIds    []string        `json:"role_ids"`    // 额外的角色id
+	StartTime  int64           `json:"start_time"`  // 生效时间-时间戳
+	ExpireTime int64           `json:"expire_time"` // 到期时间-时间戳
+	Reason     string          `json:"reason"`      // 授权原因
+	Active     bool            `json:"active"`      // 当前是否有效
+	Creator    string          `json:"creator"`     // 授权人id
+	CreateTime int64           `json:"create_time"` // 授权时间-时间戳
+}
+
+// @Tags 用户
+// @Summary 用户的临时授权列表
+// @Description 包括尚未生效的，已撤销或已到期的不返回
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "用户id"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetGrantList}
+// @Router /api/v3/user/:id/grants [get]
+func GetGrantList(c *gin.Context) {
+	// param
+	userId := mongodao.Hex2Id(c.Param("id"))
+	if userId == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcGrant := service.NewGrantService(&me)
+	svcRole := service.NewRoleService(&me)
+
+	grants, cerr := svcGrant.GetsByUser(userId)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	var roleIds []primitive.ObjectID
+	for _, grant := range grants {
+		roleIds = append(roleIds, grant.Roles...)
+	}
+	roleId2Name, cerr := svcRole.GetNameMap(roleIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	now := time.Now()
+	list := make([]RspGrantData, 0, len(grants))
+	for _, grant := range grants {
+		list = append(list, RspGrantData{
+			Id:         grant.Id.Hex(),
+			Auths:      grant.Auths,
+			Roles:      roleNames(grant.Roles, roleId2Name),
+			RoleIds:    idsHex(grant.Roles),
+			StartTime:  grant.StartTime.Unix(),
+			ExpireTime: grant.ExpireTime.Unix(),
+			Reason:     grant.Reason,
+			Active:     !grant.StartTime.After(now) && grant.ExpireTime.After(now),
+			Creator:    grant.Creator.Hex(),
+			CreateTime: grant.CreateTime.Unix(),
+		})
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetGrantList{
+		List: list,
+	}))
+}
+
+// @Tags 用户
+// @Summary 撤销临时授权
+// @Description 撤销已生效的授权后用户需要重新登录
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "临时授权id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/grant/:id [delete]
+func RevokeGrant(c *gin.Context) {
+	// param
+	grantId := mongodao.Hex2Id(c.Param("id"))
+	if grantId == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcGrant := service.NewGrantService(&me)
+
+	cerr = svcGrant.Revoke(grantId)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
@@ -0,0 +1,340 @@
+package httphandler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// 导出格式
+	ExportFormatCsv   = "csv"
+	ExportFormatJsonl = "jsonl" // 每行一条json记录
+)
+
+// 操作记录的查询条件
+type ReqOperationRecordFilter struct {
+	User       *string `form:"user_id" binding:"omitempty"`          // 操作人id
+	Department *string `form:"department" binding:"omitempty"`       // 操作时所在的部门id
+	Module     *int64  `form:"module" binding:"omitempty,gt=0"`      // 模块id
+	Service    *string `form:"service" binding:"omitempty"`          // 来源服务名
+	StartTime  int64   `form:"start_time" binding:"omitempty,gte=0"` // 开始时间-时间戳
+	EndTime    int64   `form:"end_time" binding:"omitempty,gte=0"`   // 结束时间-时间戳，0为不限
+}
+
+// Request: GetOperationRecordList
+type ReqGetOperationRecordList struct {
+	Page     int64 `form:"page"  binding:"required,gte=1"`      // 分页数，默认1页开始
+	PageSize int64 `form:"page_size"  binding:"required,gte=0"` // 每页数量，传0代表返回全部
+	ReqOperationRecordFilter
+}
+
+// Response: GetOperationRecordList
+type RspGetOperationRecordList struct {
+	List  []RspOperationRecordData `json:"list"`
+	Total int64                    `json:"total"` // 结果集总数
+}
+
+// RspOperationRecordData
+type RspOperationRecordData struct {
+	Id           string `json:"id"`            // 主键
+	UserId       string `json:"user_id"`       // 操作人id
+	UserAccount  string `json:"user_account"`  // 操作人账号
+	UserName     string `json:"user_name"`     // 操作人姓名
+	DepartmentId string `json:"department_id"` // 操作时所在的部门id
+	Department   string `json:"department"`    // 部门名
+	Module       int64  `json:"module"`        // 模块id
+	Desc         string `json:"desc"`          // 操作描述
+	Service      string `json:"service"`       // 来源服务名
+	RequestId    string `json:"request_id"`    // 请求id
+	Time         int64  `json:"time"`          // 操作时间-时间戳
+}
+
+// @Tags 操作记录
+// @Summary 操作记录列表
+// @Description 按操作时间倒序；只返回本人及数据范围内部门的记录
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query ReqGetOperationRecordList true "查询参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetOperationRecordList}
+// @Router /api/v3/operation_records [get]
+func GetOperationRecordList(c *gin.Context) {
+	// param
+	req := ReqGetOperationRecordList{
+		PageSize: cfg.DefaultPageSize,
+	}
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	req.Page = req.Page - 1
+	filter, ok := req.ReqOperationRecordFilter.filter()
+	if !ok {
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcOperation := service.NewOperationRecordService(&me)
+
+	records, cerr := svcOperation.Gets(req.Page, req.PageSize, filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	total, cerr := svcOperation.GetCount(filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	list, cerr := operationRecordList(&me, records)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetOperationRecordList{
+		List:  list,
+		Total: total,
+	}))
+}
+
+// Request: ExportOperationRecordList
+type ReqExportOperationRecordList struct {
+	Format string `form:"format" binding:"required,oneof=csv jsonl"` // 导出格式 csv|jsonl
+	ReqOperationRecordFilter
+}
+
+// @Tags 操作记录
+// @Summary 导出操作记录
+// @Description 导出全部查询结果，按操作时间倒序；jsonl每行一条记录，字段同操作记录列表
+// @Accept application/json
+// @Produce text/csv
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query ReqExportOperationRecordList true "查询参数"
+// @Success 200  {string} string "csv或jsonl文件"
+// @Router /api/v3/operation_records/export [get]
+func ExportOperationRecordList(c *gin.Context) {
+	// param
+	var req ReqExportOperationRecordList
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	filter, ok := req.ReqOperationRecordFilter.filter()
+	if !ok {
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcOperation := service.NewOperationRecordService(&me)
+
+	records, cerr := svcOperation.Gets(0, 0, filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	list, cerr := operationRecordList(&me, records)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	var sb strings.Builder
+	contentType := "text/csv; charset=utf-8"
+	if req.Format == ExportFormatJsonl {
+		contentType = "application/x-ndjson; charset=utf-8"
+		enc := json.NewEncoder(&sb)
+		for _, data := range list {
+			_ = enc.Encode(data)
+		}
+	} else {
+		w := csv.NewWriter(&sb)
+		_ = w.Write([]string{"操作时间", "操作人账号", "操作人", "部门", "模块", "操作描述", "来源服务", "请求id"})
+		for _, data := range list {
+			_ = w.Write([]string{
+				formatReportTime(data.Time),
+				data.UserAccount,
+				data.UserName,
+				data.Department,
+				fmt.Sprint(data.Module),
+				data.Desc,
+				data.Service,
+				data.RequestId,
+			})
+		}
+		w.Flush()
+	}
+
+	filename := fmt.Sprintf("operation_records_%v.%v", time.Now().Format("20060102150405"), req.Format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%v", filename))
+	c.Data(http.StatusOK, contentType, []byte(sb.String()))
+}
+
+func (req ReqOperationRecordFilter) filter() (service.FilterOperationRecord, bool) {
+	filter := service.FilterOperationRecord{
+		Module:  req.Module,
+		Service: req.Service,
+	}
+	if req.User != nil {
+		userId := mongodao.Hex2Id(*req.User)
+		if userId == primitive.NilObjectID {
+			log.Errorf("invalid user_id: %v", *req.User)
+			return filter, false
+		}
+		filter.User = &userId
+	}
+	if req.Department != nil {
+		deptId := mongodao.Hex2Id(*req.Department)
+		if deptId == primitive.NilObjectID {
+			log.Errorf("invalid department: %v", *req.Department)
+			return filter, false
+		}
+		filter.Department = &deptId
+	}
+	if req.StartTime > 0 || req.EndTime > 0 {
+		if req.EndTime > 0 && req.EndTime < req.StartTime {
+			log.Errorf("invalid time range: %v - %v", req.StartTime, req.EndTime)
+			return filter, false
+		}
+		filter.Time = &service.TimeRange{Start: req.StartTime, End: req.EndTime}
+	}
+	return filter, true
+}
+
+func operationRecordList(me *service.ME, records []model.OperationRecord) ([]RspOperationRecordData, *radarerror.CommonError) {
+	var deptIds []primitive.ObjectID
+	for _, record := range records {
+		deptIds = append(deptIds, record.Department)
+	}
+	svcDepartment := service.NewDepartmentService(me)
+	deptId2Name, cerr := svcDepartment.GetNameMap(deptIds)
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	list := make([]RspOperationRecordData, 0, len(records))
+	for _, record := range records {
+		list = append(list, RspOperationRecordData{
+			Id:           record.Id.Hex(),
+			UserId:       record.User.Hex(),
+			UserAccount:  record.UserAccount,
+			UserName:     record.UserName,
+			DepartmentId: record.Department.Hex(),
+			Department:   deptId2Name[record.Department],
+			Module:       record.Module,
+			Desc:         record.Desc,
+			Service:      record.Service,
+			RequestId:    record.RequestId,
+			Time:         record.CreateTime.Unix(),
+		})
+	}
+	return list, nil
+}
+
+// Response: VerifyAuditChain
+type RspVerifyAuditChain struct {
+	Intact bool                `json:"intact"` // 是否全部完整
+	List   []RspAuditChainData `json:"list"`
+}
+
+// RspAuditChainData
+type RspAuditChainData struct {
+	Collection   string `json:"collection"`    // 哈希链所在的表 audit_log)审计日志 operation_record)操作记录
+	Count        int64  `json:"count"`         // 校验通过的记录数
+	LastSeq      int64  `json:"last_seq"`      // 最后一条记录的链序号
+	Checkpoints  int    `json:"checkpoints"`   // 签名有效的检查点数
+	Intact       bool   `json:"intact"`        // 是否完整
+	BrokenSeq    int64  `json:"broken_seq"`    // 第一处断开的链序号
+	BrokenId     string `json:"broken_id"`     // 第一处断开的记录id，记录已删除时为空
+	BrokenReason string `json:"broken_reason"` // 断开原因 seq_gap|prev_hash|hash|truncated|checkpoint|sign
+}
+
+// @Tags 操作记录
+// @Summary 校验审计哈希链
+// @Description 逐条校验本租户审计日志、操作记录的哈希链及签名检查点，报告各自的第一处断开
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspVerifyAuditChain}
+// @Router /api/v3/audit_chains/verify [get]
+func VerifyAuditChain(c *gin.Context) {
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcAuditChain := service.NewAuditChainService(&me)
+
+	reports, cerr := svcAuditChain.Verify()
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	rsp := RspVerifyAuditChain{
+		Intact: true,
+		List:   make([]RspAuditChainData, 0, len(reports)),
+	}
+	for _, report := range reports {
+		data := RspAuditChainData{
+			Collection:  report.Collection,
+			Count:       report.Count,
+			LastSeq:     report.LastSeq,
+			Checkpoints: report.Checkpoints,
+			Intact:      report.Broken == nil,
+		}
+		if report.Broken != nil {
+			rsp.Intact = false
+			data.BrokenSeq = report.Broken.Seq
+			data.BrokenReason = report.Broken.Reason
+			if report.Broken.Id != primitive.NilObjectID {
+				data.BrokenId = report.Broken.Id.Hex()
+			}
+		}
+		rsp.List = append(rsp.List, data)
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(rsp))
+}
@@ -0,0 +1,325 @@
+package httphandler
+
+import (
+	"net/http"
+	"strconv"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Response: GetPlatformList
+type RspGetPlatformList struct {
+	List []RspPlatformData `json:"list"`
+}
+
+// RspPlatformData
+type RspPlatformData struct {
+	Id         int64  `json:"id"`          // 唯一标识
+	Name       string `json:"name"`        // 显示名
+	Priority   int32  `json:"priority"`    // 优先级权重(1-100)，越高越优先
+	SysPreset  bool   `json:"sys_preset"`  // 是否系统预设
+	CreateTime int64  `json:"create_time"` // 创建时间-时间戳
+}
+
+// @Tags 平台
+// @Summary 平台列表
+// @Description 按优先级从高到低
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetPlatformList}
+// @Router /api/v3/platforms [get]
+func GetPlatformList(c *gin.Context) {
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcPlatform := service.NewPlatformService(&me)
+
+	platforms, cerr := svcPlatform.Gets()
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	list := make([]RspPlatformData, 0, len(platforms))
+	for _, platform := range platforms {
+		list = append(list, RspPlatformData{
+			Id:         platform.Uid,
+			Name:       platform.Name,
+			Priority:   platform.Priority,
+			SysPreset:  platform.SysPreset,
+			CreateTime: platform.CreateTime.Unix(),
+		})
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetPlatformList{
+		List: list,
+	}))
+}
+
+// Request: AddPlatform
+type ReqAddPlatform struct {
+	Name     string `json:"name" binding:"required"`                   // 显示名
+	Priority int32  `json:"priority" binding:"required,gte=1,lte=100"` // 优先级权重(1-100)，越高越优先
+}
+
+// Response: AddPlatform
+type RspAddPlatform struct {
+	Id int64 `json:"id"` // 唯一标识
+}
+
+// @Tags 平台
+// @Summary 新增平台
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqAddPlatform  true "请求参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspAddPlatform}
+// @Router /api/v3/platform [post]
+func AddPlatform(c *gin.Context) {
+	// param
+	var req ReqAddPlatform
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcPlatform := service.NewPlatformService(&me)
+
+	uid, cerr := svcPlatform.Add(model.Platform{
+		Name:     req.Name,
+		Priority: req.Priority,
+	})
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspAddPlatform{
+			Id: uid,
+		}),
+	)
+}
+
+// Request: UpdatePlatform
+type ReqUpdatePlatform struct {
+	Set service.SetPlatform `json:"set" binding:"required"` // 增量修改
+}
+
+// @Tags 平台
+// @Summary 编辑平台
+// @Description 系统预设平台也可以改名和调整优先级
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqUpdatePlatform true "请求参数"
+// @Param id path int true "平台id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/platform/:id [put]
+func UpdatePlatform(c *gin.Context) {
+	// param
+	var req ReqUpdatePlatform
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	uid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || uid <= 0 {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcPlatform := service.NewPlatformService(&me)
+
+	cerr = svcPlatform.Update(uid, req.Set)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
+
+// @Tags 平台
+// @Summary 删除平台
+// @Description 系统预设平台不能删除
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path int true "平台id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/platform/:id [delete]
+func DeletePlatform(c *gin.Context) {
+	// param
+	uid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || uid <= 0 {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcPlatform := service.NewPlatformService(&me)
+
+	cerr = svcPlatform.Delete(uid)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
+
+// Request: AddPlatformAuthObj
+type ReqAddPlatformAuthObj struct {
+	BitMark int64  `json:"bit_mark" binding:"required,gt=0"` // 权限对象的二进制掩码，平台内唯一
+	Name    string `json:"name" binding:"required"`          // 显示名
+	Module  string `json:"module" binding:"omitempty"`       // 所属模块，用于分组展示
+	Sort    int64  `json:"sort" binding:"omitempty"`         // 展示顺序，越小越靠前
+}
+
+// @Tags 平台
+// @Summary 登记平台的权限对象
+// @Description 该平台的角色只能授予已登记的权限对象；平台的权限对象可通过权限矩阵按平台查询
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqAddPlatformAuthObj true "请求参数"
+// @Param id path int true "平台id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/platform/:id/auth_obj [post]
+func AddPlatformAuthObj(c *gin.Context) {
+	// param
+	var req ReqAddPlatformAuthObj
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	uid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || uid <= 0 {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcAuth := service.NewAuthService(&me)
+
+	cerr = svcAuth.AddPlatformObj(model.AuthObj{
+		BitMark:  req.BitMark,
+		Name:     req.Name,
+		Module:   req.Module,
+		Sort:     req.Sort,
+		Platform: uid,
+	})
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
+
+// @Tags 平台
+// @Summary 删除平台的权限对象
+// @Description 已授予的权限集不变，但不能再授予
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path int true "平台id"
+// @Param bit_mark path int true "权限对象的二进制掩码"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/platform/:id/auth_obj/:bit_mark [delete]
+func DeletePlatformAuthObj(c *gin.Context) {
+	// param
+	uid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || uid <= 0 {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	bitMark, err := strconv.ParseInt(c.Param("bit_mark"), 10, 64)
+	if err != nil || bitMark <= 0 {
+		log.Errorf("invalid bit_mark: %v", c.Param("bit_mark"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcAuth := service.NewAuthService(&me)
+
+	cerr = svcAuth.DeletePlatformObj(uid, bitMark)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
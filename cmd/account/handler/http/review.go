@@ -0,0 +1,545 @@
+package httphandler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Request: AddReviewCampaign
+type ReqAddReviewCampaign struct {
+	Name        string   `json:"name" binding:"required"`                            // 活动名
+	Departments []string `json:"departments" binding:"omitempty"`                    // 审查的部门id（含下级部门），不传则为数据范围内的全部用户
+	Roles       []string `json:"roles" binding:"omitempty"`                          // 审查的角色id，不传则为全部角色
+	Deadline    int64    `json:"deadline" binding:"required"`                        // 截止时间-时间戳
+	OnExpire    string   `json:"on_expire" binding:"required,oneof=revoke escalate"` // 到期未审查的处理 revoke)自动撤销 escalate)上报
+}
+
+// Response: AddReviewCampaign
+type RspAddReviewCampaign struct {
+	Id        string `json:"id"`         // 活动id
+	ItemCount int    `json:"item_count"` // 生成的审查项数量
+}
+
+// @Tags 访问审查
+// @Summary 新增访问审查活动
+// @Description 为范围内每个用户的每个角色生成一条审查项，由用户所在部门的审查人审查
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqAddReviewCampaign  true "请求参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspAddReviewCampaign}
+// @Router /api/v3/review_campaign [post]
+func AddReviewCampaign(c *gin.Context) {
+	// param
+	var req ReqAddReviewCampaign
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcReview := service.NewReviewService(&me)
+
+	campaign := model.ReviewCampaign{
+		Name:        req.Name,
+		Departments: hexIds(req.Departments),
+		Roles:       hexIds(req.Roles),
+		Deadline:    time.Unix(req.Deadline, 0),
+		OnExpire:    req.OnExpire,
+	}
+	id, count, cerr := svcReview.AddCampaign(campaign)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspAddReviewCampaign{
+			Id:        id.Hex(),
+			ItemCount: count,
+		}),
+	)
+}
+
+// Request: GetReviewCampaignList
+type ReqGetReviewCampaignList struct {
+	Page     int64 `form:"page"  binding:"required,gte=1"`      // 分页数，默认1页开始
+	PageSize int64 `form:"page_size"  binding:"required,gte=0"` // 每页数量，传0代表返回全部
+}
+
+// Response: GetReviewCampaignList
+type RspGetReviewCampaignList struct {
+	List  []RspReviewCampaignData `json:"list"`
+	Total int64                   `json:"total"` // 结果集总数
+}
+
+// RspReviewCampaignData
+type RspReviewCampaignData struct {
+	Id          string   `json:"id"`          // 主键
+	Name        string   `json:"name"`        // 活动名
+	Departments []string `json:"departments"` // 审查的部门id
+	Roles       []string `json:"roles"`       // 审查的角色id
+	Deadline    int64    `json:"deadline"`    // 截止时间-时间戳
+	OnExpire    string   `json:"on_expire"`   // 到期未审查的处理 revoke|escalate
+	Status      string   `json:"status"`      // 状态 active|closed
+	CloseTime   int64    `json:"close_time"`  // 关闭时间-时间戳，未关闭为0
+	Creator     string   `json:"creator"`     // 创建人
+	CreateTime  int64    `json:"create_time"` // 创建时间-时间戳
+}
+
+// @Tags 访问审查
+// @Summary 访问审查活动列表
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query ReqGetReviewCampaignList true "查询参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetReviewCampaignList}
+// @Router /api/v3/review_campaigns [get]
+func GetReviewCampaignList(c *gin.Context) {
+	// param
+	req := ReqGetReviewCampaignList{
+		PageSize: cfg.DefaultPageSize,
+	}
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	req.Page = req.Page - 1
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcReview := service.NewReviewService(&me)
+
+	campaigns, cerr := svcReview.GetsCampaign(req.Page, req.PageSize)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	total, cerr := svcReview.GetCampaignCount()
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	var userIds []primitive.ObjectID
+	for _, campaign := range campaigns {
+		userIds = append(userIds, campaign.Creator)
+	}
+	svcUser := service.NewUserService(&me)
+	userId2Name, cerr := svcUser.GetNameMap(userIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	list := make([]RspReviewCampaignData, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		data := RspReviewCampaignData{
+			Id:          campaign.Id.Hex(),
+			Name:        campaign.Name,
+			Departments: idsHex(campaign.Departments),
+			Roles:       idsHex(campaign.Roles),
+			Deadline:    campaign.Deadline.Unix(),
+			OnExpire:    campaign.OnExpire,
+			Status:      campaign.Status,
+			Creator:     userId2Name[campaign.Creator],
+			CreateTime:  campaign.CreateTime.Unix(),
+		}
+		if !campaign.CloseTime.IsZero() {
+			data.CloseTime = campaign.CloseTime.Unix()
+		}
+		list = append(list, data)
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetReviewCampaignList{
+		List:  list,
+		Total: total,
+	}))
+}
+
+// Request: GetReviewItemList
+type ReqGetReviewItemList struct {
+	Page     int64   `form:"page"  binding:"required,gte=1"`                                     // 分页数，默认1页开始
+	PageSize int64   `form:"page_size"  binding:"required,gte=0"`                                // 每页数量，传0代表返回全部
+	Decision *string `form:"decision" binding:"omitempty,oneof=pending keep revoke auto_revoke"` // 审查结论，pending为待审查
+}
+
+// Response: GetReviewItemList
+type RspGetReviewItemList struct {
+	List  []RspReviewItemData `json:"list"`
+	Total int64               `json:"total"` // 结果集总数
+}
+
+// RspReviewItemData
+type RspReviewItemData struct {
+	Id         string   `json:"id"`          // 主键
+	CampaignId string   `json:"campaign_id"` // 活动id
+	User       string   `json:"user"`        // 被审查的用户
+	UserId     string   `json:"user_id"`     // 被审查的用户id
+	Role       string   `json:"role"`        // 被审查的角色名
+	RoleId     string   `json:"role_id"`     // 被审查的角色id
+	Department string   `json:"department"`  // 用户所在部门名
+	Reviewers  []string `json:"reviewers"`   // 审查人
+	Deadline   int64    `json:"deadline"`    // 截止时间-时间戳
+	Escalated  bool     `json:"escalated"`   // 是否已上报
+	Decision   string   `json:"decision"`    // 审查结论 pending|keep|revoke|auto_revoke
+	Reviewer   string   `json:"reviewer"`    // 实际审查人，自动撤销为空
+	Comment    string   `json:"comment"`     // 备注
+	ReviewTime int64    `json:"review_time"` // 审查时间-时间戳，未审查为0
+}
+
+// @Tags 访问审查
+// @Summary 访问审查活动的审查项列表
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "活动id"
+// @Param object query ReqGetReviewItemList true "查询参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetReviewItemList}
+// @Router /api/v3/review_campaign/:id/items [get]
+func GetReviewItemList(c *gin.Context) {
+	// param
+	req := ReqGetReviewItemList{
+		PageSize: cfg.DefaultPageSize,
+	}
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	req.Page = req.Page - 1
+	id := mongodao.Hex2Id(c.Param("id"))
+	if id == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcReview := service.NewReviewService(&me)
+
+	_, cerr = svcReview.GetCampaignById(id)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	filter := service.FilterReviewItem{
+		Campaign: &id,
+		Decision: reviewDecision(req.Decision),
+	}
+	reviewItemListResponse(c, &me, req.Page, req.PageSize, filter)
+}
+
+// Request: GetMyReviewItemList
+type ReqGetMyReviewItemList struct {
+	Page     int64 `form:"page"  binding:"required,gte=1"`      // 分页数，默认1页开始
+	PageSize int64 `form:"page_size"  binding:"required,gte=0"` // 每页数量，传0代表返回全部
+}
+
+// @Tags 访问审查
+// @Summary 待我审查的审查项
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query ReqGetMyReviewItemList true "查询参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetReviewItemList}
+// @Router /api/v3/review_items/todo [get]
+func GetMyReviewItemList(c *gin.Context) {
+	// param
+	req := ReqGetMyReviewItemList{
+		PageSize: cfg.DefaultPageSize,
+	}
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	req.Page = req.Page - 1
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	reviewItemListResponse(c, &me, req.Page, req.PageSize, service.FilterReviewItem{Todo: true})
+}
+
+// Request: ReviewItem
+type ReqReviewItem struct {
+	Decision string `json:"decision" binding:"required,oneof=keep revoke"` // 审查结论 keep)保留 revoke)撤销
+	Comment  string `json:"comment" binding:"omitempty"`                   // 备注
+}
+
+// @Tags 访问审查
+// @Summary 审查
+// @Description 只有被分配的审查人可以审查；撤销后用户需要重新登录
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqReviewItem  true "请求参数"
+// @Param id path string true "审查项id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/review_item/:id [put]
+func ReviewItem(c *gin.Context) {
+	// param
+	var req ReqReviewItem
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	id := mongodao.Hex2Id(c.Param("id"))
+	if id == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcReview := service.NewReviewService(&me)
+
+	cerr = svcReview.ReviewItem(id, req.Decision, req.Comment)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
+
+// @Tags 访问审查
+// @Summary 导出访问审查报告
+// @Description csv格式：首部为完成情况统计，其后为每条审查项的结论
+// @Accept application/json
+// @Produce text/csv
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "活动id"
+// @Success 200  {string} string "csv文件"
+// @Router /api/v3/review_campaign/:id/report [get]
+func ExportReviewReport(c *gin.Context) {
+	// param
+	id := mongodao.Hex2Id(c.Param("id"))
+	if id == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcReview := service.NewReviewService(&me)
+
+	report, cerr := svcReview.Report(id)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	list, cerr := reviewItemList(&me, report.Items)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	_ = w.WriteAll([][]string{
+		{"活动", report.Campaign.Name},
+		{"状态", report.Campaign.Status},
+		{"截止时间", formatReportTime(report.Campaign.Deadline.Unix())},
+		{"审查项", fmt.Sprint(report.Total)},
+		{"保留", fmt.Sprint(report.Kept)},
+		{"撤销", fmt.Sprint(report.Revoked)},
+		{"自动撤销", fmt.Sprint(report.AutoRevoked)},
+		{"待审查", fmt.Sprint(report.Pending)},
+		{"已上报", fmt.Sprint(report.Escalated)},
+		{},
+		{"用户", "部门", "角色", "结论", "审查人", "备注", "审查时间", "已上报"},
+	})
+	for _, item := range list {
+		_ = w.Write([]string{
+			item.User,
+			item.Department,
+			item.Role,
+			item.Decision,
+			item.Reviewer,
+			item.Comment,
+			formatReportTime(item.ReviewTime),
+			fmt.Sprint(item.Escalated),
+		})
+	}
+	w.Flush()
+
+	filename := fmt.Sprintf("review_report_%v.csv", id.Hex())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%v", filename))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", []byte(sb.String()))
+}
+
+func reviewItemListResponse(c *gin.Context, me *service.ME, page, pageSize int64, filter service.FilterReviewItem) {
+	var cerr *radarerror.CommonError
+	svcReview := service.NewReviewService(me)
+
+	items, cerr := svcReview.GetsItem(page, pageSize, filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	total, cerr := svcReview.GetItemCount(filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	list, cerr := reviewItemList(me, items)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetReviewItemList{
+		List:  list,
+		Total: total,
+	}))
+}
+
+/*
+ * 组装审查项列表，补全用户名、角色名和部门名
+ */
+func reviewItemList(me *service.ME, items []model.ReviewItem) ([]RspReviewItemData, *radarerror.CommonError) {
+	var userIds, roleIds, deptIds []primitive.ObjectID
+	for _, item := range items {
+		userIds = append(userIds, item.User, item.Reviewer)
+		userIds = append(userIds, item.Reviewers...)
+		roleIds = append(roleIds, item.Role)
+		deptIds = append(deptIds, item.Department)
+	}
+	svcUser := service.NewUserService(me)
+	userId2Name, cerr := svcUser.GetNameMap(userIds)
+	if cerr != nil {
+		return nil, cerr
+	}
+	svcRole := service.NewRoleService(me)
+	roleId2Name, cerr := svcRole.GetNameMap(roleIds)
+	if cerr != nil {
+		return nil, cerr
+	}
+	svcDepartment := service.NewDepartmentService(me)
+	deptId2Name, cerr := svcDepartment.GetNameMap(deptIds)
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	list := make([]RspReviewItemData, 0, len(items))
+	for _, item := range items {
+		data := RspReviewItemData{
+			Id:         item.Id.Hex(),
+			CampaignId: item.Campaign.Hex(),
+			User:       userId2Name[item.User],
+			UserId:     item.User.Hex(),
+			Role:       roleId2Name[item.Role],
+			RoleId:     item.Role.Hex(),
+			Department: deptId2Name[item.Department],
+			Reviewers:  make([]string, 0, len(item.Reviewers)),
+			Deadline:   item.Deadline.Unix(),
+			Escalated:  item.Escalated,
+			Decision:   item.Decision,
+			Reviewer:   userId2Name[item.Reviewer],
+			Comment:    item.Comment,
+		}
+		if data.Decision == service.ReviewDecisionPending {
+			data.Decision = reviewDecisionPending
+		}
+		if !item.ReviewTime.IsZero() {
+			data.ReviewTime = item.ReviewTime.Unix()
+		}
+		for _, reviewer := range item.Reviewers {
+			data.Reviewers = append(data.Reviewers, userId2Name[reviewer])
+		}
+		list = append(list, data)
+	}
+	return list, nil
+}
+
+// 接口上以pending表示待审查
+const reviewDecisionPending = "pending"
+
+func reviewDecision(decision *string) *string {
+	if decision == nil || *decision != reviewDecisionPending {
+		return decision
+	}
+	pending := service.ReviewDecisionPending
+	return &pending
+}
+
+func formatReportTime(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
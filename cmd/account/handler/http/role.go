@@ -0,0 +1,483 @@
+package httphandler
+
+import (
+	"net/http"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Request: GetRoleList
+type ReqGetRoleList struct {
+	Page     int64   `form:"page"  binding:"required,gte=1"`      // 分页数，默认1页开始
+	PageSize int64   `form:"page_size"  binding:"required,gte=0"` // 每页数量，传0代表返回全部
+	Name     *string `form:"name" binding:"omitempty" `           // 搜索角色名；模糊匹配
+	Platform *int64  `form:"platform" binding:"omitempty,gte=0"`  // 所属平台id，0为账号中心，不传返回全部
+}
+
+// Response: GetRoleList
+type RspGetRoleList struct {
+	List  []RspRoleData `json:"list"`
+	Total int64         `json:"total"` // 结果集总数
+}
+
+// RspRoleData
+type RspRoleData struct {
+	Id                   string          `json:"id"`                     // 主键
+	Name                 string          `json:"name"`                   // 角色名
+	Auths                map[int64]int64 `json:"auths"`                  // 权限集 key是权限对象的二进制掩码，value是权限动作的二进制掩码取或
+	DataScope            string          `json:"data_scope"`             // 数据范围 self|department|subtree|custom|all
+	DataScopeDepartments []string        `json:"data_scope_departments"` // 数据范围为custom时可访问的部门id
+	Parents              []string        `json:"parents"`                // 继承的上级角色id
+	Platform             int64           `json:"platform"`               // 所属平台id，0为账号中心
+	UserCount            int64           `json:"user_count"`             // 角色下的用户数
+	Creator              string          `json:"creator"`                // 创建者姓名
+	CreateTime           int64           `json:"create_time"`            // 创建时间-时间戳
+	Updator              string          `json:"updator"`                // 修改者姓名
+	UpdateTime           int64           `json:"update_time"`            // 修改时间-时间戳
+}
+
+// @Tags 角色
+// @Summary 角色列表
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param page query int true "第几页，默认从1开始"
+// @Param page_size query int true "每页结果数"
+// @Param name query string false "筛选条件：角色名（模糊匹配）"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetRoleList}
+// @Router /api/v3/roles [get]
+func GetRoleList(c *gin.Context) {
+	// param
+	req := ReqGetRoleList{
+		PageSize: cfg.DefaultPageSize,
+	}
+	err := c.ShouldBind(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	req.Page = req.Page - 1
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcRole := service.NewRoleService(&me)
+	svcUser := service.NewUserService(&me)
+
+	filter := service.FilterRole{
+		Name:     req.Name,
+		Platform: req.Platform,
+	}
+
+	// 获取列表
+	roles, cerr := svcRole.Gets(req.Page, req.PageSize, filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	// 结果集总数
+	total, cerr := svcRole.GetCount(filter)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	userIds := make([]primitive.ObjectID, 0, 2*len(roles))
+	for _, role := range roles {
+		userIds = append(userIds, role.Creator, role.Updator)
+	}
+	userId2Name, cerr := svcUser.GetNameMap(userIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	roleIds := make([]primitive.ObjectID, 0, len(roles))
+	for _, role := range roles {
+		roleIds = append(roleIds, role.Id)
+	}
+	userCounts, cerr := svcUser.CountByRoles(roleIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	list := make([]RspRoleData, 0, len(roles))
+	for _, role := range roles {
+		data := RspRoleData{
+			Id:                   role.Id.Hex(),
+			Name:                 role.Name,
+			Auths:                role.Auths,
+			DataScope:            role.DataScope,
+			DataScopeDepartments: idsHex(role.DataScopeDepartments),
+			Parents:              idsHex(role.Parents),
+			Platform:             role.Platform,
+			UserCount:            userCounts[role.Id],
+			Creator:              userId2Name[role.Creator],
+			CreateTime:           role.CreateTime.Unix(),
+			Updator:              userId2Name[role.Updator],
+			UpdateTime:           role.UpdateTime.Unix(),
+		}
+		list = append(list, data)
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetRoleList{
+		List:  list,
+		Total: total,
+	}))
+}
+
+// Request: AddRole
+type ReqAddRole struct {
+	Name                 string          `json:"name" binding:"required"`                    // 角色名
+	Auths                map[int64]int64 `json:"auths" binding:"omitempty"`                  // 权限集 key是权限对象的二进制掩码，value是权限动作的二进制掩码取或
+	DataScope            string          `json:"data_scope" binding:"omitempty"`             // 数据范围 self|department|subtree|custom|all，默认department
+	DataScopeDepartments []string        `json:"data_scope_departments" binding:"omitempty"` // 数据范围为custom时可访问的部门id
+	Parents              []string        `json:"parents" binding:"omitempty"`                // 继承的上级角色id
+	Platform             int64           `json:"platform" binding:"omitempty,gte=0"`         // 所属平台id，默认0即账号中心；其他平台的权限集按该平台登记的权限对象校验
+}
+
+// Response: AddRole
+type RspAddRole struct {
+	Id string `json:"id"` // 角色id
+}
+
+// @Tags 角色
+// @Summary 新增角色
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqAddRole  true "请求参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspAddRole}
+// @Router /api/v3/role [post]
+func AddRole(c *gin.Context) {
+	// param
+	var req ReqAddRole
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	if req.Platform == 0 && !IsValidAuths(req.Auths) {
+		log.Errorf("invalid auths: %v", req.Auths)
+		c.Error(&radarerror.InvalidAuths)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcRole := service.NewRoleService(&me)
+
+	id, cerr := svcRole.Add(model.Role{
+		Name:                 req.Name,
+		Auths:                req.Auths,
+		DataScope:            req.DataScope,
+		DataScopeDepartments: hexIds(req.DataScopeDepartments),
+		Parents:              hexIds(req.Parents),
+		Platform:             req.Platform,
+	})
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspAddRole{
+			Id: id.Hex(),
+		}),
+	)
+}
+
+// Request: UpdateRole
+type ReqUpdateRole struct {
+	Set service.SetRole `json:"set" binding:"required"` // 增量修改
+}
+
+// @Tags 角色
+// @Summary 编辑角色
+// @Description 修改权限集、数据范围或上级角色后，该角色及所有下级角色的用户需要重新登录；修改后违反职责分离约束的不允许保存
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqUpdateRole true "请求参数"
+// @Param id path string true "角色id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/role/:id [put]
+func UpdateRole(c *gin.Context) {
+	// param
+	var req ReqUpdateRole
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	roleId := mongodao.Hex2Id(c.Param("id"))
+	if roleId == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcRole := service.NewRoleService(&me)
+
+	// 账号中心的权限集按代码中的权限对象校验，其他平台的由service校验
+	if req.Set.Auths != nil {
+		role, cerr := svcRole.GetById(roleId)
+		if cerr != nil {
+			c.Error(cerr)
+			return
+		}
+		if role.Platform == 0 && !IsValidAuths(*req.Set.Auths) {
+			log.Errorf("invalid auths: %v", *req.Set.Auths)
+			c.Error(&radarerror.InvalidAuths)
+			return
+		}
+	}
+
+	cerr = svcRole.Update(roleId, req.Set)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
+
+// @Tags 角色
+// @Summary 删除角色
+// @Description 角色下仍有用户或仍被其他角色继承时不允许删除
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "角色id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/role/:id [delete]
+func DeleteRole(c *gin.Context) {
+	// param
+	roleId := mongodao.Hex2Id(c.Param("id"))
+	if roleId == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcRole := service.NewRoleService(&me)
+
+	cerr = svcRole.Delete(roleId)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
+
+// Request: CloneRole
+type ReqCloneRole struct {
+	Name string `json:"name" binding:"required"` // 新角色名
+}
+
+// @Tags 角色
+// @Summary 复制角色
+// @Description 新角色的权限集、数据范围、上级角色与原角色相同
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqCloneRole  true "请求参数"
+// @Param id path string true "被复制的角色id"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspAddRole}
+// @Router /api/v3/role/:id/clone [post]
+func CloneRole(c *gin.Context) {
+	// param
+	var req ReqCloneRole
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	roleId := mongodao.Hex2Id(c.Param("id"))
+	if roleId == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcRole := service.NewRoleService(&me)
+
+	id, cerr := svcRole.Clone(roleId, req.Name)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspAddRole{
+			Id: id.Hex(),
+		}),
+	)
+}
+
+// Response: GetRoleTemplateList
+type RspGetRoleTemplateList struct {
+	List []RspRoleTemplateData `json:"list"`
+}
+
+// RspRoleTemplateData
+type RspRoleTemplateData struct {
+	Key       string          `json:"key"`        // 模板标识
+	Name      string          `json:"name"`       // 默认角色名
+	Auths     map[int64]int64 `json:"auths"`      // 权限集 key是权限对象的二进制掩码，value是权限动作的二进制掩码取或
+	DataScope string          `json:"data_scope"` // 数据范围
+}
+
+// @Tags 角色
+// @Summary 内置角色模板列表
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetRoleTemplateList}
+// @Router /api/v3/role/templates [get]
+func GetRoleTemplateList(c *gin.Context) {
+	templates := RoleTemplates()
+	list := make([]RspRoleTemplateData, 0, len(templates))
+	for _, template := range templates {
+		list = append(list, RspRoleTemplateData{
+			Key:       template.Key,
+			Name:      template.Name,
+			Auths:     template.Auths,
+			DataScope: template.DataScope,
+		})
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetRoleTemplateList{
+		List: list,
+	}))
+}
+
+// Request: AddRoleFromTemplate
+type ReqAddRoleFromTemplate struct {
+	Template string `json:"template" binding:"required"` // 模板标识
+	Name     string `json:"name" binding:"omitempty"`    // 角色名，不传则用模板的默认角色名
+}
+
+// @Tags 角色
+// @Summary 根据模板新增角色
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqAddRoleFromTemplate  true "请求参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspAddRole}
+// @Router /api/v3/role/template [post]
+func AddRoleFromTemplate(c *gin.Context) {
+	// param
+	var req ReqAddRoleFromTemplate
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	var template *RoleTemplate
+	for _, t := range RoleTemplates() {
+		if t.Key == req.Template {
+			template = &t
+			break
+		}
+	}
+	if template == nil {
+		log.Errorf("role template not found: %v", req.Template)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	if req.Name == "" {
+		req.Name = template.Name
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcRole := service.NewRoleService(&me)
+
+	id, cerr := svcRole.Add(model.Role{
+		Name:      req.Name,
+		Auths:     template.Auths,
+		DataScope: template.DataScope,
+	})
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspAddRole{
+			Id: id.Hex(),
+		}),
+	)
+}
@@ -0,0 +1,291 @@
+package httphandler
+
+import (
+	"net/http"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SodAuthData
+type SodAuthData struct {
+	Platform int64 `json:"platform" binding:"omitempty,gte=0"` // 所属平台id，默认0即账号中心
+	Obj      int64 `json:"obj" binding:"required"`             // 权限对象的二进制掩码
+	Act      int64 `json:"act" binding:"required"`             // 权限动作的二进制掩码取或，须同时拥有全部动作才算拥有
+}
+
+// Request: AddSodConstraint
+type ReqAddSodConstraint struct {
+	Name        string        `json:"name" binding:"required"`         // 约束名
+	Description string        `json:"description" binding:"omitempty"` // 说明
+	Roles       []string      `json:"roles" binding:"omitempty"`       // 互斥的角色id
+	Auths       []SodAuthData `json:"auths" binding:"omitempty,dive"`  // 互斥的权限
+}
+
+// Response: AddSodConstraint
+type RspAddSodConstraint struct {
+	Id string `json:"id"` // 约束id
+}
+
+// @Tags 职责分离
+// @Summary 新增职责分离约束
+// @Description 列出的角色和权限互斥，同一用户最多只能拥有其中一项（按继承后的角色和权限，以及临时授权判定），至少两项；已违反的用户不受影响，见违规报告
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqAddSodConstraint  true "请求参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspAddSodConstraint}
+// @Router /api/v3/sod_constraint [post]
+func AddSodConstraint(c *gin.Context) {
+	// param
+	var req ReqAddSodConstraint
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	auths := make([]model.SodAuth, 0, len(req.Auths))
+	for _, auth := range req.Auths {
+		if auth.Platform == 0 && !IsValidAuths(map[int64]int64{auth.Obj: auth.Act}) {
+			log.Errorf("invalid auths: %+v", auth)
+			c.Error(&radarerror.InvalidAuths)
+			return
+		}
+		auths = append(auths, model.SodAuth{Platform: auth.Platform, Obj: auth.Obj, Act: auth.Act})
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcSod := service.NewSodService(&me)
+
+	id, cerr := svcSod.Add(model.SodConstraint{
+		Name:        req.Name,
+		Description: req.Description,
+		Roles:       hexIds(req.Roles),
+		Auths:       auths,
+	})
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspAddSodConstraint{
+			Id: id.Hex(),
+		}),
+	)
+}
+
+// Response: GetSodConstraintList
+type RspGetSodConstraintList struct {
+	List []RspSodConstraintData `json:"list"`
+}
+
+// RspSodConstraintData
+type RspSodConstraintData struct {
+	Id          string        `json:"id"`          // 主键
+	Name        string        `json:"name"`        // 约束名
+	Description string        `json:"description"` // 说明
+	Roles       []string      `json:"roles"`       // 互斥的角色名
+	RoleIds     []string      `json:"role_ids"`    // 互斥的角色id
+	Auths       []SodAuthData `json:"auths"`       // 互斥的权限
+}
+
+// @Tags 职责分离
+// @Summary 职责分离约束列表
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetSodConstraintList}
+// @Router /api/v3/sod_constraints [get]
+func GetSodConstraintList(c *gin.Context) {
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcSod := service.NewSodService(&me)
+
+	constraints, cerr := svcSod.Gets()
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	var roleIds []primitive.ObjectID
+	for _, constraint := range constraints {
+		roleIds = append(roleIds, constraint.Roles...)
+	}
+	svcRole := service.NewRoleService(&me)
+	roleId2Name, cerr := svcRole.GetNameMap(roleIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	list := make([]RspSodConstraintData, 0, len(constraints))
+	for _, constraint := range constraints {
+		list = append(list, RspSodConstraintData{
+			Id:          constraint.Id.Hex(),
+			Name:        constraint.Name,
+			Description: constraint.Description,
+			Roles:       roleNames(constraint.Roles, roleId2Name),
+			RoleIds:     idsHex(constraint.Roles),
+			Auths:       sodAuthList(constraint.Auths),
+		})
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetSodConstraintList{
+		List: list,
+	}))
+}
+
+// @Tags 职责分离
+// @Summary 删除职责分离约束
+// @Description
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "约束id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/sod_constraint/:id [delete]
+func DeleteSodConstraint(c *gin.Context) {
+	// param
+	id := mongodao.Hex2Id(c.Param("id"))
+	if id == primitive.NilObjectID {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcSod := service.NewSodService(&me)
+
+	cerr = svcSod.Delete(id)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
+
+// Response: GetSodViolationList
+type RspGetSodViolationList struct {
+	List []RspSodViolationData `json:"list"`
+}
+
+// RspSodViolationData
+type RspSodViolationData struct {
+	UserId    string               `json:"user_id"`   // 用户id
+	User      string               `json:"user"`      // 用户名
+	Account   string               `json:"account"`   // 账号
+	Conflicts []RspSodConflictData `json:"conflicts"` // 违反的约束
+}
+
+// RspSodConflictData
+type RspSodConflictData struct {
+	ConstraintId string        `json:"constraint_id"` // 约束id
+	Constraint   string        `json:"constraint"`    // 约束名
+	Roles        []string      `json:"roles"`         // 同时拥有的互斥角色名
+	Auths        []SodAuthData `json:"auths"`         // 同时拥有的互斥权限
+}
+
+// @Tags 职责分离
+// @Summary 职责分离违规报告
+// @Description 数据范围内已同时拥有互斥角色或权限的用户，含当前有效的临时授权附加的角色和权限
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetSodViolationList}
+// @Router /api/v3/sod_violations [get]
+func GetSodViolationList(c *gin.Context) {
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcSod := service.NewSodService(&me)
+
+	violations, cerr := svcSod.Violations()
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	var roleIds []primitive.ObjectID
+	for _, violation := range violations {
+		for _, conflict := range violation.Conflicts {
+			roleIds = append(roleIds, conflict.Roles...)
+		}
+	}
+	svcRole := service.NewRoleService(&me)
+	roleId2Name, cerr := svcRole.GetNameMap(roleIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	list := make([]RspSodViolationData, 0, len(violations))
+	for _, violation := range violations {
+		data := RspSodViolationData{
+			UserId:    violation.User.Id.Hex(),
+			User:      violation.User.Name,
+			Account:   violation.User.Account,
+			Conflicts: make([]RspSodConflictData, 0, len(violation.Conflicts)),
+		}
+		for _, conflict := range violation.Conflicts {
+			data.Conflicts = append(data.Conflicts, RspSodConflictData{
+				ConstraintId: conflict.Constraint.Id.Hex(),
+				Constraint:   conflict.Constraint.Name,
+				Roles:        roleNames(conflict.Roles, roleId2Name),
+				Auths:        sodAuthList(conflict.Auths),
+			})
+		}
+		list = append(list, data)
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetSodViolationList{
+		List: list,
+	}))
+}
+
+func sodAuthList(auths []model.SodAuth) []SodAuthData {
+	list := make([]SodAuthData, 0, len(auths))
+	for _, auth := range auths {
+		list = append(list, SodAuthData{Platform: auth.Platform, Obj: auth.Obj, Act: auth.Act})
+	}
+	return list
+}
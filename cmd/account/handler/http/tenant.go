@@ -0,0 +1,178 @@
+package httphandler
+
+import (
+	"net/http"
+	"strconv"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Response: GetTenantList
+type RspGetTenantList struct {
+	List []RspTenantData `json:"list"`
+}
+
+// RspTenantData
+type RspTenantData struct {
+	Id         int64  `json:"id"`          // 唯一标识
+	Name       string `json:"name"`        // 显示名
+	CreateTime int64  `json:"create_time"` // 创建时间-时间戳
+}
+
+// @Tags 租户
+// @Summary 租户列表
+// @Description 不含默认租户(0)
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspGetTenantList}
+// @Router /api/v3/tenants [get]
+func GetTenantList(c *gin.Context) {
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcTenant := service.NewTenantService(&me)
+
+	tenants, cerr := svcTenant.Gets()
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	list := make([]RspTenantData, 0, len(tenants))
+	for _, tenant := range tenants {
+		list = append(list, RspTenantData{
+			Id:         tenant.Uid,
+			Name:       tenant.Name,
+			CreateTime: tenant.CreateTime.Unix(),
+		})
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspGetTenantList{
+		List: list,
+	}))
+}
+
+// Request: AddTenant
+type ReqAddTenant struct {
+	Name         string `json:"name" binding:"required"`          // 显示名，同时作为初始管理员所在的顶级部门名
+	AdminAccount string `json:"admin_account" binding:"required"` // 初始管理员账号，初始密码为默认密码
+	AdminName    string `json:"admin_name" binding:"omitempty"`   // 初始管理员显示名
+}
+
+// Response: AddTenant
+type RspAddTenant struct {
+	Id int64 `json:"id"` // 唯一标识，登录时通过请求头X-Tenant-Id指定
+}
+
+// @Tags 租户
+// @Summary 新增租户
+// @Description 只有默认租户的用户可以操作；同时创建该租户的超级管理员角色和初始管理员
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqAddTenant  true "请求参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspAddTenant}
+// @Router /api/v3/tenant [post]
+func AddTenant(c *gin.Context) {
+	// param
+	var req ReqAddTenant
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcTenant := service.NewTenantService(&me)
+
+	uid, cerr := svcTenant.Add(model.Tenant{
+		Name: req.Name,
+	}, service.TenantAdmin{
+		Account: req.AdminAccount,
+		Name:    req.AdminName,
+	}, FullAuthMp())
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspAddTenant{
+			Id: uid,
+		}),
+	)
+}
+
+// Request: UpdateTenant
+type ReqUpdateTenant struct {
+	Set service.SetTenant `json:"set" binding:"required"` // 增量修改
+}
+
+// @Tags 租户
+// @Summary 编辑租户
+// @Description 只有默认租户的用户可以操作
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqUpdateTenant true "请求参数"
+// @Param id path int true "租户id"
+// @Success 200  {object} radarerror.Response
+// @Router /api/v3/tenant/:id [put]
+func UpdateTenant(c *gin.Context) {
+	// param
+	var req ReqUpdateTenant
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	uid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || uid <= 0 {
+		log.Errorf("invalid id: %v", c.Param("id"))
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcTenant := service.NewTenantService(&me)
+
+	cerr = svcTenant.Update(uid, req.Set)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, radarerror.Success.Response())
+}
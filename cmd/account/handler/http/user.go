@@ -2,12 +2,12 @@ package httphandler
 
 import (
 	"net/http"
+	"time"
 
 	radarerror "github.com/SeeJson/account/error"
 	"github.com/SeeJson/account/model"
 	"github.com/SeeJson/account/service"
 	"github.com/SeeJson/account/util/captcha"
-	"github.com/SeeJson/account/util/jwt"
 	mongodao "github.com/SeeJson/account/util/mongo"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -20,18 +20,21 @@ type ReqLogin struct {
 	Password      string `json:"password" binding:"required"`                  // 密码
 	CaptchaId     string `json:"captcha_id,omitempty" binding:"omitempty"`     // 验证码ID
 	CaptchaAnswer string `json:"captcha_result,omitempty" binding:"omitempty"` // 验证码
+	Platform      int64  `json:"platform,omitempty" binding:"omitempty,gte=0"` // 登录的平台id，默认0即账号中心；令牌只携带该平台的权限
 }
 
 // Response: Login
 type RspLogin struct {
 	NeedReset bool `json:"need_reset"` // 是否需要重设密码
+	NewDevice bool `json:"new_device"` // 是否首次在该设备登录
 }
 
 // @Summary 登录
-// @Description
+// @Description 同一账号或来源ip连续输错密码达到max_password_failure次后须带验证码，否则返回20046
 // @Tags 登录相关
 // @Accept application/json
 // @Produce application/json
+// @Param X-Tenant-Id header int false "租户uid，默认0即默认租户"
 // @Param body body  ReqLogin  true "查询参数"
 // @Success 200  {object} radarerror.ResponseWithData{data=RspLogin}
 // @Router /api/v3/auth/login [post]
@@ -46,20 +49,74 @@ func Login(c *gin.Context) {
 	}
 
 	//验证验证码 fixme! 由前端判断是否要验证验证码
+	captchaVerified := false
 	if req.CaptchaId != "" || req.CaptchaAnswer != "" {
 		if ok := captcha.Verify(req.CaptchaId, req.CaptchaAnswer); !ok {
 			log.Errorf("captcha verify failed!")
 			c.Error(&radarerror.InvalidCaptcha)
 			return
 		}
+		captchaVerified = true
 	}
 
-	var cerr *radarerror.CommonError
-	svcUser := service.NewUserService(nil)
+	// 租户
+	tenant, ok := GetHeaderTenant(c)
+	if !ok {
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+	svcTenant := service.NewTenantService(nil)
+	cerr := svcTenant.Check(tenant)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	// 平台
+	if req.Platform != 0 {
+		svcPlatform := service.NewPlatformService(nil)
+		_, cerr := svcPlatform.GetByUid(req.Platform)
+		if cerr != nil {
+			c.Error(cerr)
+			return
+		}
+	}
+
+	// 连续输错密码后须带验证码，应急账号同样计数
+	ip := RemoteIP(c)
+	if !captchaVerified && service.NeedLoginCaptcha(req.Account, ip) {
+		log.Errorf("login need captcha: %v %v", req.Account, ip)
+		c.Error(&radarerror.PasswordNeedCaptcha)
+		return
+	}
+
+	// 应急账号
+	bgMe, cerr := service.BreakGlassLogin(tenant, req.Account, req.Password, ip, FullAuthMp())
+	if cerr == &radarerror.InvalidPassword {
+		service.AddLoginFailure(req.Account, ip)
+		c.Error(cerr)
+		return
+	} else if cerr != nil {
+		c.Error(cerr)
+		return
+	} else if bgMe != nil {
+		service.ClearLoginFailure(req.Account)
+		token, err := service.GenSessionToken(*bgMe)
+		if err != nil {
+			c.Error(&radarerror.InternalServerError)
+			return
+		}
+		c.Header("Authorization", "Bearer "+token)
+		c.JSON(http.StatusOK, radarerror.Success.ResponseWithData(RspLogin{}))
+		return
+	}
+
+	svcUser := service.NewUserService(service.SystemME(tenant))
 
 	user, cerr := svcUser.GetByAccount(req.Account)
 	if cerr == &radarerror.UserNotFound {
-		log.Errorf("account not found: %v", err)
+		log.Errorf("account not found: %v", req.Account)
+		service.AddLoginFailure(req.Account, ip)
 		c.Error(&radarerror.AccountNotFound)
 		return
 	} else if cerr != nil {
@@ -70,42 +127,56 @@ func Login(c *gin.Context) {
 	// check password
 	if !service.CheckPassword(user, req.Password) {
 		log.Errorf("password not match")
+		service.AddLoginFailure(req.Account, ip)
 		c.Error(&radarerror.InvalidPassword)
 		return
 	}
+	service.ClearLoginFailure(req.Account)
+
+	// 识别设备
+	deviceToken := c.GetHeader(HeaderDeviceToken)
+	if deviceToken == "" {
+		deviceToken, _ = c.Cookie(CookieDeviceToken)
+	}
+	deviceId := service.ParseDeviceToken(deviceToken)
+	svcDevice := service.NewDeviceService(service.SystemME(tenant))
+	newDevice, cerr := svcDevice.CheckNewDevice(user.Id, deviceId, captchaVerified)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
 
 	// refresh version
 	version := service.RefreshSessionVersion(user.Id)
 
 	// session
-	authMp := make(map[int64]int64)
-	me := service.ME{
-		Id:      user.Id,
-		Version: version,
-		AuthMp:  authMp,
-
-		Account:        user.Account,
-		Name:           user.Name,
-		PasswordReset:  user.PasswordReset,
-		Department:     user.Department,
-		DepartmentName: "",
-		Role:           user.Role,
-		RoleName:       "",
-		PoliceNumber:   user.PoliceNumber,
-		Phone:          user.Phone,
-	}
-
-	// jwt token
-	token, err := jwt.GenBase64Token(me.Json())
+	me, cerr := service.NewME(user, version, req.Platform)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	// token
+	token, err := service.GenSessionToken(me)
 	if err != nil {
 		c.Error(&radarerror.InternalServerError)
 		return
 	}
 	c.Header("Authorization", "Bearer "+token)
 
+	// 记录受信任设备
+	deviceToken, cerr = svcDevice.Trust(user.Id, deviceId, c.Request.UserAgent(), ip)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+	c.Header(HeaderDeviceToken, deviceToken)
+	c.SetCookie(CookieDeviceToken, deviceToken, service.GetDeviceConfig().MaxAge, "/", "", false, true)
+
 	c.JSON(http.StatusOK,
 		radarerror.Success.ResponseWithData(RspLogin{
 			NeedReset: !user.PasswordReset,
+			NewDevice: newDevice,
 		}),
 	)
 
@@ -143,6 +214,96 @@ func Logout(c *gin.Context) {
 	// todo
 }
 
+// Request: Reauth
+type ReqReauth struct {
+	Password      string `json:"password" binding:"required"`                  // 密码
+	CaptchaId     string `json:"captcha_id,omitempty" binding:"omitempty"`     // 验证码ID，连续输错密码后必填
+	CaptchaAnswer string `json:"captcha_result,omitempty" binding:"omitempty"` // 验证码
+}
+
+// Response: Reauth
+type RspReauth struct {
+	ExpireTime int64 `json:"expire_time"` // 重新验证的失效时间-时间戳
+}
+
+// @Summary 重新验证身份
+// @Description 删除用户、重置密码、变更角色等敏感操作前需要重新输入密码，换取短期有效的令牌
+// @Description 目前只支持密码验证：账号中心尚无动态口令、短信等第二因素，接入后在此增加第二因素的验证方式
+// @Tags 登录相关
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param body body  ReqReauth  true "请求参数"
+// @Success 200  {object} radarerror.ResponseWithData{data=RspReauth}
+// @Router /api/v3/auth/reauth [post]
+func Reauth(c *gin.Context) {
+	// param
+	var req ReqReauth
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		c.Error(&radarerror.InvalidArgs)
+		return
+	}
+
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
+	var cerr *radarerror.CommonError
+	svcUser := service.NewUserService(&me)
+
+	// 验证密码；尚无第二因素可用，见接口说明
+	user, cerr := svcUser.GetById(me.Id)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	// check password
+	if service.NeedPasswordCaptcha(user.Id) {
+		if req.CaptchaId == "" && req.CaptchaAnswer == "" {
+			log.Errorf("too many password failures: %v", user.Id)
+			c.Error(&radarerror.PasswordNeedCaptcha)
+			return
+		}
+		if ok := captcha.Verify(req.CaptchaId, req.CaptchaAnswer); !ok {
+			log.Errorf("captcha verify failed!")
+			c.Error(&radarerror.InvalidCaptcha)
+			return
+		}
+	}
+	if !service.CheckPassword(user, req.Password) {
+		log.Errorf("password not match")
+		service.AddPasswordFailure(user.Id)
+		c.Error(&radarerror.InvalidPassword)
+		return
+	}
+	service.ClearPasswordFailure(user.Id)
+
+	// token
+	me.ReauthTime = time.Now().Unix()
+	token, err := service.ReissueSessionToken(c.GetString(SessToken), me)
+	if err != nil {
+		c.Error(&radarerror.InternalServerError)
+		return
+	}
+	c.Header("Authorization", "Bearer "+token)
+
+	log.Infof("user re-authenticated: %v", me.Id.Hex())
+
+	c.JSON(http.StatusOK,
+		radarerror.Success.ResponseWithData(RspReauth{
+			ExpireTime: me.ReauthTime + cfg.ReauthMaxAge,
+		}),
+	)
+}
+
 // @Summary 超管给用户重置初始密码
 // @Description 超级管理员重置指定用户的密码为默认密码，用户登录时需要重设密码
 // @Tags 用户
@@ -173,22 +334,6 @@ func ResetPassword(c *gin.Context) {
 	var cerr *radarerror.CommonError
 	svcUser := service.NewUserService(&me)
 
-	user, cerr := svcUser.GetById(userId)
-	if cerr != nil {
-		c.Error(cerr)
-		return
-	}
-
-	// 检查跨部门权限
-	if !CheckAuth(&me, []Auth{{Obj: AuthObjTransDepartment, Act: AuthActGet}}) {
-		// 检查是否本部门
-		if me.Department != user.Department {
-			log.Debugf("different department, me: %v, user: %v", me.Department.Hex(), user.Department.Hex())
-			c.Error(&radarerror.ExceedAuthority)
-			return
-		}
-	}
-
 	cerr = svcUser.UpdatePassword(userId, "", true)
 	if cerr != nil {
 		c.Error(cerr)
@@ -305,19 +450,19 @@ type RspGetUserList struct {
 
 // RspUserData
 type RspUserData struct {
-	Id           string `json:"id"`            // 主键
-	Account      string `json:"account"`       // 登录账号
-	Name         string `json:"name"`          // 显示名
-	Department   string `json:"department"`    // 部门名
-	DepartmentId string `json:"department_id"` // 部门名
-	Role         string `json:"role"`          // 角色名
-	RoleId       string `json:"role_id"`       // 角色ID
-	PoliceNumber string `json:"police_number"` // 警号
-	Phone        string `json:"phone"`         // 手机号
-	Creator      string `json:"creator"`       // 创建者姓名
-	CreateTime   int64  `json:"create_time"`   // 创建时间-时间戳
-	Updator      string `json:"updator"`       // 修改者姓名
-	UpdateTime   int64  `json:"update_time"`   // 修改时间-时间戳
+	Id           string   `json:"id"`            // 主键
+	Account      string   `json:"account"`       // 登录账号
+	Name         string   `json:"name"`          // 显示名
+	Department   string   `json:"department"`    // 部门名
+	DepartmentId string   `json:"department_id"` // 部门名
+	Roles        []string `json:"roles"`         // 角色名
+	RoleIds      []string `json:"role_ids"`      // 角色ID
+	PoliceNumber string   `json:"police_number"` // 警号
+	Phone        string   `json:"phone"`         // 手机号
+	Creator      string   `json:"creator"`       // 创建者姓名
+	CreateTime   int64    `json:"create_time"`   // 创建时间-时间戳
+	Updator      string   `json:"updator"`       // 修改者姓名
+	UpdateTime   int64    `json:"update_time"`   // 修改时间-时间戳
 }
 
 // @Tags 用户
@@ -367,21 +512,7 @@ func GetUserList(c *gin.Context) {
 	}
 	if req.Role != nil {
 		roleId := mongodao.Hex2Id(*req.Role)
-		filter.Department = &roleId
-	}
-
-	// 检查跨部门权限
-	if !CheckAuth(&me, []Auth{{Obj: AuthObjTransDepartment, Act: AuthActGet}}) {
-		if filter.Department != nil {
-			// 检查是否本部门
-			if me.Department != *filter.Department {
-				log.Debugf("different department, me: %v, user: %v", me.Department.Hex(), (*filter.Department).Hex())
-				c.Error(&radarerror.ExceedAuthority)
-				return
-			}
-		} else {
-			filter.Department = &me.Department
-		}
+		filter.Role = &roleId
 	}
 
 	// 获取列表
@@ -405,35 +536,48 @@ func GetUserList(c *gin.Context) {
 		return
 	}
 
-	userId2Name := make(map[primitive.ObjectID]string)
-	userId2Name[primitive.NilObjectID] = ""
+	userIds := make([]primitive.ObjectID, 0, 2*len(users))
+	for _, user := range users {
+		userIds = append(userIds, user.Creator, user.Updator)
+	}
+	userId2Name, cerr := svcUser.GetNameMap(userIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	roleIds := make([]primitive.ObjectID, 0, len(users))
+	for _, user := range users {
+		roleIds = append(roleIds, user.Roles...)
+	}
+	svcRole := service.NewRoleService(&me)
+	roleId2Name, cerr := svcRole.GetNameMap(roleIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	deptIds := make([]primitive.ObjectID, 0, len(users))
+	for _, user := range users {
+		deptIds = append(deptIds, user.Department)
+	}
+	svcDepartment := service.NewDepartmentService(&me)
+	deptId2Name, cerr := svcDepartment.GetNameMap(deptIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
 
 	list := make([]RspUserData, 0, len(users))
 	for _, user := range users {
-		if _, ok := userId2Name[user.Creator]; !ok {
-			user, cerr := svcUser.GetById(user.Creator)
-			if cerr != nil {
-				c.Error(cerr)
-				return
-			}
-			userId2Name[user.Creator] = user.Name
-		}
-		if _, ok := userId2Name[user.Updator]; !ok {
-			user, cerr := svcUser.GetById(user.Updator)
-			if cerr != nil {
-				c.Error(cerr)
-				return
-			}
-			userId2Name[user.Updator] = user.Name
-		}
 		data := RspUserData{
 			Id:           user.Id.Hex(),
 			Account:      user.Account,
 			Name:         user.Name,
-			Department:   "",
+			Department:   deptId2Name[user.Department],
 			DepartmentId: user.Department.Hex(),
-			Role:         "",
-			RoleId:       user.Role.Hex(),
+			Roles:        roleNames(user.Roles, roleId2Name),
+			RoleIds:      idsHex(user.Roles),
 			PoliceNumber: user.PoliceNumber,
 			Phone:        user.Phone,
 			Creator:      userId2Name[user.Creator],
@@ -453,12 +597,12 @@ func GetUserList(c *gin.Context) {
 
 // Request: ReqAddUser
 type ReqAddUser struct {
-	Account      string `json:"account" binding:"required" `       // 账号
-	Name         string `json:"name" binding:"required" `          // 用户名
-	Department   string `json:"department" binding:"required"`     // 部门id
-	Role         string `json:"role" binding:"required"`           // 角色id
-	PoliceNumber string `json:"police_number" binding:"omitempty"` // 警号
-	Phone        string `json:"phone" binding:"omitempty,phone"`   // 手机号
+	Account      string   `json:"account" binding:"required" `       // 账号
+	Name         string   `json:"name" binding:"required" `          // 用户名
+	Department   string   `json:"department" binding:"required"`     // 部门id
+	Roles        []string `json:"roles" binding:"required,min=1"`    // 角色id，可以多个，权限取并集
+	PoliceNumber string   `json:"police_number" binding:"omitempty"` // 警号
+	Phone        string   `json:"phone" binding:"omitempty,phone"`   // 手机号
 }
 
 // Response: RspAddUser
@@ -498,21 +642,11 @@ func AddUser(c *gin.Context) {
 		Account:      req.Account,
 		Name:         req.Name,
 		Department:   mongodao.Hex2Id(req.Department),
-		Role:         mongodao.Hex2Id(req.Role),
+		Roles:        hexIds(req.Roles),
 		PoliceNumber: req.PoliceNumber,
 		Phone:        req.Phone,
 	}
 
-	// 检查跨部门权限
-	if !CheckAuth(&me, []Auth{{Obj: AuthObjTransDepartment, Act: AuthActGet}}) {
-		// 检查是否本部门
-		if me.Department != user.Department {
-			log.Debugf("different department, me: %v, user: %v", me.Department.Hex(), user.Department.Hex())
-			c.Error(&radarerror.ExceedAuthority)
-			return
-		}
-	}
-
 	var cerr *radarerror.CommonError
 	svcUser := service.NewUserService(&me)
 
@@ -569,16 +703,11 @@ func UpdateUser(c *gin.Context) {
 	}
 	me := ss.(service.ME)
 
-	if req.Set.Department != nil {
-		// 检查跨部门权限
-		if !CheckAuth(&me, []Auth{{Obj: AuthObjTransDepartment, Act: AuthActGet}}) {
-			// 检查是否本部门
-			if me.Department.Hex() != *req.Set.Department {
-				log.Debugf("different department, me: %v, user: %v", me.Department.Hex(), *req.Set.Department)
-				c.Error(&radarerror.ExceedAuthority)
-				return
-			}
-		}
+	// 变更角色属于敏感操作；应急账号没有重新验证的途径，与路由权限检查一样不受限制，每次访问已审计
+	if req.Set.Roles != nil && !me.BreakGlass && !CheckReauth(&me) {
+		log.Errorf("need to re-authenticate: %v", me.Id.Hex())
+		c.Error(&radarerror.NeedReauth)
+		return
 	}
 
 	var cerr *radarerror.CommonError
@@ -623,22 +752,6 @@ func DeleteUser(c *gin.Context) {
 	var cerr *radarerror.CommonError
 	svcUser := service.NewUserService(&me)
 
-	user, cerr := svcUser.GetById(userId)
-	if cerr != nil {
-		c.Error(cerr)
-		return
-	}
-
-	// 检查跨部门权限
-	if !CheckAuth(&me, []Auth{{Obj: AuthObjTransDepartment, Act: AuthActGet}}) {
-		// 检查是否本部门
-		if me.Department != user.Department {
-			log.Debugf("different department, me: %v, user: %v", me.Department.Hex(), user.Department.Hex())
-			c.Error(&radarerror.ExceedAuthority)
-			return
-		}
-	}
-
 	cerr = svcUser.Delete(userId)
 	if cerr != nil {
 		c.Error(cerr)
@@ -665,15 +778,15 @@ type RspGetDeletedUserList struct {
 
 // RspDeletedUserData
 type RspDeletedUserData struct {
-	Id           string `json:"id"`            // 主键（务必设置omitempty，让驱动自动生成）
-	Account      string `json:"account"`       // 登录账号
-	Name         string `json:"name"`          // 显示名
-	Department   string `json:"department"`    // 部门名
-	Role         string `json:"role"`          // 角色名
-	PoliceNumber string `json:"police_number"` // 警号
-	Phone        string `json:"phone"`         // 手机号
-	Updator      string `json:"updator"`       // 删除者姓名
-	UpdateTime   int64  `json:"update_time"`   // 删除时间-时间戳
+	Id           string   `json:"id"`            // 主键（务必设置omitempty，让驱动自动生成）
+	Account      string   `json:"account"`       // 登录账号
+	Name         string   `json:"name"`          // 显示名
+	Department   string   `json:"department"`    // 部门名
+	Roles        []string `json:"roles"`         // 角色名
+	PoliceNumber string   `json:"police_number"` // 警号
+	Phone        string   `json:"phone"`         // 手机号
+	Updator      string   `json:"updator"`       // 删除者姓名
+	UpdateTime   int64    `json:"update_time"`   // 删除时间-时间戳
 }
 
 // @Tags 用户
@@ -723,21 +836,7 @@ func GetDeletedUserList(c *gin.Context) {
 	}
 	if req.Role != nil {
 		roleId := mongodao.Hex2Id(*req.Role)
-		filter.Department = &roleId
-	}
-
-	// 检查跨部门权限
-	if !CheckAuth(&me, []Auth{{Obj: AuthObjTransDepartment, Act: AuthActGet}}) {
-		if filter.Department != nil {
-			// 检查是否本部门
-			if me.Department != *filter.Department {
-				log.Debugf("different department, me: %v, user: %v", me.Department.Hex(), (*filter.Department).Hex())
-				c.Error(&radarerror.ExceedAuthority)
-				return
-			}
-		} else {
-			filter.Department = &me.Department
-		}
+		filter.Role = &roleId
 	}
 
 	// 获取列表
@@ -754,25 +853,46 @@ func GetDeletedUserList(c *gin.Context) {
 		return
 	}
 
-	userId2Name := make(map[primitive.ObjectID]string)
-	userId2Name[primitive.NilObjectID] = ""
+	userIds := make([]primitive.ObjectID, 0, len(users))
+	for _, user := range users {
+		userIds = append(userIds, user.Updator)
+	}
+	userId2Name, cerr := svcUser.GetNameMap(userIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	roleIds := make([]primitive.ObjectID, 0, len(users))
+	for _, user := range users {
+		roleIds = append(roleIds, user.Roles...)
+	}
+	svcRole := service.NewRoleService(&me)
+	roleId2Name, cerr := svcRole.GetNameMap(roleIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
+
+	deptIds := make([]primitive.ObjectID, 0, len(users))
+	for _, user := range users {
+		deptIds = append(deptIds, user.Department)
+	}
+	svcDepartment := service.NewDepartmentService(&me)
+	deptId2Name, cerr := svcDepartment.GetNameMap(deptIds)
+	if cerr != nil {
+		c.Error(cerr)
+		return
+	}
 
 	list := make([]RspDeletedUserData, 0, len(users))
 	for _, user := range users {
-		if _, ok := userId2Name[user.Updator]; !ok {
-			user, cerr := svcUser.GetById(user.Updator)
-			if cerr != nil {
-				c.Error(cerr)
-				return
-			}
-			userId2Name[user.Updator] = user.Name
-		}
 		data := RspDeletedUserData{
 			Id:           user.Id.Hex(),
 			Account:      user.Account,
 			Name:         user.Name,
-			Department:   "",
-			Role:         "",
+			Department:   deptId2Name[user.Department],
+			Roles:        roleNames(user.Roles, roleId2Name),
 			PoliceNumber: user.PoliceNumber,
 			Phone:        user.Phone,
 			Updator:      userId2Name[user.Updator],
@@ -855,21 +975,7 @@ func GetUserRender(c *gin.Context) {
 	}
 	if req.Role != nil {
 		roleId := mongodao.Hex2Id(*req.Role)
-		filter.Department = &roleId
-	}
-
-	// 检查跨部门权限
-	if !CheckAuth(&me, []Auth{{Obj: AuthObjTransDepartment, Act: AuthActGet}}) {
-		if filter.Department != nil {
-			// 检查是否本部门
-			if me.Department != *filter.Department {
-				log.Debugf("different department, me: %v, user: %v", me.Department.Hex(), (*filter.Department).Hex())
-				c.Error(&radarerror.ExceedAuthority)
-				return
-			}
-		} else {
-			filter.Department = &me.Department
-		}
+		filter.Role = &roleId
 	}
 
 	// 获取列表
@@ -930,8 +1036,17 @@ func GetGenAccountByName(c *gin.Context) {
 		return
 	}
 
+	// session
+	ss, ok := c.Get(SessME)
+	if !ok {
+		log.Errorf("need login")
+		c.Error(&radarerror.Unauthorized)
+		return
+	}
+	me := ss.(service.ME)
+
 	var cerr *radarerror.CommonError
-	svcUser := service.NewUserService(nil)
+	svcUser := service.NewUserService(&me)
 	// 获取
 	name, cerr := svcUser.GetCreateAccount(req.Name)
 	if cerr != nil {
@@ -945,3 +1060,31 @@ func GetGenAccountByName(c *gin.Context) {
 		}),
 	)
 }
+
+/***** 辅助函数 *****/
+
+func roleNames(ids []primitive.ObjectID, id2Name map[primitive.ObjectID]string) []string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if name, ok := id2Name[id]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func idsHex(ids []primitive.ObjectID) []string {
+	hexes := make([]string, 0, len(ids))
+	for _, id := range ids {
+		hexes = append(hexes, id.Hex())
+	}
+	return hexes
+}
+
+func hexIds(hexes []string) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(hexes))
+	for _, hex := range hexes {
+		ids = append(ids, mongodao.Hex2Id(hex))
+	}
+	return ids
+}
@@ -1,9 +1,48 @@
 package rpchandler
 
 import (
+	"context"
+	"strconv"
+
 	pb "github.com/SeeJson/account/api/account"
+	radarerror "github.com/SeeJson/account/error"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	MetadataTenant    = "x-tenant-id"  // 调用方所属租户，不传为默认租户
+	MetadataRequestId = "x-request-id" // 请求id，用于关联调用链
 )
 
 type Server struct {
 	pb.UnimplementedAccountServer
 }
+
+/*
+ * 从请求的metadata获取租户
+ */
+func getTenant(ctx context.Context) (int64, *radarerror.CommonError) {
+	value := getMetadata(ctx, MetadataTenant)
+	if value == "" {
+		return modelbase.TenantDefault, nil
+	}
+	tenant, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || tenant < 0 {
+		log.Errorf("invalid tenant: %v", value)
+		return 0, &radarerror.InvalidArgs
+	}
+	return tenant, nil
+}
+
+/*
+ * 获取请求的metadata里的某个值，没有则为空
+ */
+func getMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(key)) == 0 {
+		return ""
+	}
+	return md.Get(key)[0]
+}
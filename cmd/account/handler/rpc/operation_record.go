@@ -5,6 +5,8 @@ import (
 
 	pb "github.com/SeeJson/account/api/account"
 	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
 	mongodao "github.com/SeeJson/account/util/mongo"
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -24,6 +26,25 @@ func (g *Server) AddOperation(ctx context.Context, req *pb.ReqAddOperation) (*pb
 		return nil, &radarerror.InvalidArgs
 	}
 
-	// todo
-	return &pb.RspAddOperation{}, nil
+	tenant, cerr := getTenant(ctx)
+	if cerr != nil {
+		return nil, cerr
+	}
+	requestId := req.RequestId
+	if requestId == "" {
+		requestId = getMetadata(ctx, MetadataRequestId)
+	}
+
+	svcOperation := service.NewOperationRecordService(service.SystemME(tenant))
+	id, cerr := svcOperation.Add(model.OperationRecord{
+		User:      userId,
+		Module:    req.ModuleId,
+		Desc:      req.Desc,
+		Service:   req.Service,
+		RequestId: requestId,
+	})
+	if cerr != nil {
+		return nil, cerr
+	}
+	return &pb.RspAddOperation{Id: id.Hex()}, nil
 }
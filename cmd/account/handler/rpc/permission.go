@@ -0,0 +1,93 @@
+package rpchandler
+
+import (
+	"context"
+	"sort"
+
+	pb "github.com/SeeJson/account/api/account"
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/service"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 权限校验rpc
+func (g *Server) CheckPermission(ctx context.Context, req *pb.ReqCheckPermission) (*pb.RspCheckPermission, error) {
+	err := req.Validate()
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		return nil, &radarerror.InvalidArgs
+	}
+
+	userId := mongodao.Hex2Id(req.UserId)
+	if userId == primitive.NilObjectID {
+		log.Errorf("invalid UserId: %v", req.UserId)
+		return nil, &radarerror.InvalidArgs
+	}
+	deptId := primitive.NilObjectID
+	if req.Department != "" {
+		deptId = mongodao.Hex2Id(req.Department)
+		if deptId == primitive.NilObjectID {
+			log.Errorf("invalid Department: %v", req.Department)
+			return nil, &radarerror.InvalidArgs
+		}
+	}
+
+	tenant, cerr := getTenant(ctx)
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	decision, cerr := service.CheckPermission(tenant, userId, req.Platform, req.AuthObj, req.AuthAct, deptId)
+	if cerr != nil {
+		return nil, cerr
+	}
+	return &pb.RspCheckPermission{
+		Allowed: decision.Allowed,
+		Reason:  decision.Reason,
+	}, nil
+}
+
+// 有效权限rpc
+func (g *Server) GetEffectivePermissions(ctx context.Context, req *pb.ReqGetEffectivePermissions) (*pb.RspGetEffectivePermissions, error) {
+	err := req.Validate()
+	if err != nil {
+		log.Errorf("fail to bind param: %v", err)
+		return nil, &radarerror.InvalidArgs
+	}
+
+	userId := mongodao.Hex2Id(req.UserId)
+	if userId == primitive.NilObjectID {
+		log.Errorf("invalid UserId: %v", req.UserId)
+		return nil, &radarerror.InvalidArgs
+	}
+
+	tenant, cerr := getTenant(ctx)
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	perms, cerr := service.GetEffectivePermissions(tenant, userId, req.Platform)
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	rsp := &pb.RspGetEffectivePermissions{
+		Auths:       make([]*pb.Permission, 0, len(perms.Auths)),
+		DataScope:   perms.DataScope,
+		Departments: make([]string, 0, len(perms.Departments)),
+		Roles:       perms.Roles,
+	}
+	for obj, acts := range perms.Auths {
+		if acts == 0 {
+			continue
+		}
+		rsp.Auths = append(rsp.Auths, &pb.Permission{AuthObj: obj, AuthActs: acts})
+	}
+	sort.Slice(rsp.Auths, func(i, j int) bool { return rsp.Auths[i].AuthObj < rsp.Auths[j].AuthObj })
+	for _, id := range perms.Departments {
+		rsp.Departments = append(rsp.Departments, id.Hex())
+	}
+	return rsp, nil
+}
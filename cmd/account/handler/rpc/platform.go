@@ -5,16 +5,33 @@ import (
 
 	pb "github.com/SeeJson/account/api/account"
 	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/service"
 	log "github.com/sirupsen/logrus"
 )
 
-// 添加操作记录rpc
+// 获取平台列表rpc，按优先级从高到低
 func (g *Server) GetsPlatform(ctx context.Context, req *pb.ReqGetsPlatform) (*pb.RspGetsPlatform, error) {
 	err := req.Validate()
 	if err != nil {
 		log.Errorf("fail to bind param: %v", err)
 		return nil, &radarerror.InvalidArgs
 	}
-	// todo
-	return &pb.RspGetsPlatform{}, nil
+
+	svcPlatform := service.NewPlatformService(nil)
+	platforms, cerr := svcPlatform.Gets()
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	list := make([]*pb.Platform, 0, len(platforms))
+	for _, platform := range platforms {
+		list = append(list, &pb.Platform{
+			Id:         platform.Uid,
+			Name:       platform.Name,
+			Priority:   platform.Priority,
+			SysPreset:  platform.SysPreset,
+			CreateTime: platform.CreateTime.Unix(),
+		})
+	}
+	return &pb.RspGetsPlatform{List: list}, nil
 }
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"flag"
+	"io/ioutil"
+	"os"
+
+	"github.com/SeeJson/account/cmd/account/bootstrap"
 	"github.com/SeeJson/account/cmd/account/config"
 	httpserver "github.com/SeeJson/account/cmd/account/server/http"
+	rpcserver "github.com/SeeJson/account/cmd/account/server/rpc"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/service"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -12,13 +20,85 @@ import (
 func main() {
 	var err error
 
+	// 只生成路由权限报告，不启动服务
+	routeReport := flag.String("route_report", "", "write route permission report to the given file and exit")
+	// 只校验审计日志、操作记录的哈希链，不启动服务；有断开时退出码为1
+	verifyAudit := flag.Bool("verify_audit", false, "verify audit hash chains of all tenants and exit")
+	// 只把归档文件恢复到只读表restored_{collection}，不启动服务
+	restoreArchive := flag.String("restore_archive", "", "restore the given archive file into a read-only collection and exit")
+	flag.Parse()
+	if *routeReport != "" {
+		report, err := httpserver.RouteReport()
+		if err != nil {
+			log.Fatalf("fail to generate route report: %v", err)
+		}
+		err = ioutil.WriteFile(*routeReport, []byte(report), 0644)
+		if err != nil {
+			log.Fatalf("fail to write route report: %v", err)
+		}
+		return
+	}
+
 	// load config
 	err = config.Load("../../conf", "config", "yaml")
 	if err != nil {
 		log.Fatalf("fail to load config: %v", err)
 	}
 
-	// todo start rpc server
+	if *verifyAudit {
+		intact, cerr := service.VerifyAllAuditChains()
+		if cerr != nil {
+			log.Fatalf("fail to verify audit chains: %v", cerr)
+		}
+		if !intact {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *restoreArchive != "" {
+		manifest, cerr := service.RestoreArchive(*restoreArchive)
+		if cerr != nil {
+			log.Fatalf("fail to restore archive: %v", cerr)
+		}
+		log.Infof("restored %v records of tenant %v into %v%v", manifest.Count, manifest.Tenant, model.CollectionRestoredPrefix, manifest.Collection)
+		return
+	}
+
+	// 初始化超级管理员角色等数据
+	err = bootstrap.Run()
+	if err != nil {
+		log.Fatalf("fail to bootstrap: %v", err)
+	}
+
+	// 应急账号不能与已有用户同名，否则该用户无法登录
+	conflicts, cerr := service.BreakGlassAccountConflicts()
+	if cerr != nil {
+		log.Fatalf("fail to check break-glass accounts: %v", cerr)
+	}
+	if len(conflicts) > 0 {
+		log.Fatalf("break-glass accounts conflict with users: %v", conflicts)
+	}
+
+	// 临时授权的生效与到期
+	go service.RunGrantJob()
+
+	// 访问审查的到期处理
+	go service.RunReviewJob()
+
+	// 审计哈希链的签名检查点
+	go service.RunAuditCheckpointJob()
+
+	// 审计日志、操作记录的归档
+	go service.RunArchiveJob()
+
+	// start rpc server
+	go func() {
+		err := rpcserver.Run()
+		if err != nil {
+			log.Fatalf("fail to start rpc server: %v", err)
+		}
+	}()
 
 	// start http server
 	err = httpserver.Run()
@@ -6,13 +6,14 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"strings"
 	"time"
 
 	handler "github.com/SeeJson/account/cmd/account/handler/http"
 	radarerror "github.com/SeeJson/account/error"
+	modelbase "github.com/SeeJson/account/model/base"
 	"github.com/SeeJson/account/service"
-	"github.com/SeeJson/account/util/jwt"
 	mstring "github.com/SeeJson/account/util/string"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -52,25 +53,9 @@ func decodeJwtToken(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	b64Token := tokenFields[1]
+	token := tokenFields[1]
 
-	jwtClaim, err := jwt.DecodeB64Token(b64Token)
-
-	if err != nil {
-		c.Error(&radarerror.Unauthorized)
-		c.Abort()
-		return
-	}
-
-	// check token timeout
-	if jwtClaim.Exp < time.Now().Unix() {
-		log.Errorf("token expired: %v", b64Token)
-		c.Error(&radarerror.Unauthorized)
-		c.Abort()
-		return
-	}
-
-	me, err := service.LoadME(jwtClaim.Payload)
+	me, err := service.LoadSessionToken(token)
 	if err != nil {
 		log.Errorf("fail to decode session: %v", err)
 		c.Error(&radarerror.Unauthorized)
@@ -80,6 +65,17 @@ func decodeJwtToken(c *gin.Context) {
 
 	log.Debugf("me: %+v", me)
 
+	// 登录后以令牌里的租户为准，请求头另外指定了其他租户的拒绝
+	if c.GetHeader(handler.HeaderTenant) != "" {
+		tenant, ok := handler.GetHeaderTenant(c)
+		if !ok || tenant != me.Tenant {
+			log.Errorf("tenant mismatch: header %v, token %v", c.GetHeader(handler.HeaderTenant), me.Tenant)
+			c.Error(&radarerror.Unauthorized)
+			c.Abort()
+			return
+		}
+	}
+
 	// check user version
 	if !service.IsSessionVersionValid(me.Id, me.Version) {
 		log.Errorf("token version invalid: %v", me.Version)
@@ -97,80 +93,59 @@ func decodeJwtToken(c *gin.Context) {
 	// todo role
 
 	c.Set(handler.SessME, *me)
+	c.Set(handler.SessToken, token)
 
 	c.Next()
 }
 
-// 格式：map[uri][method][]handler.Auth
-var apiAuthMap map[string]map[string][]handler.Auth = map[string]map[string][]handler.Auth{
-	"/api/v3/user/:id/password": {
-		"PUT": []handler.Auth{
-			{Obj: handler.AuthObjUser, Act: handler.AuthActUpdate},
-		},
-	},
-	"/api/v3/roles": {
-		"GET": []handler.Auth{
-			{Obj: handler.AuthObjRole, Act: handler.AuthActGet},
-		},
-	},
-	"/api/v3/role": {
-		"POST": []handler.Auth{
-			{Obj: handler.AuthObjRole, Act: handler.AuthActAdd},
-		},
-	},
-	"/api/v3/role/:id": {
-		"PUT": []handler.Auth{
-			{Obj: handler.AuthObjRole, Act: handler.AuthActUpdate},
-		},
-		"DELETE": []handler.Auth{
-			{Obj: handler.AuthObjRole, Act: handler.AuthActDelete},
-		},
-	},
-	"/api/v3/departments": {
-		"GET": []handler.Auth{
-			{Obj: handler.AuthObjDepartment, Act: handler.AuthActGet},
-		},
-	},
-	"/api/v3/department": {
-		"POST": []handler.Auth{
-			{Obj: handler.AuthObjDepartment, Act: handler.AuthActAdd},
-		},
-	},
-	"/api/v3/department/:id": {
-		"PUT": []handler.Auth{
-			{Obj: handler.AuthObjDepartment, Act: handler.AuthActUpdate},
-		},
-		"DELETE": []handler.Auth{
-			{Obj: handler.AuthObjDepartment, Act: handler.AuthActDelete},
-		},
-	},
-	"/api/v3/users": {
-		"GET": []handler.Auth{
-			{Obj: handler.AuthObjUser, Act: handler.AuthActGet},
-		},
-	},
-	"/api/v3/users/deleted": {
-		"GET": []handler.Auth{
-			{Obj: handler.AuthObjUser, Act: handler.AuthActGet},
-		},
-	},
-	"/api/v3/user": {
-		"POST": []handler.Auth{
-			{Obj: handler.AuthObjUser, Act: handler.AuthActAdd},
-		},
-	},
-	"/api/v3/user/:id": {
-		"PUT": []handler.Auth{
-			{Obj: handler.AuthObjUser, Act: handler.AuthActUpdate},
-		},
-		"DELETE": []handler.Auth{
-			{Obj: handler.AuthObjUser, Act: handler.AuthActDelete},
-		},
-	},
+/*
+ * 审计修改数据的请求：记录操作人、目标、结果，以及dao记录的数据变更
+ * 放在权限校验之前，被拒绝的请求也会记录
+ */
+func auditTrail(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+
+	// session
+	ss, ok := c.Get(handler.SessME)
+	if !ok {
+		c.Next()
+		return
+	}
+	me := ss.(service.ME)
+	me.Changes = &modelbase.ChangeLog{}
+	c.Set(handler.SessME, me)
+
+	c.Next()
+
+	var cerr *radarerror.CommonError
+	errs := c.Errors.ByType(gin.ErrorTypeAny)
+	if len(errs) > 0 {
+		var ok bool
+		if cerr, ok = errs.Last().Err.(*radarerror.CommonError); !ok {
+			cerr = &radarerror.InternalServerError
+		}
+	}
+	svcAudit := service.NewAuditService(&me)
+	aerr := svcAudit.AddRequest(service.AuditRequest{
+		Ip:        handler.RemoteIP(c),
+		Method:    c.Request.Method,
+		Route:     c.FullPath(),
+		Path:      c.Request.URL.Path,
+		Target:    c.Param("id"),
+		RequestId: c.GetString(HeaderRequestId),
+		Err:       cerr,
+	})
+	if aerr != nil {
+		log.Errorf("fail to audit request %v %v: %v", c.Request.Method, c.Request.URL.Path, aerr)
+	}
 }
 
 /*
- * 对个别请求做权限校验
+ * 按路由注册时声明的权限做校验
  */
 func checkPermission(c *gin.Context) {
 	uri := c.Request.URL.Path
@@ -186,28 +161,48 @@ func checkPermission(c *gin.Context) {
 	}
 	me := ss.(service.ME)
 
-	if _, ok := apiAuthMap[uri]; !ok {
-		c.Next()
+	// 启动时已检查所有路由都有声明，这里找不到说明路由未注册（如404），直接拒绝
+	perm, ok := getRoutePerm(method, c.FullPath())
+	if !ok {
+		log.Errorf("route without permission declaration: %v %v", method, uri)
+		c.Error(&radarerror.ForbiddenAccess)
+		c.Abort()
 		return
 	}
 
-	if _, ok := apiAuthMap[uri][method]; !ok {
+	// 应急账号不受权限限制，但每次访问都要审计
+	if me.BreakGlass {
+		cerr := service.CheckBreakGlassAccess(&me, handler.RemoteIP(c), method, uri)
+		if cerr != nil {
+			c.Error(cerr)
+			c.Abort()
+			return
+		}
 		c.Next()
 		return
 	}
 
-	if !handler.CheckAuth(&me, apiAuthMap[uri][method]) {
-		log.Errorf("exceed authority: %v %v %v", me.Id.Hex(), uri, method)
-		c.Error(&radarerror.ExceedAuthority)
-		c.Abort()
-		return
+	if len(perm.Auths) > 0 {
+		if !handler.CheckAuth(&me, perm.Auths) {
+			log.Errorf("exceed authority: %v %v %v, need: %v", me.Id.Hex(), uri, method, perm)
+			c.Error(&radarerror.ExceedAuthority)
+			c.Abort()
+			return
+		}
+
+		// check passwd_reset
+		if !me.PasswordReset {
+			log.Errorf("need to reset password: %v %v %v", me.Id.Hex(), uri, method)
+			c.Error(&radarerror.NeedResetPwd)
+			c.Abort()
+			return
+		}
 	}
 
-	// check passwd_reset
-	if !me.PasswordReset &&
-		(uri != "/api/v3/user/password" || method != "PUT") {
-		log.Errorf("need to reset password: %v %v %v", me.Id.Hex(), uri, method)
-		c.Error(&radarerror.NeedResetPwd)
+	// 敏感操作需要近期重新验证过身份
+	if perm.Reauth && !handler.CheckReauth(&me) {
+		log.Errorf("need to re-authenticate: %v %v %v", me.Id.Hex(), uri, method)
+		c.Error(&radarerror.NeedReauth)
 		c.Abort()
 		return
 	}
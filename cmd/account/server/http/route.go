@@ -0,0 +1,177 @@
+package httpserver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	handler "github.com/SeeJson/account/cmd/account/handler/http"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+ * 路由的权限声明，注册路由时必须同时声明
+ */
+type Perm struct {
+	Public   bool           // 公开接口，无需登录
+	AuthOnly bool           // 登录即可访问
+	Auths    []handler.Auth // 需要同时拥有的权限
+	Reauth   bool           // 敏感操作，需要近期重新验证过身份
+}
+
+// 公开接口
+func Public() Perm {
+	return Perm{Public: true}
+}
+
+// 登录即可访问
+func AuthOnly() Perm {
+	return Perm{AuthOnly: true}
+}
+
+// 需要同时拥有给定的权限
+func Need(auths ...handler.Auth) Perm {
+	return Perm{Auths: auths}
+}
+
+// 在原有声明上追加重新验证身份的要求
+func (p Perm) WithReauth() Perm {
+	p.Reauth = true
+	return p
+}
+
+func (p Perm) String() string {
+	var parts []string
+	if p.Public {
+		parts = append(parts, "public")
+	}
+	if p.AuthOnly {
+		parts = append(parts, "authenticated")
+	}
+	for _, auth := range p.Auths {
+		parts = append(parts, fmt.Sprintf("%v:%v", handler.AuthObjName(auth.Obj), handler.AuthActName(auth.Act)))
+	}
+	if p.Reauth {
+		parts = append(parts, "reauth")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// 格式：map[method][full path]Perm，full path与gin.Context.FullPath()一致
+var routePerms = map[string]map[string]Perm{}
+
+/*
+ * 注册路由并声明权限
+ */
+func handle(group *gin.RouterGroup, method, path string, perm Perm, handlers ...gin.HandlerFunc) {
+	fullPath := joinPath(group.BasePath(), path)
+	if _, ok := routePerms[method]; !ok {
+		routePerms[method] = make(map[string]Perm)
+	}
+	routePerms[method][fullPath] = perm
+	group.Handle(method, path, handlers...)
+}
+
+func getRoutePerm(method, fullPath string) (Perm, bool) {
+	perm, ok := routePerms[method][fullPath]
+	return perm, ok
+}
+
+/*
+ * 按实际请求路径查找路由声明，用于权限解释接口
+ * 先精确匹配，再按 :param 和 *any 逐段匹配
+ */
+func matchRoutePerm(method, uri string) (string, Perm, bool) {
+	if perm, ok := getRoutePerm(method, uri); ok {
+		return uri, perm, true
+	}
+	segs := strings.Split(strings.Trim(uri, "/"), "/")
+	for fullPath, perm := range routePerms[method] {
+		if matchPath(strings.Split(strings.Trim(fullPath, "/"), "/"), segs) {
+			return fullPath, perm, true
+		}
+	}
+	return "", Perm{}, false
+}
+
+func matchPath(patterns, segs []string) bool {
+	for i, pattern := range patterns {
+		if strings.HasPrefix(pattern, "*") {
+			return true
+		}
+		if i >= len(segs) {
+			return false
+		}
+		if !strings.HasPrefix(pattern, ":") && pattern != segs[i] {
+			return false
+		}
+	}
+	return len(patterns) == len(segs)
+}
+
+// 供权限解释接口查询路由声明
+func resolveRoutePerm(method, uri string) (handler.RoutePerm, bool) {
+	fullPath, perm, ok := matchRoutePerm(method, uri)
+	if !ok {
+		return handler.RoutePerm{}, false
+	}
+	return handler.RoutePerm{
+		FullPath: fullPath,
+		Public:   perm.Public,
+		AuthOnly: perm.AuthOnly,
+		Auths:    perm.Auths,
+		Reauth:   perm.Reauth,
+	}, true
+}
+
+/*
+ * 检查所有路由都声明了权限
+ */
+func checkRoutePerms(router *gin.Engine) error {
+	var missing []string
+	for _, route := range router.Routes() {
+		perm, ok := getRoutePerm(route.Method, route.Path)
+		if !ok || (!perm.Public && !perm.AuthOnly && len(perm.Auths) == 0) {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("routes without permission declaration: %v", strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+/*
+ * 生成路由权限报告（markdown表格）
+ */
+func RouteReport() (string, error) {
+	router, err := getRouter()
+	if err != nil {
+		return "", err
+	}
+	routes := router.Routes()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	var b strings.Builder
+	b.WriteString("| Method | Path | Permission |\n")
+	b.WriteString("| --- | --- | --- |\n")
+	for _, route := range routes {
+		perm, _ := getRoutePerm(route.Method, route.Path)
+		b.WriteString(fmt.Sprintf("| %v | %v | %v |\n", route.Method, route.Path, perm))
+	}
+	return b.String(), nil
+}
+
+/***** 辅助函数 *****/
+
+func joinPath(base, path string) string {
+	if path == "" {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
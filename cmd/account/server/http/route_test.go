@@ -0,0 +1,32 @@
+package httpserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMatchRoutePerm(t *testing.T) {
+	if _, err := getRouter(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		method, uri, fullPath string
+	}{
+		{http.MethodPut, "/api/v3/user/password", "/api/v3/user/password"},
+		{http.MethodPut, "/api/v3/user/5f1d7f0e2d9a4b0001a1b2c3", "/api/v3/user/:id"},
+		{http.MethodPut, "/api/v3/user/5f1d7f0e2d9a4b0001a1b2c3/password", "/api/v3/user/:id/password"},
+		{http.MethodPost, "/api/v3/role/5f1d7f0e2d9a4b0001a1b2c3/clone", "/api/v3/role/:id/clone"},
+		{http.MethodGet, "/swagger/index.html", "/swagger/*any"},
+	}
+	for _, c := range cases {
+		fullPath, _, ok := matchRoutePerm(c.method, c.uri)
+		if !ok || fullPath != c.fullPath {
+			t.Fatalf("%v %v: got %v %v, want %v", c.method, c.uri, fullPath, ok, c.fullPath)
+		}
+	}
+
+	if _, _, ok := matchRoutePerm(http.MethodGet, "/api/v3/not/exist"); ok {
+		t.Fatal("unexpected match for unknown route")
+	}
+}
@@ -1,6 +1,8 @@
 package httpserver
 
 import (
+	"net/http"
+
 	_ "github.com/SeeJson/account/cmd/account/docs"
 	handler "github.com/SeeJson/account/cmd/account/handler/http"
 	"github.com/gin-gonic/gin"
@@ -9,32 +11,106 @@ import (
 	"github.com/swaggo/gin-swagger/swaggerFiles"
 )
 
-func getRouter() *gin.Engine {
+func getRouter() (*gin.Engine, error) {
 	binding.Validator = new(defaultValidator)
 	router := gin.Default()
 	router.Use(gin.Recovery())
 	router.Use(errorHandler())
 	router.Use(RequestID())
 	router.Use(Logger())
+	handler.SetRoutePermResolver(resolveRoutePerm)
 
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	publicGroup := &router.RouterGroup
+	handle(publicGroup, http.MethodGet, "/swagger/*any", Public(), ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	authGroup := router.Group("/api/v3", decodeJwtToken, checkPermission)
+	authGroup := router.Group("/api/v3", decodeJwtToken, auditTrail, checkPermission)
 
 	// 登录相关
-	router.POST("/api/v3/auth/login", handler.Login)
-	router.GET("/api/v3/auth/captcha", handler.GenCaptcha)
+	handle(publicGroup, http.MethodPost, "/api/v3/auth/login", Public(), handler.Login)
+	handle(publicGroup, http.MethodGet, "/api/v3/auth/captcha", Public(), handler.GenCaptcha)
+	handle(authGroup, http.MethodPost, "/auth/reauth", AuthOnly(), handler.Reauth) // 敏感操作前重新验证身份
 
 	// 用户
-	authGroup.POST("/user", handler.AddUser)
-	authGroup.GET("/users", handler.GetUserList)
-	authGroup.GET("/users/deleted", handler.GetDeletedUserList)
-	authGroup.PUT("/user/:id", handler.UpdateUser)
-	authGroup.DELETE("/user/:id", handler.DeleteUser)
-	authGroup.PUT("/user/:id/password", handler.ResetPassword) // 超级管理员给用户重置密码
-	authGroup.PUT("/user/password", handler.UpdateMyPassword)  // 用户自己修改密码
-	authGroup.PUT("/user/phone", handler.UpdateMyPassword)     // 用户自己修改手机号
-	authGroup.GET("/users/render", handler.GetUserRender)      // 获取用户render列表（返回的只有简要信息：id+name） 这种通常不限制权限
-
-	return router
+	handle(authGroup, http.MethodPost, "/user", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActAdd}), handler.AddUser)
+	handle(authGroup, http.MethodGet, "/users", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActGet}), handler.GetUserList)
+	handle(authGroup, http.MethodGet, "/users/deleted", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActGet}), handler.GetDeletedUserList)
+	handle(authGroup, http.MethodPut, "/user/:id", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActUpdate}), handler.UpdateUser)
+	handle(authGroup, http.MethodDelete, "/user/:id", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActDelete}).WithReauth(), handler.DeleteUser)
+	handle(authGroup, http.MethodPut, "/user/:id/password", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActUpdate}).WithReauth(), handler.ResetPassword) // 超级管理员给用户重置密码
+	handle(authGroup, http.MethodPost, "/user/create/account_name", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActAdd}), handler.GetGenAccountByName)   // 根据姓名生成账号
+	handle(authGroup, http.MethodPut, "/user/password", AuthOnly(), handler.UpdateMyPassword)                                                                             // 用户自己修改密码
+	handle(authGroup, http.MethodPut, "/user/phone", AuthOnly(), handler.UpdateMyPhone)                                                                                   // 用户自己修改手机号
+	handle(authGroup, http.MethodGet, "/users/render", AuthOnly(), handler.GetUserRender)                                                                                 // 获取用户render列表（返回的只有简要信息：id+name） 这种通常不限制权限
+	handle(authGroup, http.MethodGet, "/user/devices", AuthOnly(), handler.GetMyDeviceList)                                                                               // 用户自己的受信任设备
+	handle(authGroup, http.MethodDelete, "/user/device/:id", AuthOnly(), handler.DeleteMyDevice)                                                                          // 用户移除自己的受信任设备
+	handle(authGroup, http.MethodPost, "/user/:id/grant", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActUpdate}).WithReauth(), handler.AddGrant)        // 临时授权
+	handle(authGroup, http.MethodGet, "/user/:id/grants", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActGet}), handler.GetGrantList)
+	handle(authGroup, http.MethodDelete, "/grant/:id", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActUpdate}).WithReauth(), handler.RevokeGrant)
+
+	// 角色、权限申请
+	handle(authGroup, http.MethodPost, "/access_request", AuthOnly(), handler.SubmitAccessRequest)
+	handle(authGroup, http.MethodGet, "/access_requests", AuthOnly(), handler.GetAccessRequestList)
+	handle(authGroup, http.MethodGet, "/access_request/:id", AuthOnly(), handler.GetAccessRequest)
+	handle(authGroup, http.MethodPost, "/access_request/:id/approve", AuthOnly().WithReauth(), handler.ApproveAccessRequest)
+	handle(authGroup, http.MethodPost, "/access_request/:id/reject", AuthOnly(), handler.RejectAccessRequest)
+	handle(authGroup, http.MethodPost, "/access_request/:id/cancel", AuthOnly(), handler.CancelAccessRequest)
+
+	// 访问审查
+	handle(authGroup, http.MethodPost, "/review_campaign", Need(handler.Auth{Obj: handler.AuthObjAccessReview, Act: handler.AuthActAdd}), handler.AddReviewCampaign)
+	handle(authGroup, http.MethodGet, "/review_campaigns", Need(handler.Auth{Obj: handler.AuthObjAccessReview, Act: handler.AuthActGet}), handler.GetReviewCampaignList)
+	handle(authGroup, http.MethodGet, "/review_campaign/:id/items", Need(handler.Auth{Obj: handler.AuthObjAccessReview, Act: handler.AuthActGet}), handler.GetReviewItemList)
+	handle(authGroup, http.MethodGet, "/review_campaign/:id/report", Need(handler.Auth{Obj: handler.AuthObjAccessReview, Act: handler.AuthActDownload}), handler.ExportReviewReport)
+	handle(authGroup, http.MethodGet, "/review_items/todo", AuthOnly(), handler.GetMyReviewItemList)
+	handle(authGroup, http.MethodPut, "/review_item/:id", AuthOnly().WithReauth(), handler.ReviewItem)
+
+	// 角色
+	handle(authGroup, http.MethodGet, "/auths", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActGet}), handler.GetAuthMatrix)                                                                              // 权限矩阵，供角色编辑页渲染
+	handle(authGroup, http.MethodGet, "/auths/explain", Need(handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActGet}, handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActGet}), handler.ExplainPermission) // 解释用户的权限判定过程
+	handle(authGroup, http.MethodGet, "/roles", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActGet}), handler.GetRoleList)
+	handle(authGroup, http.MethodPost, "/role", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActAdd}), handler.AddRole)
+	handle(authGroup, http.MethodPost, "/role/:id/clone", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActAdd}), handler.CloneRole)          // 复制角色
+	handle(authGroup, http.MethodGet, "/role/templates", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActGet}), handler.GetRoleTemplateList) // 内置角色模板
+	handle(authGroup, http.MethodPost, "/role/template", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActAdd}), handler.AddRoleFromTemplate) // 根据模板新增角色
+	handle(authGroup, http.MethodPut, "/role/:id", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActUpdate}).WithReauth(), handler.UpdateRole)
+	handle(authGroup, http.MethodDelete, "/role/:id", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActDelete}).WithReauth(), handler.DeleteRole)
+
+	// 职责分离约束
+	handle(authGroup, http.MethodPost, "/sod_constraint", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActAdd}).WithReauth(), handler.AddSodConstraint)
+	handle(authGroup, http.MethodGet, "/sod_constraints", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActGet}), handler.GetSodConstraintList)
+	handle(authGroup, http.MethodDelete, "/sod_constraint/:id", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActDelete}).WithReauth(), handler.DeleteSodConstraint)
+	handle(authGroup, http.MethodGet, "/sod_violations", Need(handler.Auth{Obj: handler.AuthObjRole, Act: handler.AuthActGet}, handler.Auth{Obj: handler.AuthObjUser, Act: handler.AuthActGet}), handler.GetSodViolationList) // 违规报告
+
+	// 平台
+	handle(authGroup, http.MethodGet, "/platforms", Need(handler.Auth{Obj: handler.AuthObjPlatform, Act: handler.AuthActGet}), handler.GetPlatformList)
+	handle(authGroup, http.MethodPost, "/platform", Need(handler.Auth{Obj: handler.AuthObjPlatform, Act: handler.AuthActAdd}), handler.AddPlatform)
+	handle(authGroup, http.MethodPut, "/platform/:id", Need(handler.Auth{Obj: handler.AuthObjPlatform, Act: handler.AuthActUpdate}), handler.UpdatePlatform)
+	handle(authGroup, http.MethodDelete, "/platform/:id", Need(handler.Auth{Obj: handler.AuthObjPlatform, Act: handler.AuthActDelete}).WithReauth(), handler.DeletePlatform)
+	handle(authGroup, http.MethodPost, "/platform/:id/auth_obj", Need(handler.Auth{Obj: handler.AuthObjPlatform, Act: handler.AuthActUpdate}), handler.AddPlatformAuthObj)
+	handle(authGroup, http.MethodDelete, "/platform/:id/auth_obj/:bit_mark", Need(handler.Auth{Obj: handler.AuthObjPlatform, Act: handler.AuthActUpdate}).WithReauth(), handler.DeletePlatformAuthObj)
+
+	// 租户
+	handle(authGroup, http.MethodGet, "/tenants", Need(handler.Auth{Obj: handler.AuthObjTenant, Act: handler.AuthActGet}), handler.GetTenantList)
+	handle(authGroup, http.MethodPost, "/tenant", Need(handler.Auth{Obj: handler.AuthObjTenant, Act: handler.AuthActAdd}).WithReauth(), handler.AddTenant)
+	handle(authGroup, http.MethodPut, "/tenant/:id", Need(handler.Auth{Obj: handler.AuthObjTenant, Act: handler.AuthActUpdate}), handler.UpdateTenant)
+
+	// 操作记录
+	handle(authGroup, http.MethodGet, "/operation_records", Need(handler.Auth{Obj: handler.AuthObjOperationRecord, Act: handler.AuthActGet}), handler.GetOperationRecordList)
+	handle(authGroup, http.MethodGet, "/operation_records/export", Need(handler.Auth{Obj: handler.AuthObjOperationRecord, Act: handler.AuthActDownload}), handler.ExportOperationRecordList) // 导出为csv或jsonl
+	handle(authGroup, http.MethodGet, "/audit_logs", Need(handler.Auth{Obj: handler.AuthObjOperationRecord, Act: handler.AuthActGet}), handler.GetAuditLogList)
+	handle(authGroup, http.MethodGet, "/audit_logs/export", Need(handler.Auth{Obj: handler.AuthObjOperationRecord, Act: handler.AuthActDownload}), handler.ExportAuditLogList) // 导出为csv或jsonl
+	handle(authGroup, http.MethodGet, "/audit_chains/verify", Need(handler.Auth{Obj: handler.AuthObjOperationRecord, Act: handler.AuthActGet}), handler.VerifyAuditChain)      // 校验审计哈希链
+
+	// 部门
+	handle(authGroup, http.MethodGet, "/departments", Need(handler.Auth{Obj: handler.AuthObjDepartment, Act: handler.AuthActGet}), handler.GetDepartmentTree)
+	handle(authGroup, http.MethodPost, "/department", Need(handler.Auth{Obj: handler.AuthObjDepartment, Act: handler.AuthActAdd}), handler.AddDepartment)
+	handle(authGroup, http.MethodPut, "/department/:id", Need(handler.Auth{Obj: handler.AuthObjDepartment, Act: handler.AuthActUpdate}), handler.UpdateDepartment)
+	handle(authGroup, http.MethodDelete, "/department/:id", Need(handler.Auth{Obj: handler.AuthObjDepartment, Act: handler.AuthActDelete}), handler.DeleteDepartment)
+
+	// 所有路由都必须声明权限
+	err := checkRoutePerms(router)
+	if err != nil {
+		return nil, err
+	}
+
+	return router, nil
 }
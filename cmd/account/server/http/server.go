@@ -11,6 +11,9 @@ func SetConfig(c Config) {
 }
 
 func Run() error {
-	router := getRouter()
+	router, err := getRouter()
+	if err != nil {
+		return err
+	}
 	return router.Run(cfg.Address)
 }
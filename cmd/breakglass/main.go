@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SeeJson/account/util/crypt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+ * 生成应急账号的密码密文，填入 break_glass_config.accounts[].password
+ * 用法：breakglass -key_factory {jwt_config.key_factory} -password {明文密码}
+ */
+func main() {
+	keyFactory := flag.String("key_factory", "", "jwt_config.key_factory")
+	password := flag.String("password", "", "应急账号的明文密码")
+	cost := flag.Int("cost", bcrypt.DefaultCost, "bcrypt cost")
+	flag.Parse()
+
+	if *keyFactory == "" || *password == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(*password), *cost)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fail to generate password hash: %v\n", err)
+		os.Exit(1)
+	}
+
+	encrypted, err := crypt.Encrypt(*keyFactory, string(hash))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fail to encrypt password hash: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(encrypted)
+}
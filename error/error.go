@@ -38,7 +38,8 @@ func (err *CommonError) HttpStatus() int {
 		return http.StatusInternalServerError
 	case Unauthorized.Code:
 		return http.StatusUnauthorized
-	case ForbiddenAccess.Code:
+	case ForbiddenAccess.Code,
+		NeedReauth.Code:
 		return http.StatusForbidden
 	case InvalidArgs.Code:
 		return http.StatusBadRequest
@@ -86,5 +87,33 @@ var (
 	DuplicatedDepartmentName CommonError = CommonError{20015, "duplicated department name"}
 	InvalidRegions           CommonError = CommonError{20016, "invalid regions"}
 	DuplicatedPoliceNumber   CommonError = CommonError{20017, "duplicated police number"}
-	ExceedAuthority          CommonError = CommonError{20018, "exceed your authority"} // 越权行为
+	ExceedAuthority          CommonError = CommonError{20018, "exceed your authority"}   // 越权行为
+	NeedReauth               CommonError = CommonError{20019, "need to re-authenticate"} // 敏感操作需要重新验证身份
+	DeviceNotFound           CommonError = CommonError{20020, "device not found"}
+	NewDeviceNeedCaptcha     CommonError = CommonError{20021, "new device need captcha"} // 新设备登录需要验证码
+	RoleInUse                CommonError = CommonError{20022, "role in use"}             // 角色下仍有用户
+	DepartmentNotEmpty       CommonError = CommonError{20023, "department not empty"}    // 部门下仍有子部门或用户
+	RoleInherited            CommonError = CommonError{20024, "role inherited"}          // 角色仍被其他角色继承
+	RoleInheritCycle         CommonError = CommonError{20025, "role inherit cycle"}      // 角色继承出现环
+	GrantNotFound            CommonError = CommonError{20026, "grant not found"}
+	InvalidGrantTime         CommonError = CommonError{20027, "invalid grant time"} // 临时授权的到期时间须晚于生效时间和当前时间
+	AccessRequestNotFound    CommonError = CommonError{20028, "access request not found"}
+	AccessRequestProcessed   CommonError = CommonError{20029, "access request processed"} // 审批单已处理，不能再审批或撤回
+	NoApprover               CommonError = CommonError{20030, "no approver"}              // 找不到审批人
+	ReviewCampaignNotFound   CommonError = CommonError{20031, "review campaign not found"}
+	ReviewItemNotFound       CommonError = CommonError{20032, "review item not found"}
+	ReviewItemReviewed       CommonError = CommonError{20033, "review item reviewed"} // 审查项已有结论
+	SodConstraintNotFound    CommonError = CommonError{20034, "sod constraint not found"}
+	SodViolation             CommonError = CommonError{20035, "separation of duties violation"} // 违反职责分离约束
+	PlatformNotFound         CommonError = CommonError{20036, "platform not found"}
+	DuplicatedPlatformName   CommonError = CommonError{20037, "duplicated platform name"}
+	PlatformPreset           CommonError = CommonError{20038, "platform preset"} // 系统预设平台不能删除
+	AuthObjNotFound          CommonError = CommonError{20039, "auth obj not found"}
+	DuplicatedAuthObj        CommonError = CommonError{20040, "duplicated auth obj"}
+	PlatformMismatch         CommonError = CommonError{20041, "platform mismatch"} // 角色与上级角色或令牌不属于同一平台
+	TenantNotFound           CommonError = CommonError{20042, "tenant not found"}
+	DuplicatedTenantName     CommonError = CommonError{20043, "duplicated tenant name"}
+	AuditChainBroken         CommonError = CommonError{20044, "audit chain broken"}    // 哈希链已断开，不能归档
+	InvalidArchive           CommonError = CommonError{20045, "invalid archive"}       // 归档文件的签名或摘要不符
+	PasswordNeedCaptcha      CommonError = CommonError{20046, "password need captcha"} // 连续输错密码，需要验证码
 )
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"time"
+
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionAccessRequest = "access_request"
+
+	ColAccessRequestUser          = "user"
+	ColAccessRequestRoles         = "roles"
+	ColAccessRequestAuths         = "auths"
+	ColAccessRequestExpireTime    = "expire_time"
+	ColAccessRequestJustification = "justification"
+	ColAccessRequestApprovers     = "approvers"
+	ColAccessRequestStatus        = "status"
+	ColAccessRequestSteps         = "steps"
+)
+
+// 用户申请角色或权限的审批单
+type AccessRequest struct {
+	modelbase.DataModel `bson:",inline,flatten"`
+
+	User          primitive.ObjectID   `bson:"user"`          // 申请人id
+	Roles         []primitive.ObjectID `bson:"roles"`         // 申请的角色id
+	Auths         map[int64]int64      `bson:"auths"`         // 申请的权限集，只能以临时授权的方式授予
+	ExpireTime    time.Time            `bson:"expire_time"`   // 到期时间，为空则角色长期有效
+	Justification string               `bson:"justification"` // 申请理由
+	Approvers     []primitive.ObjectID `bson:"approvers"`     // 提交时确定的审批人id
+	Status        string               `bson:"status"`        // 状态 pending|approving|approved|rejected|cancelled
+	Steps         []AccessRequestStep  `bson:"steps"`         // 处理记录
+}
+
+// 审批单的一步处理
+type AccessRequestStep struct {
+	Action   string             `bson:"action"`   // 动作 submit|approve|reject|cancel
+	Operator primitive.ObjectID `bson:"operator"` // 操作人id
+	Comment  string             `bson:"comment"`  // 备注
+	Time     time.Time          `bson:"time"`     // 操作时间
+}
+
+func NewAccessRequestDao() AccessRequestDao {
+	d := AccessRequestDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type AccessRequestDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *AccessRequestDao) GetCollectionName() string {
+	return CollectionAccessRequest
+}
+
+// implement interface modelbase.ICollection
+func (d *AccessRequestDao) ToBsonM(model interface{}) bson.M {
+	m := model.(AccessRequest)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
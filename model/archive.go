@@ -0,0 +1,91 @@
+package model
+
+import (
+	"time"
+
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	CollectionArchive = "archive"
+
+	ColArchiveCollection = "collection"
+	ColArchiveLastSeq    = "last_seq"
+
+	// 恢复归档的只读表名前缀，如restored_audit_log
+	CollectionRestoredPrefix = "restored_"
+)
+
+/*
+ * 归档文件登记：过期记录写入压缩、签名的jsonl文件后从数据库删除
+ * 签名同时保护哈希链的衔接点，校验哈希链时从最后一个归档之后开始
+ */
+type Archive struct {
+	modelbase.DataModel `bson:",inline,flatten"`
+
+	Collection string    `bson:"collection"` // 归档的表名
+	File       string    `bson:"file"`       // 归档文件名（不含目录）
+	Count      int64     `bson:"count"`      // 记录数
+	FirstSeq   int64     `bson:"first_seq"`  // 第一条记录的链序号，0)不在哈希链上
+	LastSeq    int64     `bson:"last_seq"`   // 最后一条记录的链序号，0)不在哈希链上
+	LastHash   string    `bson:"last_hash"`  // 最后一条记录的哈希
+	Before     time.Time `bson:"before"`     // 归档的是创建时间早于该时间的记录
+	Sha256     string    `bson:"sha256"`     // 归档文件的sha256
+	Sign       string    `bson:"sign"`       // 签名，base64
+}
+
+func NewArchiveDao() ArchiveDao {
+	d := ArchiveDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type ArchiveDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *ArchiveDao) GetCollectionName() string {
+	return CollectionArchive
+}
+
+// implement interface modelbase.ICollection
+func (d *ArchiveDao) ToBsonM(model interface{}) bson.M {
+	m := model.(Archive)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
+
+/*
+ * 从归档文件恢复的记录，供调查使用，服务本身不读写
+ * 记录保留原来的租户字段，不按租户隔离
+ */
+func NewRestoredDao(collection string) RestoredDao {
+	d := RestoredDao{name: CollectionRestoredPrefix + collection}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type RestoredDao struct {
+	modelbase.DataDao
+	name string
+}
+
+// implement interface modelbase.ICollection
+func (d *RestoredDao) GetCollectionName() string {
+	return d.name
+}
+
+// implement interface modelbase.ICollection
+func (d *RestoredDao) ToBsonM(model interface{}) bson.M {
+	return model.(bson.M)
+}
+
+// implement interface modelbase.IGlobalCollection
+func (d *RestoredDao) IsGlobal() bool {
+	return true
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionAuditLog = "audit_log"
+
+	ColAuditLogActor        = "actor"
+	ColAuditLogActorAccount = "actor_account"
+	ColAuditLogAction       = "action"
+	ColAuditLogSeverity     = "severity"
+	ColAuditLogIp           = "ip"
+	ColAuditLogMethod       = "method"
+	ColAuditLogPath         = "path"
+	ColAuditLogDesc         = "desc"
+	ColAuditLogTarget       = "target"
+	ColAuditLogOutcome      = "outcome"
+	ColAuditLogErrorCode    = "error_code"
+	ColAuditLogRequestId    = "request_id"
+	ColAuditLogChanges      = "changes"
+)
+
+// 审计日志，记录在租户内的哈希链上
+type AuditLog struct {
+	modelbase.DataModel  `bson:",inline,flatten"`
+	modelbase.ChainModel `bson:",inline,flatten"` // 哈希链，防止记录被篡改或删除
+
+	Actor        primitive.ObjectID `bson:"actor"`         // 操作人id
+	ActorAccount string             `bson:"actor_account"` // 操作人账号
+	Action       string             `bson:"action"`        // 动作
+	Severity     string             `bson:"severity"`      // 严重级别 info|warning|critical
+	Ip           string             `bson:"ip"`            // 来源ip
+	Method       string             `bson:"method"`        // 请求方法
+	Path         string             `bson:"path"`          // 请求路径
+	Desc         string             `bson:"desc"`          // 描述
+	Target       string             `bson:"target"`        // 目标实体id，即路由上的资源id，可为空
+	Outcome      string             `bson:"outcome"`       // 结果 success|failure
+	ErrorCode    int                `bson:"error_code"`    // 失败时的错误码
+	RequestId    string             `bson:"request_id"`    // 请求id
+	Changes      []modelbase.Change `bson:"changes"`       // 本次请求的数据变更，敏感字段已脱敏
+}
+
+func NewAuditLogDao() AuditLogDao {
+	d := AuditLogDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type AuditLogDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *AuditLogDao) GetCollectionName() string {
+	return CollectionAuditLog
+}
+
+// implement interface modelbase.ICollection
+func (d *AuditLogDao) ToBsonM(model interface{}) bson.M {
+	m := model.(AuditLog)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	CollectionAuthAct = "auth_act"
+
+	ColAuthActBitMark = "bit_mark"
+	ColAuthActName    = "name"
+)
+
+/*
+ * 权限动作
+ * uid与bit_mark相同
+ */
+type AuthAct struct {
+	modelbase.MetaModel `bson:",inline,flatten"`
+
+	BitMark int64  `bson:"bit_mark"` // 权限动作的二进制掩码，即权限集map的value中的一位
+	Name    string `bson:"name"`     // 显示名
+}
+
+func NewAuthActDao() AuthActDao {
+	d := AuthActDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type AuthActDao struct {
+	modelbase.MetaDao
+}
+
+// implement interface modelbase.ICollection
+func (d *AuthActDao) GetCollectionName() string {
+	return CollectionAuthAct
+}
+
+// implement interface modelbase.IGlobalCollection，各租户共享
+func (d *AuthActDao) IsGlobal() bool {
+	return true
+}
+
+// implement interface modelbase.ICollection
+func (d *AuthActDao) ToBsonM(model interface{}) bson.M {
+	m := model.(AuthAct)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	CollectionAuthObj = "auth_obj"
+
+	ColAuthObjBitMark  = "bit_mark"
+	ColAuthObjName     = "name"
+	ColAuthObjModule   = "module"
+	ColAuthObjSort     = "sort"
+	ColAuthObjPlatform = "platform"
+)
+
+/*
+ * 权限对象
+ * 账号中心的权限对象uid与bit_mark相同，其他平台的见AuthObjUid
+ */
+type AuthObj struct {
+	modelbase.MetaModel `bson:",inline,flatten"`
+
+	BitMark int64  `bson:"bit_mark"` // 权限对象的二进制掩码，即权限集map的key
+	Name    string `bson:"name"`     // 显示名
+	Module  string `bson:"module"`   // 所属模块，用于分组展示
+	Sort    int64  `bson:"sort"`     // 展示顺序，越小越靠前
+
+	Platform int64 `bson:"platform"` // 所属平台uid，0为账号中心本身
+}
+
+// 权限对象的uid：平台uid占高32位，bit_mark占低32位，账号中心的即为bit_mark
+func AuthObjUid(platform, bitMark int64) int64 {
+	return platform<<32 | bitMark
+}
+
+func NewAuthObjDao() AuthObjDao {
+	d := AuthObjDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type AuthObjDao struct {
+	modelbase.MetaDao
+}
+
+// implement interface modelbase.ICollection
+func (d *AuthObjDao) GetCollectionName() string {
+	return CollectionAuthObj
+}
+
+// implement interface modelbase.IGlobalCollection，各租户共享
+func (d *AuthObjDao) IsGlobal() bool {
+	return true
+}
+
+// implement interface modelbase.ICollection
+func (d *AuthObjDao) ToBsonM(model interface{}) bson.M {
+	m := model.(AuthObj)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
@@ -0,0 +1,121 @@
+package modelbase
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 物理删除、恢复时每批的记录数
+const archiveBatch = 1000
+
+/*
+ * 按链序号（加入哈希链之前的旧数据在最前，按_id）遍历租户内最早的一段记录，含逻辑删除的
+ * 只取链序号大于afterSeq（已归档的最后一条）的记录和旧数据
+ * 遇到创建时间不早于before的记录即停止，保证归档的是哈希链的前缀；limit为0时不限
+ */
+func (d *DataDao) ScanBefore(afterSeq int64, before time.Time, limit int64, fn func(doc bson.M) error) error {
+	filter := bson.M{"$or": []bson.M{
+		{ColChainSeq: bson.M{"$gt": afterSeq}},
+		{ColChainSeq: bson.M{"$in": []interface{}{0, nil}}},
+	}}
+	if !isGlobal(d.Coll) {
+		filter[ColTenant] = TenantFilter(d.Tenant)
+	}
+	opts := options.Find().SetSort(bson.D{
+		{Key: ColChainSeq, Value: 1},
+		{Key: ColId, Value: 1},
+	})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := d.GetCollection().Find(context.Background(), filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var doc bson.M
+		err = cursor.Decode(&doc)
+		if err != nil {
+			return err
+		}
+		createTime, ok := doc[ColCreateTime].(primitive.DateTime)
+		if !ok || !createTime.Time().Before(before) {
+			break
+		}
+		err = fn(doc)
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+/*
+ * 物理删除，只用于归档后清理已写入归档文件的记录
+ */
+func (d *DataDao) Remove(ids []primitive.ObjectID) (deletedCount int64, err error) {
+	for start := 0; start < len(ids); start += archiveBatch {
+		end := start + archiveBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		filter := bson.M{ColId: bson.M{"$in": ids[start:end]}}
+		if !isGlobal(d.Coll) {
+			filter[ColTenant] = TenantFilter(d.Tenant)
+		}
+		res, err := d.GetCollection().DeleteMany(context.Background(), filter)
+		if err != nil {
+			return deletedCount, err
+		}
+		deletedCount += res.DeletedCount
+	}
+	return deletedCount, nil
+}
+
+/*
+ * 物理删除链序号不大于seq的记录
+ * 用于清理已登记归档、但删除前进程退出而残留的记录，否则它们会一直挡在待归档记录的前面
+ */
+func (d *DataDao) RemoveChainedThrough(seq int64) (deletedCount int64, err error) {
+	filter := bson.M{ColChainSeq: bson.M{"$gt": 0, "$lte": seq}}
+	if !isGlobal(d.Coll) {
+		filter[ColTenant] = TenantFilter(d.Tenant)
+	}
+	res, err := d.GetCollection().DeleteMany(context.Background(), filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+/*
+ * 按_id原样写入文档（保留租户、哈希链等全部字段），已存在的覆盖，可重复执行
+ * 只用于从归档文件恢复
+ */
+func (d *DataDao) ReplaceDocs(docs []bson.M) error {
+	for start := 0; start < len(docs); start += archiveBatch {
+		end := start + archiveBatch
+		if end > len(docs) {
+			end = len(docs)
+		}
+		models := make([]mongo.WriteModel, 0, end-start)
+		for _, doc := range docs[start:end] {
+			models = append(models, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{ColId: doc[ColId]}).
+				SetReplacement(doc).
+				SetUpsert(true))
+		}
+		_, err := d.GetCollection().BulkWrite(context.Background(), models)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
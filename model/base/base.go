@@ -12,12 +12,64 @@ const (
 	ColUpdator    = "updator"
 	ColUpdateTime = "update_time"
 	ColIsDelete   = "is_delete"
+	ColTenant     = "tenant"
 
 	// meta collection
 	ColUid = "uid"
+
+	// uid计数器，每个meta collection一条记录，_id为collection名
+	CollectionCounter = "counter"
+	ColCounterSeq     = "seq"
+
+	// 默认租户：单租户部署时的全部数据，以及升级前没有租户字段的旧数据
+	TenantDefault int64 = 0
 )
 
 type ICollection interface {
 	GetCollectionName() string
 	ToBsonM(model interface{}) bson.M
 }
+
+/*
+ * 各租户共享、不做租户隔离的表实现该接口，如租户表本身、平台、权限对象登记表
+ */
+type IGlobalCollection interface {
+	IsGlobal() bool
+}
+
+func isGlobal(coll ICollection) bool {
+	g, ok := coll.(IGlobalCollection)
+	return ok && g.IsGlobal()
+}
+
+// 按租户筛选的条件，默认租户同时匹配没有租户字段的旧数据
+func TenantFilter(tenant int64) interface{} {
+	if tenant == TenantDefault {
+		return bson.M{"$in": bson.A{TenantDefault, nil}}
+	}
+	return tenant
+}
+
+/*
+ * 给查询条件补上逻辑删除和租户条件，调用方已指定的不覆盖
+ */
+func scopeFilter(coll ICollection, tenant int64, filter bson.M) bson.M {
+	if _, ok := filter[ColIsDelete]; !ok {
+		filter[ColIsDelete] = false
+	}
+	if _, ok := filter[ColTenant]; !ok && !isGlobal(coll) {
+		filter[ColTenant] = TenantFilter(tenant)
+	}
+	return filter
+}
+
+/*
+ * 给新增的文档补上逻辑删除和租户字段
+ */
+func scopeDoc(coll ICollection, tenant int64, doc bson.M) bson.M {
+	doc[ColIsDelete] = false
+	if !isGlobal(coll) {
+		doc[ColTenant] = tenant
+	}
+	return doc
+}
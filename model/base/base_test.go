@@ -0,0 +1,46 @@
+package modelbase
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type scopedColl struct{}
+
+func (c *scopedColl) GetCollectionName() string        { return "scoped" }
+func (c *scopedColl) ToBsonM(model interface{}) bson.M { return nil }
+
+type globalColl struct{ scopedColl }
+
+func (c *globalColl) IsGlobal() bool { return true }
+
+func TestScopeFilter(t *testing.T) {
+	cases := []struct {
+		coll   ICollection
+		tenant int64
+		filter bson.M
+		expect bson.M
+	}{
+		{&scopedColl{}, 3, bson.M{}, bson.M{ColIsDelete: false, ColTenant: int64(3)}},
+		{&scopedColl{}, TenantDefault, bson.M{}, bson.M{ColIsDelete: false, ColTenant: bson.M{"$in": bson.A{TenantDefault, nil}}}},
+		{&scopedColl{}, 3, bson.M{ColIsDelete: true, ColTenant: int64(5)}, bson.M{ColIsDelete: true, ColTenant: int64(5)}}, // 调用方已指定的不覆盖
+		{&globalColl{}, 3, bson.M{}, bson.M{ColIsDelete: false}},
+	}
+	for i, c := range cases {
+		got := scopeFilter(c.coll, c.tenant, c.filter)
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Fatalf("case %v: expect %v, got %v", i, c.expect, got)
+		}
+	}
+
+	doc := scopeDoc(&globalColl{}, 3, bson.M{ColTenant: int64(0)})
+	if doc[ColTenant] != int64(0) {
+		t.Fatalf("global doc should keep tenant, got %v", doc[ColTenant])
+	}
+	doc = scopeDoc(&scopedColl{}, 3, bson.M{ColTenant: int64(0)})
+	if doc[ColTenant] != int64(3) {
+		t.Fatalf("scoped doc should be written to tenant 3, got %v", doc[ColTenant])
+	}
+}
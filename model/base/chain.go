@@ -0,0 +1,299 @@
+package modelbase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ColChainSeq      = "chain_seq"
+	ColChainPrevHash = "prev_hash"
+	ColChainHash     = "hash"
+
+	// 链头记录在计数器表，_id为 {collection}:chain:{tenant}
+	colChainHeadHash = "hash"
+
+	// 并发新增时抢占链序号的最大重试次数，及首次重试前的等待时间（之后逐次翻倍并加随机抖动）
+	chainMaxRetry     = 10
+	chainRetryBackoff = 5 * time.Millisecond
+
+	// 哈希链断开的原因
+	ChainBrokenSeqGap     = "seq_gap"    // 序号不连续，中间的记录被物理删除
+	ChainBrokenPrevHash   = "prev_hash"  // 记录的前一条哈希与前一条记录不符
+	ChainBrokenHash       = "hash"       // 记录内容与哈希不符，已被修改（含逻辑删除）
+	ChainBrokenTruncated  = "truncated"  // 链尾的记录被物理删除
+	ChainBrokenCheckpoint = "checkpoint" // 记录与签名检查点不符
+	ChainBrokenSign       = "sign"       // 检查点的签名无效，检查点被伪造或修改
+)
+
+var ErrChainConflict = errors.New("too many concurrent chain appends")
+
+/*
+ * 哈希链字段，需要防篡改的表内嵌该结构，并通过DataDao.AddChained新增
+ */
+type ChainModel struct {
+	ChainSeq int64  `json:"chain_seq" bson:"chain_seq"` // 租户内的链序号，从1开始；0)加入哈希链之前的旧数据
+	PrevHash string `json:"prev_hash" bson:"prev_hash"` // 前一条记录的哈希，第一条为空
+	Hash     string `json:"hash" bson:"hash"`           // 本条记录除hash外全部字段的sha256，含prev_hash
+}
+
+type chainHead struct {
+	Seq  int64  `bson:"seq"`
+	Hash string `bson:"hash"`
+}
+
+// 哈希链断开的位置
+type ChainBreak struct {
+	Seq    int64              `json:"seq"`    // 断开处的链序号
+	Id     primitive.ObjectID `json:"id"`     // 断开处的记录id，记录已删除时为空
+	Reason string             `json:"reason"` // 原因，见ChainBroken*
+}
+
+// 哈希链校验结果
+type ChainResult struct {
+	Count    int64       // 校验的记录数
+	LastSeq  int64       // 最后一条记录的链序号
+	LastHash string      // 最后一条记录的哈希
+	Broken   *ChainBreak // 第一处断开，nil)完整
+}
+
+/*
+ * 记录的哈希：先经过一次bson编解码，与从数据库读回的类型一致；json按key排序，与字段顺序无关
+ */
+func ChainHash(doc bson.M) (string, error) {
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	var m bson.M
+	err = bson.Unmarshal(b, &m)
+	if err != nil {
+		return "", err
+	}
+	delete(m, ColChainHash)
+	j, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(j)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (d *DataDao) chainHeadId() string {
+	return d.Coll.GetCollectionName() + ":chain:" + strconv.FormatInt(d.Tenant, 10)
+}
+
+// 已创建链序号唯一索引的表
+var chainIndexed sync.Map
+
+/*
+ * 租户内链序号唯一，并发新增时只有一条能占用同一序号；旧数据的链序号为0，不参与
+ */
+func (d *DataDao) ensureChainIndex() error {
+	name := d.Coll.GetCollectionName()
+	if _, ok := chainIndexed.Load(name); ok {
+		return nil
+	}
+	err := d.CreateIndex([]mongo.IndexModel{{
+		Keys: bson.D{{Key: ColTenant, Value: 1}, {Key: ColChainSeq, Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{ColChainSeq: bson.M{"$gt": 0}}),
+	}})
+	if err != nil {
+		return err
+	}
+	chainIndexed.Store(name, true)
+	return nil
+}
+
+/*
+ * 链尾：最后一条记录与链头中序号较大的一个
+ * 链头只会落后于记录（写入记录后进程退出），链头超前说明链尾被删除，沿用链头使断开处可被校验发现
+ */
+func (d *DataDao) chainTail() (seq int64, hash string, err error) {
+	seq, hash, err = d.ChainHead()
+	if err != nil {
+		return
+	}
+	filter := bson.M{ColChainSeq: bson.M{"$gt": seq}}
+	if !isGlobal(d.Coll) {
+		filter[ColTenant] = TenantFilter(d.Tenant)
+	}
+	var last bson.M
+	opts := options.FindOne().SetSort(bson.M{ColChainSeq: -1})
+	err = d.GetCollection().FindOne(context.Background(), filter, opts).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return seq, hash, nil
+	} else if err != nil {
+		return
+	}
+	seq, _ = last[ColChainSeq].(int64)
+	hash, _ = last[ColChainHash].(string)
+	return seq, hash, nil
+}
+
+/*
+ * 新增到租户内哈希链的末尾
+ * 先写入记录，由链序号的唯一索引保证不分叉，并发新增时退避重试；再推进链头，链头只用于发现链尾被删除
+ */
+func (d *DataDao) AddChained(meId primitive.ObjectID, model interface{}) (primitive.ObjectID, error) {
+	err := d.ensureChainIndex()
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	counter := d.GetDatabase().Collection(CollectionCounter)
+	headId := d.chainHeadId()
+	backoff := chainRetryBackoff
+	for i := 0; i < chainMaxRetry; i++ {
+		if i > 0 {
+			time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff))))
+			backoff *= 2
+		}
+		seq, prevHash, err := d.chainTail()
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+
+		doc := d.newDoc(meId, model)
+		id := primitive.NewObjectID()
+		doc[ColId] = id
+		doc[ColChainSeq] = seq + 1
+		doc[ColChainPrevHash] = prevHash
+		hash, err := ChainHash(doc)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		doc[ColChainHash] = hash
+
+		// 序号已被其他请求占用
+		_, err = d.GetCollection().InsertOne(context.Background(), doc)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		} else if err != nil {
+			return primitive.NilObjectID, err
+		}
+		d.recordCreate([]primitive.ObjectID{id}, []bson.M{doc})
+
+		// 链头已被更新的记录推进时，upsert会因_id重复失败，忽略即可
+		_, err = counter.UpdateOne(context.Background(),
+			bson.M{ColId: headId, ColCounterSeq: bson.M{"$lt": seq + 1}},
+			bson.M{"$set": bson.M{ColCounterSeq: seq + 1, colChainHeadHash: hash}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			log.Errorf("fail to move chain head %v to %v: %v", headId, seq+1, err)
+		}
+		return id, nil
+	}
+	return primitive.NilObjectID, ErrChainConflict
+}
+
+/*
+ * 按链序号遍历租户内的哈希链，返回第一处断开
+ * fromSeq、fromHash为已归档的最后一条记录，从其后一条开始校验；没有归档时为0和空
+ * checkpoints为已验证签名的检查点（链序号 -> 哈希），记录须与之一致
+ * 逻辑删除的记录也在链上，逻辑删除本身会改变记录内容
+ */
+func (d *DataDao) VerifyChain(fromSeq int64, fromHash string, checkpoints map[int64]string) (ChainResult, error) {
+	result := ChainResult{LastSeq: fromSeq, LastHash: fromHash}
+	filter := bson.M{ColChainSeq: bson.M{"$gt": fromSeq}}
+	if !isGlobal(d.Coll) {
+		filter[ColTenant] = TenantFilter(d.Tenant)
+	}
+	opts := options.Find().SetSort(bson.M{ColChainSeq: 1})
+	cursor, err := d.GetCollection().Find(context.Background(), filter, opts)
+	if err != nil {
+		return result, err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var doc bson.M
+		err = cursor.Decode(&doc)
+		if err != nil {
+			return result, err
+		}
+		brk, err := CheckChainLink(result.LastSeq, result.LastHash, doc, checkpoints)
+		if err != nil {
+			return result, err
+		}
+		if brk != nil {
+			result.Broken = brk
+			return result, nil
+		}
+		result.Count++
+		result.LastSeq, _ = doc[ColChainSeq].(int64)
+		result.LastHash, _ = doc[ColChainHash].(string)
+	}
+	if err = cursor.Err(); err != nil {
+		return result, err
+	}
+
+	// 链尾被删除：链头或检查点的序号超出最后一条记录
+	maxSeq, _, err := d.ChainHead()
+	if err != nil {
+		return result, err
+	}
+	for seq := range checkpoints {
+		if seq > maxSeq {
+			maxSeq = seq
+		}
+	}
+	if maxSeq > result.LastSeq {
+		result.Broken = &ChainBreak{Seq: result.LastSeq + 1, Reason: ChainBrokenTruncated}
+	}
+	return result, nil
+}
+
+/*
+ * 校验一条记录与前一条的链接，返回断开处，nil)完整；checkpoints可为nil
+ */
+func CheckChainLink(prevSeq int64, prevHash string, doc bson.M, checkpoints map[int64]string) (*ChainBreak, error) {
+	seq, _ := doc[ColChainSeq].(int64)
+	id, _ := doc[ColId].(primitive.ObjectID)
+	if seq != prevSeq+1 {
+		return &ChainBreak{Seq: prevSeq + 1, Reason: ChainBrokenSeqGap}, nil
+	}
+	if doc[ColChainPrevHash] != prevHash {
+		return &ChainBreak{Seq: seq, Id: id, Reason: ChainBrokenPrevHash}, nil
+	}
+	hash, err := ChainHash(doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc[ColChainHash] != hash {
+		return &ChainBreak{Seq: seq, Id: id, Reason: ChainBrokenHash}, nil
+	}
+	if expect, ok := checkpoints[seq]; ok && expect != hash {
+		return &ChainBreak{Seq: seq, Id: id, Reason: ChainBrokenCheckpoint}, nil
+	}
+	return nil, nil
+}
+
+/*
+ * 租户内哈希链最后一条记录的序号和哈希，用于生成检查点
+ */
+func (d *DataDao) ChainHead() (seq int64, hash string, err error) {
+	var head chainHead
+	err = d.GetDatabase().Collection(CollectionCounter).FindOne(context.Background(), bson.M{ColId: d.chainHeadId()}).Decode(&head)
+	if err == mongo.ErrNoDocuments {
+		return 0, "", nil
+	} else if err != nil {
+		return
+	}
+	return head.Seq, head.Hash, nil
+}
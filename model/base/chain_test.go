@@ -0,0 +1,114 @@
+package modelbase
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 写入时的文档与从数据库读回的文档哈希一致
+func TestChainHashRoundTrip(t *testing.T) {
+	doc := bson.M{
+		ColId:            primitive.NewObjectID(),
+		ColCreateTime:    time.Now(),
+		ColChainSeq:      int64(1),
+		ColChainPrevHash: "",
+		"code":           3,
+		"changes":        []Change{{Collection: "user", Fields: []FieldChange{{Field: "name", Before: "a", After: "b"}}}},
+	}
+	hash, err := ChainHash(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored bson.M
+	err = bson.Unmarshal(b, &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored[ColChainHash] = hash
+	got, err := ChainHash(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != hash {
+		t.Fatalf("expect %v, got %v", hash, got)
+	}
+}
+
+// 归档文件（extended json）恢复后的记录哈希不变，仍可校验
+func TestChainHashExtJSON(t *testing.T) {
+	doc := bson.M{
+		ColId:            primitive.NewObjectID(),
+		ColCreateTime:    time.Now(),
+		ColTenant:        int64(3),
+		ColChainSeq:      int64(7),
+		ColChainPrevHash: "abc",
+		"code":           int32(3),
+		"changes":        bson.A{bson.M{"field": "name", "before": nil, "after": 1.5}},
+	}
+	hash, err := ChainHash(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored bson.M
+	err = bson.UnmarshalExtJSON(line, true, &restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ChainHash(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != hash {
+		t.Fatalf("expect %v, got %v", hash, got)
+	}
+}
+
+func TestCheckChainLink(t *testing.T) {
+	newDoc := func(seq int64, prevHash string) bson.M {
+		doc := bson.M{ColId: primitive.NewObjectID(), ColChainSeq: seq, ColChainPrevHash: prevHash, "desc": "x"}
+		doc[ColChainHash], _ = ChainHash(doc)
+		return doc
+	}
+	first := newDoc(1, "")
+	firstHash := first[ColChainHash].(string)
+
+	cases := []struct {
+		prevSeq     int64
+		prevHash    string
+		doc         bson.M
+		checkpoints map[int64]string
+		expect      string
+	}{
+		{0, "", first, nil, ""},
+		{0, "", first, map[int64]string{1: firstHash}, ""},
+		{1, firstHash, newDoc(2, firstHash), nil, ""},
+		{1, firstHash, newDoc(3, firstHash), nil, ChainBrokenSeqGap},
+		{1, firstHash, newDoc(2, "other"), nil, ChainBrokenPrevHash},
+		{0, "", bson.M{ColChainSeq: int64(1), ColChainPrevHash: "", ColChainHash: firstHash, "desc": "y"}, nil, ChainBrokenHash},
+		{0, "", first, map[int64]string{1: "other"}, ChainBrokenCheckpoint},
+	}
+	for i, c := range cases {
+		brk, err := CheckChainLink(c.prevSeq, c.prevHash, c.doc, c.checkpoints)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reason := ""
+		if brk != nil {
+			reason = brk.Reason
+		}
+		if reason != c.expect {
+			t.Fatalf("case %v: expect %q, got %q", i, c.expect, reason)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package modelbase
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// 变更动作
+	ChangeActionCreate = "create"
+	ChangeActionUpdate = "update"
+	ChangeActionDelete = "delete"
+
+	// 敏感字段脱敏后的值
+	RedactedValue = "******"
+)
+
+/*
+ * 含敏感字段（如密码哈希）的表实现该接口，变更记录里这些字段只体现有变化，不记录值
+ */
+type ISensitiveCollection interface {
+	SensitiveFields() []string
+}
+
+// 一个字段的变更前后值，新增时Before为空，删除时After为空
+type FieldChange struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+// 一条记录的变更
+type Change struct {
+	Collection string             `json:"collection" bson:"collection"` // 表名
+	Id         primitive.ObjectID `json:"id" bson:"id"`                 // 记录id
+	Action     string             `json:"action" bson:"action"`         // 动作 create|update|delete
+	Fields     []FieldChange      `json:"fields" bson:"fields"`         // 变更的字段，删除时为删除前的全部字段
+}
+
+/*
+ * 一次请求内dao的全部新增、编辑、删除，供审计使用
+ * 由service按操作人设置到dao，为nil时不记录
+ */
+type ChangeLog struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+func (l *ChangeLog) Changes() []Change {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Change(nil), l.changes...)
+}
+
+func (l *ChangeLog) add(changes ...Change) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.changes = append(l.changes, changes...)
+}
+
+// 不计入变更的公共字段，删除由动作体现
+var changeSkipFields = map[string]bool{
+	ColId:         true,
+	ColCreator:    true,
+	ColCreateTime: true,
+	ColUpdator:    true,
+	ColUpdateTime: true,
+	ColIsDelete:   true,
+	ColTenant:     true,
+}
+
+/*
+ * 对比两个文档的字段，敏感字段脱敏
+ */
+func diffDoc(coll ICollection, before, after bson.M) []FieldChange {
+	sensitive := make(map[string]bool)
+	if s, ok := coll.(ISensitiveCollection); ok {
+		for _, field := range s.SensitiveFields() {
+			sensitive[field] = true
+		}
+	}
+
+	fields := make([]string, 0, len(before)+len(after))
+	for field := range before {
+		fields = append(fields, field)
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := make([]FieldChange, 0)
+	for _, field := range fields {
+		if changeSkipFields[field] {
+			continue
+		}
+		b, a := before[field], after[field]
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+		if sensitive[field] {
+			b, a = redact(b), redact(a)
+		}
+		changes = append(changes, FieldChange{Field: field, Before: b, After: a})
+	}
+	return changes
+}
+
+func redact(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return RedactedValue
+}
+
+/*
+ * 按编辑前后的文档生成变更，is_delete由false变为true的记为删除
+ */
+func updateChanges(coll ICollection, before, after []bson.M) []Change {
+	afterMp := make(map[primitive.ObjectID]bson.M, len(after))
+	for _, doc := range after {
+		if id, ok := doc[ColId].(primitive.ObjectID); ok {
+			afterMp[id] = doc
+		}
+	}
+
+	changes := make([]Change, 0, len(before))
+	for _, b := range before {
+		id, _ := b[ColId].(primitive.ObjectID)
+		a, ok := afterMp[id]
+		if !ok {
+			continue
+		}
+		change := Change{Collection: coll.GetCollectionName(), Id: id, Action: ChangeActionUpdate}
+		if b[ColIsDelete] != true && a[ColIsDelete] == true {
+			change.Action = ChangeActionDelete
+			change.Fields = diffDoc(coll, b, bson.M{})
+		} else {
+			change.Fields = diffDoc(coll, b, a)
+			if len(change.Fields) == 0 && b[ColIsDelete] == a[ColIsDelete] {
+				continue
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
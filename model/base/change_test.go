@@ -0,0 +1,41 @@
+package modelbase
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type sensitiveColl struct{ scopedColl }
+
+func (c *sensitiveColl) SensitiveFields() []string { return []string{"password"} }
+
+func TestUpdateChanges(t *testing.T) {
+	id1, id2, id3 := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	before := []bson.M{
+		{ColId: id1, ColIsDelete: false, "name": "a", "password": "hash1", ColUpdateTime: 1},
+		{ColId: id2, ColIsDelete: false, "name": "b", "password": "hash2"},
+		{ColId: id3, ColIsDelete: false, "name": "c"},
+	}
+	after := []bson.M{
+		{ColId: id1, ColIsDelete: false, "name": "a2", "password": "hash3", ColUpdateTime: 2},
+		{ColId: id2, ColIsDelete: true, "name": "b", "password": "hash2"},
+		{ColId: id3, ColIsDelete: false, "name": "c"}, // 没有变化的不记录
+	}
+	got := updateChanges(&sensitiveColl{}, before, after)
+	expect := []Change{
+		{Collection: "scoped", Id: id1, Action: ChangeActionUpdate, Fields: []FieldChange{
+			{Field: "name", Before: "a", After: "a2"},
+			{Field: "password", Before: RedactedValue, After: RedactedValue},
+		}},
+		{Collection: "scoped", Id: id2, Action: ChangeActionDelete, Fields: []FieldChange{
+			{Field: "name", Before: "b"},
+			{Field: "password", Before: RedactedValue},
+		}},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %+v, got %+v", expect, got)
+	}
+}
@@ -23,11 +23,18 @@ type DataModel struct {
 	Updator    primitive.ObjectID `json:"updator" bson:"updator"`         // 更新者
 	UpdateTime time.Time          `json:"update_time" bson:"update_time"` // 更新时间
 	IsDelete   bool               `json:"is_delete" bson:"is_delete"`     // 是否已逻辑删除
+	Tenant     int64              `json:"tenant" bson:"tenant"`           // 所属租户，由dao写入
 }
 
+/*
+ * 查询、更新自动带上逻辑删除和当前租户条件，新增自动写入当前租户
+ * 设置了Changes时，新增、编辑、删除的字段变更记录到Changes
+ */
 type DataDao struct {
 	mongodao.Dao
-	Coll ICollection
+	Coll    ICollection
+	Tenant  int64      // 当前租户，由service按操作人设置
+	Changes *ChangeLog // 变更记录，由service按操作人设置
 }
 
 func (d *DataDao) GetCollection() *mongo.Collection {
@@ -36,9 +43,7 @@ func (d *DataDao) GetCollection() *mongo.Collection {
 
 // 参数model传指针
 func (d *DataDao) Get(model interface{}, filter bson.M) error {
-	if _, ok := filter[ColIsDelete]; !ok {
-		filter[ColIsDelete] = false
-	}
+	filter = scopeFilter(d.Coll, d.Tenant, filter)
 	log.Debugf("filter: %+v", filter)
 
 	result := d.GetCollection().FindOne(context.Background(), filter)
@@ -55,9 +60,7 @@ func (d *DataDao) Get(model interface{}, filter bson.M) error {
 
 // 参数models传数组指针
 func (d *DataDao) Gets(models interface{}, filter bson.M, opts ...*options.FindOptions) error {
-	if _, ok := filter[ColIsDelete]; !ok {
-		filter[ColIsDelete] = false
-	}
+	filter = scopeFilter(d.Coll, d.Tenant, filter)
 	log.Debugf("filter: %+v", filter)
 
 	cursor, err := d.GetCollection().Find(context.Background(), filter, opts...)
@@ -74,10 +77,10 @@ func (d *DataDao) Gets(models interface{}, filter bson.M, opts ...*options.FindO
 
 // 参数model传指针
 func (d *DataDao) GetById(model interface{}, id primitive.ObjectID) error {
-	filter := bson.M{
+	filter := scopeFilter(d.Coll, d.Tenant, bson.M{
 		ColId:       id,
 		ColIsDelete: false,
-	}
+	})
 	log.Debugf("filter: %+v", filter)
 	result := d.GetCollection().FindOne(context.Background(), filter)
 	if result.Err() != nil {
@@ -102,9 +105,7 @@ func (d *DataDao) GetByIds(models interface{}, ids []primitive.ObjectID) error {
 }
 
 func (d *DataDao) GetCount(filter bson.M) (int64, error) {
-	if _, ok := filter[ColIsDelete]; !ok {
-		filter[ColIsDelete] = false
-	}
+	filter = scopeFilter(d.Coll, d.Tenant, filter)
 	log.Debugf("filter: %+v", filter)
 	count, err := d.GetCollection().CountDocuments(context.Background(), filter)
 	if err != nil {
@@ -113,33 +114,33 @@ func (d *DataDao) GetCount(filter bson.M) (int64, error) {
 	return count, nil
 }
 
-func (d *DataDao) Add(meId primitive.ObjectID, model interface{}) (primitive.ObjectID, error) {
-	doc := d.Coll.ToBsonM(model)
-	doc[ColIsDelete] = false
+// 新增的文档：补上逻辑删除、租户、创建者和创建时间
+func (d *DataDao) newDoc(meId primitive.ObjectID, model interface{}) bson.M {
+	doc := scopeDoc(d.Coll, d.Tenant, d.Coll.ToBsonM(model))
 	doc[ColCreateTime] = time.Now()
 	if meId != primitive.NilObjectID {
 		doc[ColCreator] = meId
 	}
+	return doc
+}
+
+func (d *DataDao) Add(meId primitive.ObjectID, model interface{}) (primitive.ObjectID, error) {
+	doc := d.newDoc(meId, model)
 	log.Debugf("doc: %+v", model)
 
 	result, err := d.GetCollection().InsertOne(context.Background(), doc)
 	if err != nil {
 		return primitive.NilObjectID, err
 	}
-	return result.InsertedID.(primitive.ObjectID), nil
+	id := result.InsertedID.(primitive.ObjectID)
+	d.recordCreate([]primitive.ObjectID{id}, []bson.M{doc})
+	return id, nil
 }
 
 func (d *DataDao) AddMany(meId primitive.ObjectID, models []interface{}) ([]primitive.ObjectID, error) {
 	docs := make([]interface{}, 0, len(models))
 	for _, model := range models {
-		doc := d.Coll.ToBsonM(model)
-
-		doc[ColIsDelete] = false
-		doc[ColCreateTime] = time.Now()
-		if meId != primitive.NilObjectID {
-			doc[ColCreator] = meId
-		}
-		docs = append(docs, doc)
+		docs = append(docs, d.newDoc(meId, model))
 	}
 
 	result, err := d.GetCollection().InsertMany(context.Background(), docs)
@@ -147,16 +148,17 @@ func (d *DataDao) AddMany(meId primitive.ObjectID, models []interface{}) ([]prim
 		return nil, err
 	}
 	ids := make([]primitive.ObjectID, 0, len(result.InsertedIDs))
-	for _, id := range result.InsertedIDs {
+	docMs := make([]bson.M, 0, len(docs))
+	for i, id := range result.InsertedIDs {
 		ids = append(ids, id.(primitive.ObjectID))
+		docMs = append(docMs, docs[i].(bson.M))
 	}
+	d.recordCreate(ids, docMs)
 	return ids, nil
 }
 
 func (d *DataDao) Update(meId primitive.ObjectID, filter bson.M, update bson.M) (modifiedCount int64, err error) {
-	if _, ok := filter[ColIsDelete]; !ok {
-		filter[ColIsDelete] = false
-	}
+	filter = scopeFilter(d.Coll, d.Tenant, filter)
 	if meId != primitive.NilObjectID {
 		if _, ok := update["$set"]; !ok {
 			update["$set"] = bson.M{}
@@ -165,6 +167,14 @@ func (d *DataDao) Update(meId primitive.ObjectID, filter bson.M, update bson.M)
 		update["$set"].(bson.M)[ColUpdateTime] = time.Now()
 	}
 
+	var before []bson.M
+	if d.Changes != nil {
+		before, err = d.findDocs(filter)
+		if err != nil {
+			return
+		}
+	}
+
 	res, err := d.GetCollection().UpdateMany(
 		context.Background(),
 		filter,
@@ -174,6 +184,22 @@ func (d *DataDao) Update(meId primitive.ObjectID, filter bson.M, update bson.M)
 		return
 	}
 	modifiedCount = res.ModifiedCount
+
+	if d.Changes != nil && len(before) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(before))
+		for _, doc := range before {
+			if id, ok := doc[ColId].(primitive.ObjectID); ok {
+				ids = append(ids, id)
+			}
+		}
+		// 编辑后的文档可能已不满足原条件（如逻辑删除），按id查
+		after, ferr := d.findDocs(bson.M{ColId: bson.M{"$in": ids}})
+		if ferr != nil {
+			log.Errorf("fail to get updated docs for change log: %v", ferr)
+			return
+		}
+		d.Changes.add(updateChanges(d.Coll, before, after)...)
+	}
 	return
 }
 
@@ -234,6 +260,63 @@ func (d *DataDao) IncreaseByIds(meId primitive.ObjectID, ids []primitive.ObjectI
 	return
 }
 
+/*
+ * 聚合查询，参数results传数组指针
+ * 注意：pipeline需要自行$match逻辑删除字段和租户，租户条件见MatchTenant
+ */
+func (d *DataDao) Aggregate(results interface{}, pipeline interface{}) error {
+	log.Debugf("pipeline: %+v", pipeline)
+
+	cursor, err := d.GetCollection().Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return err
+	}
+	err = cursor.All(context.Background(), results)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 聚合查询$match阶段的租户条件
+func (d *DataDao) MatchTenant(match bson.M) bson.M {
+	if !isGlobal(d.Coll) {
+		match[ColTenant] = TenantFilter(d.Tenant)
+	}
+	return match
+}
+
+// 不附加逻辑删除和租户条件的原始查询，用于记录变更
+func (d *DataDao) findDocs(filter bson.M) ([]bson.M, error) {
+	cursor, err := d.GetCollection().Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]bson.M, 0)
+	err = cursor.All(context.Background(), &docs)
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (d *DataDao) recordCreate(ids []primitive.ObjectID, docs []bson.M) {
+	if d.Changes == nil {
+		return
+	}
+	changes := make([]Change, 0, len(ids))
+	for i, id := range ids {
+		changes = append(changes, Change{
+			Collection: d.Coll.GetCollectionName(),
+			Id:         id,
+			Action:     ChangeActionCreate,
+			Fields:     diffDoc(d.Coll, bson.M{}, docs[i]),
+		})
+	}
+	d.Changes.add(changes...)
+}
+
 // 创建索引
 func (d *DataDao) CreateIndex(index []mongo.IndexModel) error {
 	_, err := d.GetCollection().Indexes().CreateMany(context.Background(), index)
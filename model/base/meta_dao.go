@@ -17,11 +17,17 @@ import (
 type MetaModel struct {
 	Uid      int64 `json:"uid" bson:"uid"`             // meta表唯一标识
 	IsDelete bool  `json:"is_delete" bson:"is_delete"` // 是否已逻辑删除
+	Tenant   int64 `json:"tenant" bson:"tenant"`       // 所属租户，由dao写入；全局表不使用
 }
 
+/*
+ * 查询、更新自动带上逻辑删除和当前租户条件，新增自动写入当前租户
+ * 全局表（实现IGlobalCollection）不做租户隔离
+ */
 type MetaDao struct {
 	mongodao.Dao
-	Coll ICollection
+	Coll   ICollection
+	Tenant int64 // 当前租户，由service按操作人设置
 }
 
 func (d *MetaDao) GetCollection() *mongo.Collection {
@@ -30,9 +36,7 @@ func (d *MetaDao) GetCollection() *mongo.Collection {
 
 // 参数model传指针
 func (d *MetaDao) Get(model interface{}, filter bson.M) error {
-	if _, ok := filter[ColIsDelete]; !ok {
-		filter[ColIsDelete] = false
-	}
+	filter = scopeFilter(d.Coll, d.Tenant, filter)
 	log.Debugf("filter: %+v", filter)
 
 	result := d.GetCollection().FindOne(context.Background(), filter)
@@ -49,9 +53,7 @@ func (d *MetaDao) Get(model interface{}, filter bson.M) error {
 
 // 参数models传数组指针
 func (d *MetaDao) Gets(models interface{}, filter bson.M, opts ...*options.FindOptions) error {
-	if _, ok := filter[ColIsDelete]; !ok {
-		filter[ColIsDelete] = false
-	}
+	filter = scopeFilter(d.Coll, d.Tenant, filter)
 	log.Debugf("filter: %+v", filter)
 
 	cursor, err := d.GetCollection().Find(context.Background(), filter, opts...)
@@ -68,10 +70,10 @@ func (d *MetaDao) Gets(models interface{}, filter bson.M, opts ...*options.FindO
 
 // 参数model传指针
 func (d *MetaDao) GetByUid(model interface{}, uid int64) error {
-	filter := bson.M{
+	filter := scopeFilter(d.Coll, d.Tenant, bson.M{
 		ColUid:      uid,
 		ColIsDelete: false,
-	}
+	})
 	log.Debugf("filter: %+v", filter)
 
 	result := d.GetCollection().FindOne(context.Background(), filter)
@@ -97,9 +99,7 @@ func (d *MetaDao) GetByUids(models interface{}, uids []int64) error {
 }
 
 func (d *MetaDao) GetCount(filter bson.M) (int64, error) {
-	if _, ok := filter[ColIsDelete]; !ok {
-		filter[ColIsDelete] = false
-	}
+	filter = scopeFilter(d.Coll, d.Tenant, filter)
 	log.Debugf("filter: %+v", filter)
 	count, err := d.GetCollection().CountDocuments(context.Background(), filter)
 	if err != nil {
@@ -108,9 +108,28 @@ func (d *MetaDao) GetCount(filter bson.M) (int64, error) {
 	return count, nil
 }
 
+/*
+ * 原子地生成下一个uid，从1开始
+ * 适用于uid没有业务含义的meta表
+ */
+func (d *MetaDao) NextUid() (uid int64, err error) {
+	filter := bson.M{ColId: d.Coll.GetCollectionName()}
+	update := bson.M{"$inc": bson.M{ColCounterSeq: int64(1)}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err = d.GetDatabase().Collection(CollectionCounter).FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&counter)
+	if err != nil {
+		return
+	}
+	uid = counter.Seq
+	return
+}
+
 func (d *MetaDao) Add(model interface{}) (uid int64, err error) {
-	doc := d.Coll.ToBsonM(model)
-	doc[ColIsDelete] = false
+	doc := scopeDoc(d.Coll, d.Tenant, d.Coll.ToBsonM(model))
 	log.Debugf("doc: %+v", model)
 	uid = doc[ColUid].(int64)
 
@@ -125,8 +144,7 @@ func (d *MetaDao) AddMany(models []interface{}) (uids []int64, err error) {
 	docs := make([]interface{}, 0, len(models))
 	uids = make([]int64, 0, len(models))
 	for _, model := range models {
-		doc := d.Coll.ToBsonM(model)
-		doc[ColIsDelete] = false
+		doc := scopeDoc(d.Coll, d.Tenant, d.Coll.ToBsonM(model))
 		docs = append(docs, doc)
 		uids = append(uids, doc[ColUid].(int64))
 	}
@@ -139,9 +157,7 @@ func (d *MetaDao) AddMany(models []interface{}) (uids []int64, err error) {
 }
 
 func (d *MetaDao) Update(filter bson.M, update bson.M) (modifiedCount int64, err error) {
-	if _, ok := filter[ColIsDelete]; !ok {
-		filter[ColIsDelete] = false
-	}
+	filter = scopeFilter(d.Coll, d.Tenant, filter)
 
 	res, err := d.GetCollection().UpdateMany(
 		context.Background(),
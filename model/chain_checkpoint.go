@@ -0,0 +1,52 @@
+package model
+
+import (
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	CollectionChainCheckpoint = "chain_checkpoint"
+
+	ColChainCheckpointCollection = "collection"
+	ColChainCheckpointSeq        = "seq"
+	ColChainCheckpointHash       = "hash"
+	ColChainCheckpointSign       = "sign"
+)
+
+/*
+ * 哈希链的签名检查点：定期用会话私钥对链尾的序号和哈希签名
+ * 即使整条链被重新计算，也无法伪造检查点
+ */
+type ChainCheckpoint struct {
+	modelbase.DataModel `bson:",inline,flatten"`
+
+	Collection string `bson:"collection"` // 哈希链所在的表名
+	Seq        int64  `bson:"seq"`        // 链尾的链序号
+	Hash       string `bson:"hash"`       // 链尾记录的哈希
+	Sign       string `bson:"sign"`       // 签名，base64
+}
+
+func NewChainCheckpointDao() ChainCheckpointDao {
+	d := ChainCheckpointDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type ChainCheckpointDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *ChainCheckpointDao) GetCollectionName() string {
+	return CollectionChainCheckpoint
+}
+
+// implement interface modelbase.ICollection
+func (d *ChainCheckpointDao) ToBsonM(model interface{}) bson.M {
+	m := model.(ChainCheckpoint)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
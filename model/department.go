@@ -0,0 +1,49 @@
+package model
+
+import (
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionDepartment = "department"
+
+	ColDepartmentName      = "name"
+	ColDepartmentParent    = "parent"
+	ColDepartmentAncestors = "ancestors"
+	ColDepartmentSort      = "sort"
+)
+
+type Department struct {
+	modelbase.DataModel `bson:",inline,flatten"`
+
+	Name      string               `bson:"name"`      // 部门名
+	Parent    primitive.ObjectID   `bson:"parent"`    // 上级部门id，顶级部门为空
+	Ancestors []primitive.ObjectID `bson:"ancestors"` // 从顶级部门到上级部门的id路径
+	Sort      int64                `bson:"sort"`      // 同级排序，越小越靠前
+}
+
+func NewDepartmentDao() DepartmentDao {
+	d := DepartmentDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type DepartmentDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *DepartmentDao) GetCollectionName() string {
+	return CollectionDepartment
+}
+
+// implement interface modelbase.ICollection
+func (d *DepartmentDao) ToBsonM(model interface{}) bson.M {
+	m := model.(Department)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
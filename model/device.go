@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionDevice = "device"
+
+	ColDeviceUser      = "user"
+	ColDeviceDeviceId  = "device_id"
+	ColDeviceUserAgent = "user_agent"
+	ColDeviceIp        = "ip"
+	ColDeviceFirstSeen = "first_seen"
+	ColDeviceLastSeen  = "last_seen"
+)
+
+// 用户的受信任设备
+type Device struct {
+	modelbase.DataModel `bson:",inline,flatten"`
+
+	User      primitive.ObjectID `bson:"user"`       // 用户id
+	DeviceId  string             `bson:"device_id"`  // 设备标识（随机生成，签名后下发到客户端）
+	UserAgent string             `bson:"user_agent"` // 最近一次登录的User-Agent
+	Ip        string             `bson:"ip"`         // 最近一次登录的ip
+	FirstSeen time.Time          `bson:"first_seen"` // 首次登录时间
+	LastSeen  time.Time          `bson:"last_seen"`  // 最近登录时间
+}
+
+func NewDeviceDao() DeviceDao {
+	d := DeviceDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type DeviceDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *DeviceDao) GetCollectionName() string {
+	return CollectionDevice
+}
+
+// implement interface modelbase.ICollection
+func (d *DeviceDao) ToBsonM(model interface{}) bson.M {
+	m := model.(Device)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
+
+// implement interface modelbase.ISensitiveCollection，设备标识相当于凭证，审计时不记录
+func (d *DeviceDao) SensitiveFields() []string {
+	return []string{ColDeviceDeviceId}
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionGrant = "grant"
+
+	ColGrantUser       = "user"
+	ColGrantAuths      = "auths"
+	ColGrantRoles      = "roles"
+	ColGrantStartTime  = "start_time"
+	ColGrantExpireTime = "expire_time"
+	ColGrantReason     = "reason"
+	ColGrantActivated  = "activated"
+)
+
+// 用户的临时授权，到期后自动撤销
+type Grant struct {
+	modelbase.DataModel `bson:",inline,flatten"`
+
+	User       primitive.ObjectID   `bson:"user"`        // 用户id
+	Auths      map[int64]int64      `bson:"auths"`       // 额外的权限集
+	Roles      []primitive.ObjectID `bson:"roles"`       // 额外的角色id
+	StartTime  time.Time            `bson:"start_time"`  // 生效时间
+	ExpireTime time.Time            `bson:"expire_time"` // 到期时间
+	Reason     string               `bson:"reason"`      // 授权原因
+	Activated  bool                 `bson:"activated"`   // 是否已生效并刷新过用户会话
+}
+
+func NewGrantDao() GrantDao {
+	d := GrantDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type GrantDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *GrantDao) GetCollectionName() string {
+	return CollectionGrant
+}
+
+// implement interface modelbase.ICollection
+func (d *GrantDao) ToBsonM(model interface{}) bson.M {
+	m := model.(Grant)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionOperationRecord = "operation_record"
+
+	ColOperationRecordUser       = "user"
+	ColOperationRecordDepartment = "department"
+	ColOperationRecordModule     = "module"
+	ColOperationRecordService    = "service"
+	ColOperationRecordRequestId  = "request_id"
+)
+
+/*
+ * 操作记录，由业务服务通过rpc写入
+ * 操作时间即create_time；记录在租户内的哈希链上
+ */
+type OperationRecord struct {
+	modelbase.DataModel  `bson:",inline,flatten"`
+	modelbase.ChainModel `bson:",inline,flatten"` // 哈希链，防止记录被篡改或删除
+
+	User        primitive.ObjectID `bson:"user"`         // 操作人id
+	UserAccount string             `bson:"user_account"` // 操作人账号
+	UserName    string             `bson:"user_name"`    // 操作人姓名
+	Department  primitive.ObjectID `bson:"department"`   // 操作时操作人所在的部门id
+	Module      int64              `bson:"module"`       // 模块id
+	Desc        string             `bson:"desc"`         // 操作描述
+	Service     string             `bson:"service"`      // 来源服务名
+	RequestId   string             `bson:"request_id"`   // 请求id
+}
+
+func NewOperationRecordDao() OperationRecordDao {
+	d := OperationRecordDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type OperationRecordDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *OperationRecordDao) GetCollectionName() string {
+	return CollectionOperationRecord
+}
+
+// implement interface modelbase.ICollection
+func (d *OperationRecordDao) ToBsonM(model interface{}) bson.M {
+	m := model.(OperationRecord)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
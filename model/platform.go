@@ -0,0 +1,67 @@
+package model
+
+import (
+	"time"
+
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	CollectionPlatform = "platform"
+
+	ColPlatformName       = "name"
+	ColPlatformPriority   = "priority"
+	ColPlatformSysPreset  = "sys_preset"
+	ColPlatformCreateTime = "create_time"
+)
+
+/*
+ * 平台（数据来源），即接入账号中心的应用
+ * uid由计数器生成
+ */
+type Platform struct {
+	modelbase.MetaModel `bson:",inline,flatten"`
+
+	Name       string    `bson:"name"`        // 显示名
+	Priority   int32     `bson:"priority"`    // 优先级权重(1-100)，越高越优先
+	SysPreset  bool      `bson:"sys_preset"`  // 是否系统预设，预设的不能删除
+	CreateTime time.Time `bson:"create_time"` // 创建时间
+}
+
+// 按所属平台筛选的条件，旧数据没有platform字段，视为账号中心
+func PlatformFilter(platform int64) interface{} {
+	if platform == 0 {
+		return bson.M{"$in": bson.A{int64(0), nil}}
+	}
+	return platform
+}
+
+func NewPlatformDao() PlatformDao {
+	d := PlatformDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type PlatformDao struct {
+	modelbase.MetaDao
+}
+
+// implement interface modelbase.ICollection
+func (d *PlatformDao) GetCollectionName() string {
+	return CollectionPlatform
+}
+
+// implement interface modelbase.IGlobalCollection，各租户共享
+func (d *PlatformDao) IsGlobal() bool {
+	return true
+}
+
+// implement interface modelbase.ICollection
+func (d *PlatformDao) ToBsonM(model interface{}) bson.M {
+	m := model.(Platform)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
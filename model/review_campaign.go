@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionReviewCampaign = "review_campaign"
+
+	ColReviewCampaignName        = "name"
+	ColReviewCampaignDepartments = "departments"
+	ColReviewCampaignRoles       = "roles"
+	ColReviewCampaignDeadline    = "deadline"
+	ColReviewCampaignOnExpire    = "on_expire"
+	ColReviewCampaignStatus      = "status"
+	ColReviewCampaignCloseTime   = "close_time"
+)
+
+// 访问审查活动：按部门或角色圈定范围，为每个用户-角色生成一条审查项
+type ReviewCampaign struct {
+	modelbase.DataModel `bson:",inline,flatten"`
+
+	Name        string               `bson:"name"`        // 活动名
+	Departments []primitive.ObjectID `bson:"departments"` // 审查的部门id（含下级部门），为空则不按部门限制
+	Roles       []primitive.ObjectID `bson:"roles"`       // 审查的角色id，为空则不按角色限制
+	Deadline    time.Time            `bson:"deadline"`    // 截止时间
+	OnExpire    string               `bson:"on_expire"`   // 到期未审查的处理方式 revoke|escalate
+	Status      string               `bson:"status"`      // 状态 active|closed
+	CloseTime   time.Time            `bson:"close_time"`  // 全部审查项处理完毕的时间
+}
+
+func NewReviewCampaignDao() ReviewCampaignDao {
+	d := ReviewCampaignDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type ReviewCampaignDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *ReviewCampaignDao) GetCollectionName() string {
+	return CollectionReviewCampaign
+}
+
+// implement interface modelbase.ICollection
+func (d *ReviewCampaignDao) ToBsonM(model interface{}) bson.M {
+	m := model.(ReviewCampaign)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"time"
+
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionReviewItem = "review_item"
+
+	ColReviewItemCampaign   = "campaign"
+	ColReviewItemUser       = "user"
+	ColReviewItemRole       = "role"
+	ColReviewItemDepartment = "department"
+	ColReviewItemReviewers  = "reviewers"
+	ColReviewItemDeadline   = "deadline"
+	ColReviewItemEscalated  = "escalated"
+	ColReviewItemDecision   = "decision"
+	ColReviewItemReviewer   = "reviewer"
+	ColReviewItemComment    = "comment"
+	ColReviewItemReviewTime = "review_time"
+)
+
+// 访问审查项：确认某个用户是否仍需要某个角色
+type ReviewItem struct {
+	modelbase.DataModel `bson:",inline,flatten"`
+
+	Campaign   primitive.ObjectID   `bson:"campaign"`    // 审查活动id
+	User       primitive.ObjectID   `bson:"user"`        // 用户id
+	Role       primitive.ObjectID   `bson:"role"`        // 角色id
+	Department primitive.ObjectID   `bson:"department"`  // 生成审查项时用户所在部门id
+	Reviewers  []primitive.ObjectID `bson:"reviewers"`   // 审查人id
+	Deadline   time.Time            `bson:"deadline"`    // 截止时间，上报后顺延
+	Escalated  bool                 `bson:"escalated"`   // 是否已因超期上报
+	Decision   string               `bson:"decision"`    // 结论，为空表示待审查 keep|revoke|auto_revoke
+	Reviewer   primitive.ObjectID   `bson:"reviewer"`    // 实际审查人id，自动撤销为空
+	Comment    string               `bson:"comment"`     // 备注
+	ReviewTime time.Time            `bson:"review_time"` // 审查时间
+}
+
+func NewReviewItemDao() ReviewItemDao {
+	d := ReviewItemDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type ReviewItemDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *ReviewItemDao) GetCollectionName() string {
+	return CollectionReviewItem
+}
+
+// implement interface modelbase.ICollection
+func (d *ReviewItemDao) ToBsonM(model interface{}) bson.M {
+	m := model.(ReviewItem)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionRole = "role"
+
+	ColRoleName                 = "name"
+	ColRoleAuths                = "auths"
+	ColRoleDataScope            = "data_scope"
+	ColRoleDataScopeDepartments = "data_scope_departments"
+	ColRoleParents              = "parents"
+	ColRolePlatform             = "platform"
+)
+
+type Role struct {
+	modelbase.DataModel `bson:",inline,flatten"`
+
+	Name  string          `bson:"name"`  // 角色名
+	Auths map[int64]int64 `bson:"auths"` // 权限集 map的key是权限对象的二进制掩码，value是权限动作的二进制掩码取或
+
+	DataScope            string               `bson:"data_scope"`             // 数据范围 self|department|subtree|custom|all
+	DataScopeDepartments []primitive.ObjectID `bson:"data_scope_departments"` // 数据范围为custom时可访问的部门id
+
+	Parents []primitive.ObjectID `bson:"parents"` // 继承的上级角色，权限集、数据范围取并集（可传递）
+
+	Platform int64 `bson:"platform"` // 所属平台uid，0为账号中心本身；权限集只在该平台内有效
+}
+
+func NewRoleDao() RoleDao {
+	d := RoleDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type RoleDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *RoleDao) GetCollectionName() string {
+	return CollectionRole
+}
+
+// implement interface modelbase.ICollection
+func (d *RoleDao) ToBsonM(model interface{}) bson.M {
+	m := model.(Role)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionSodConstraint = "sod_constraint"
+
+	ColSodConstraintName  = "name"
+	ColSodConstraintRoles = "roles"
+	ColSodConstraintAuths = "auths"
+)
+
+// 职责分离约束：列出的角色和权限互斥，同一用户最多只能拥有其中一项
+type SodConstraint struct {
+	modelbase.DataModel `bson:",inline,flatten"`
+
+	Name        string               `bson:"name"`        // 约束名
+	Description string               `bson:"description"` // 说明
+	Roles       []primitive.ObjectID `bson:"roles"`       // 互斥的角色id，含继承得到的角色
+	Auths       []SodAuth            `bson:"auths"`       // 互斥的权限，按合并继承角色后的权限集判定
+}
+
+// 互斥的一项权限，须同时拥有Act中的全部权限动作才算拥有
+type SodAuth struct {
+	Platform int64 `bson:"platform"` // 所属平台id，0为账号中心
+	Obj      int64 `bson:"obj"`      // 权限对象的二进制掩码
+	Act      int64 `bson:"act"`      // 权限动作的二进制掩码取或
+}
+
+func NewSodConstraintDao() SodConstraintDao {
+	d := SodConstraintDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type SodConstraintDao struct {
+	modelbase.DataDao
+}
+
+// implement interface modelbase.ICollection
+func (d *SodConstraintDao) GetCollectionName() string {
+	return CollectionSodConstraint
+}
+
+// implement interface modelbase.ICollection
+func (d *SodConstraintDao) ToBsonM(model interface{}) bson.M {
+	m := model.(SodConstraint)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"time"
+
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/naamancurtis/mongo-go-struct-to-bson/mapper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	CollectionTenant = "tenant"
+
+	ColTenantName       = "name"
+	ColTenantCreateTime = "create_time"
+)
+
+/*
+ * 租户，即独立的机构，各租户的用户、角色、部门等数据互相隔离
+ * uid由计数器生成，从1开始；0为默认租户，不在表中
+ */
+type Tenant struct {
+	modelbase.MetaModel `bson:",inline,flatten"`
+
+	Name       string    `bson:"name"`        // 显示名
+	CreateTime time.Time `bson:"create_time"` // 创建时间
+}
+
+func NewTenantDao() TenantDao {
+	d := TenantDao{}
+	d.Coll = &d
+	return d
+}
+
+// implement interface modelbase.ICollection
+type TenantDao struct {
+	modelbase.MetaDao
+}
+
+// implement interface modelbase.ICollection
+func (d *TenantDao) GetCollectionName() string {
+	return CollectionTenant
+}
+
+// implement interface modelbase.IGlobalCollection，各租户共享
+func (d *TenantDao) IsGlobal() bool {
+	return true
+}
+
+// implement interface modelbase.ICollection
+func (d *TenantDao) ToBsonM(model interface{}) bson.M {
+	m := model.(Tenant)
+	result := mapper.ConvertStructToBSONMap(m, nil)
+	return result
+}
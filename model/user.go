@@ -15,7 +15,8 @@ const (
 	ColUserName          = "name"
 	ColUserPasswordReset = "password_reset"
 	ColUserDepartment    = "department"
-	ColUserRole          = "role"
+	ColUserRole          = "role" // 旧版本的单个角色id，已迁移到roles
+	ColUserRoles         = "roles"
 	ColUserPoliceNumber  = "police_number"
 	ColUserPhone         = "phone"
 )
@@ -23,14 +24,14 @@ const (
 type User struct {
 	modelbase.DataModel `bson:",inline,flatten"` // data类 inline,flatten（必须有） 字段将使嵌套结构中的所有字段在地图中上移一级，以位于更高的级别
 
-	Account       string             `bson:"account"`        // 登录账号
-	Password      string             `bson:"password"`       // 登录密码
-	Name          string             `bson:"name"`           // 显示名
-	PasswordReset bool               `bson:"password_reset"` // 是否已重设密码 ture)已重设 false)未
-	Department    primitive.ObjectID `bson:"department"`     // 部门id
-	Role          primitive.ObjectID `bson:"role"`           // 角色id
-	PoliceNumber  string             `bson:"police_number"`  // 警号
-	Phone         string             `bson:"phone"`          // 手机号
+	Account       string               `bson:"account"`        // 登录账号
+	Password      string               `bson:"password"`       // 登录密码
+	Name          string               `bson:"name"`           // 显示名
+	PasswordReset bool                 `bson:"password_reset"` // 是否已重设密码 ture)已重设 false)未
+	Department    primitive.ObjectID   `bson:"department"`     // 部门id
+	Roles         []primitive.ObjectID `bson:"roles"`          // 角色id，权限取并集
+	PoliceNumber  string               `bson:"police_number"`  // 警号
+	Phone         string               `bson:"phone"`          // 手机号
 }
 
 func NewUserDao() UserDao {
@@ -55,3 +56,8 @@ func (d *UserDao) ToBsonM(model interface{}) bson.M {
 	result := mapper.ConvertStructToBSONMap(m, nil)
 	return result
 }
+
+// implement interface modelbase.ISensitiveCollection，审计时不记录密码哈希
+func (d *UserDao) SensitiveFields() []string {
+	return []string{ColUserPassword}
+}
@@ -0,0 +1,435 @@
+package service
+
+import (
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// 审批单状态
+	AccessRequestPending   = "pending"   // 待审批
+	AccessRequestApproving = "approving" // 已批准，正在给用户加上角色或临时授权
+	AccessRequestApproved  = "approved"  // 已批准
+	AccessRequestRejected  = "rejected"  // 已驳回
+	AccessRequestCancelled = "cancelled" // 已撤回
+
+	// 审批单处理动作
+	AccessRequestActSubmit  = "submit"
+	AccessRequestActApprove = "approve"
+	AccessRequestActReject  = "reject"
+	AccessRequestActCancel  = "cancel"
+
+	EventAccessRequest       = "access_request"        // 有新的审批单待处理
+	EventAccessRequestResult = "access_request_result" // 审批单已处理
+)
+
+type AccessRequestConfig struct {
+	ApproverRole string `mapstructure:"approver_role"` // 审批人角色名
+}
+
+var accessRequestCfg AccessRequestConfig
+
+func SetAccessRequestConfig(c AccessRequestConfig) {
+	accessRequestCfg = c
+}
+
+type AccessRequest struct {
+	ME  ME
+	Dao model.AccessRequestDao
+}
+
+func NewAccessRequestService(me *ME) AccessRequest {
+	s := AccessRequest{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewAccessRequestDao()
+	s.ME.bindDao(&s.Dao.DataDao)
+	return s
+}
+
+/*
+ * 获取审批单，只有申请人和审批人可以查看
+ */
+func (s *AccessRequest) GetById(id primitive.ObjectID) (model.AccessRequest, *radarerror.CommonError) {
+	var request model.AccessRequest
+	err := s.Dao.GetById(&request, id)
+	if err == mongo.ErrNoDocuments {
+		log.Errorf("access request not found: %v", id.Hex())
+		return request, &radarerror.AccessRequestNotFound
+	} else if err != nil {
+		log.Errorf("fail to get access request: %v", err)
+		return request, &radarerror.InternalServerError
+	}
+	if request.User != s.ME.Id && !isApprover(request, s.ME.Id) {
+		log.Errorf("neither requester nor approver: %v, %v", s.ME.Id.Hex(), id.Hex())
+		return request, &radarerror.ExceedAuthority
+	}
+	return request, nil
+}
+
+type FilterAccessRequest struct {
+	Mine   bool    // 我提交的
+	Todo   bool    // 待我审批的
+	Status *string // 状态
+}
+
+func (s *AccessRequest) ConvertFilter(filter FilterAccessRequest) bson.M {
+	mFilter := bson.M{}
+	if filter.Mine {
+		mFilter[model.ColAccessRequestUser] = s.ME.Id
+	}
+	if filter.Todo {
+		mFilter[model.ColAccessRequestApprovers] = s.ME.Id
+		mFilter[model.ColAccessRequestStatus] = AccessRequestPending
+	}
+	if filter.Status != nil {
+		mFilter[model.ColAccessRequestStatus] = *filter.Status
+	}
+	// 只能查到与自己相关的
+	if !filter.Mine && !filter.Todo {
+		mFilter["$or"] = []bson.M{
+			{model.ColAccessRequestUser: s.ME.Id},
+			{model.ColAccessRequestApprovers: s.ME.Id},
+		}
+	}
+	return mFilter
+}
+
+/*
+ * 根据筛选条件分页获取审批单
+ */
+func (s *AccessRequest) Gets(page, pageSize int64, filter FilterAccessRequest) ([]model.AccessRequest, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	if pageSize > 0 {
+		opts.SetLimit(pageSize)
+	}
+	opts.SetSkip(page * pageSize)
+	opts.SetSort(bson.M{modelbase.ColId: -1})
+	requests := make([]model.AccessRequest, 0)
+	err := s.Dao.Gets(&requests, s.ConvertFilter(filter), opts)
+	if err != nil {
+		log.Errorf("fail to get access requests: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return requests, nil
+}
+
+/*
+ * 根据筛选条件获取结果集总数
+ */
+func (s *AccessRequest) GetCount(filter FilterAccessRequest) (int64, *radarerror.CommonError) {
+	count, err := s.Dao.GetCount(s.ConvertFilter(filter))
+	if err != nil {
+		log.Errorf("fail to get access request count: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	return count, nil
+}
+
+/*
+ * 提交申请
+ * 申请的权限集只能临时授予，必须有到期时间；申请角色不带到期时间则长期有效
+ */
+func (s *AccessRequest) Submit(request model.AccessRequest) (primitive.ObjectID, *radarerror.CommonError) {
+	var id primitive.ObjectID
+	if len(request.Roles) == 0 && len(request.Auths) == 0 {
+		log.Errorf("empty access request")
+		return id, &radarerror.InvalidArgs
+	}
+	now := time.Now()
+	if len(request.Auths) > 0 && request.ExpireTime.IsZero() {
+		log.Errorf("auths request without expire time")
+		return id, &radarerror.InvalidGrantTime
+	}
+	if !request.ExpireTime.IsZero() && !request.ExpireTime.After(now) {
+		log.Errorf("invalid expire time: %v", request.ExpireTime)
+		return id, &radarerror.InvalidGrantTime
+	}
+
+	var cerr *radarerror.CommonError
+	if len(request.Roles) > 0 {
+		svcRole := NewRoleService(&s.ME)
+		request.Roles, cerr = svcRole.CheckIds(request.Roles)
+		if cerr != nil {
+			return id, cerr
+		}
+	}
+
+	svcUser := NewUserService(SystemME(s.ME.Tenant))
+	user, cerr := svcUser.GetById(s.ME.Id)
+	if cerr != nil {
+		return id, cerr
+	}
+	request.Approvers, cerr = s.resolveApprovers(user)
+	if cerr != nil {
+		return id, cerr
+	}
+
+	request.User = s.ME.Id
+	request.Status = AccessRequestPending
+	request.Steps = []model.AccessRequestStep{{
+		Action:   AccessRequestActSubmit,
+		Operator: s.ME.Id,
+		Comment:  request.Justification,
+		Time:     now,
+	}}
+	id, err := s.Dao.Add(s.ME.Id, request)
+	if err != nil {
+		log.Errorf("fail to add access request: %v", err)
+		return id, &radarerror.InternalServerError
+	}
+
+	for _, approver := range request.Approvers {
+		PublishEvent(EventAccessRequest, approver, map[string]string{
+			"id":   id.Hex(),
+			"user": s.ME.Id.Hex(),
+		})
+	}
+	return id, nil
+}
+
+/*
+ * 批准：以审批人身份把申请的角色加到用户上，或者按到期时间新增临时授权
+ * 审批权限来自流程，不受审批人自身数据范围的限制
+ */
+func (s *AccessRequest) Approve(id primitive.ObjectID, comment string) *radarerror.CommonError {
+	request, cerr := s.getPendingForApprover(id)
+	if cerr != nil {
+		return cerr
+	}
+
+	// 先占用审批单再变更用户，并发审批、撤回时只有一方成功
+	cerr = s.transit(request.Id, AccessRequestPending, AccessRequestApproving)
+	if cerr != nil {
+		return cerr
+	}
+	cerr = s.apply(request)
+	if cerr != nil {
+		if cerr := s.transit(request.Id, AccessRequestApproving, AccessRequestPending); cerr != nil {
+			log.Errorf("fail to release access request: %v", request.Id.Hex())
+		}
+		return cerr
+	}
+	return s.finish(request, AccessRequestApproving, AccessRequestApproved, AccessRequestActApprove, comment)
+}
+
+/*
+ * 以审批人身份把申请的角色加到用户上，或者按到期时间新增临时授权
+ */
+func (s *AccessRequest) apply(request model.AccessRequest) *radarerror.CommonError {
+	actor := ME{Id: s.ME.Id, Tenant: s.ME.Tenant, DataScope: DataScopeAll, Changes: s.ME.Changes}
+	if request.ExpireTime.IsZero() {
+		svcUser := NewUserService(&actor)
+		cerr := svcUser.AddRoles(request.User, request.Roles)
+		if cerr != nil {
+			return cerr
+		}
+	} else {
+		svcGrant := NewGrantService(&actor)
+		_, cerr := svcGrant.add(model.Grant{
+			User:       request.User,
+			Auths:      request.Auths,
+			Roles:      request.Roles,
+			ExpireTime: request.ExpireTime,
+			Reason:     "access request " + request.Id.Hex() + ": " + request.Justification,
+		})
+		if cerr != nil {
+			return cerr
+		}
+	}
+	return nil
+}
+
+/*
+ * 驳回
+ */
+func (s *AccessRequest) Reject(id primitive.ObjectID, comment string) *radarerror.CommonError {
+	request, cerr := s.getPendingForApprover(id)
+	if cerr != nil {
+		return cerr
+	}
+	return s.finish(request, AccessRequestPending, AccessRequestRejected, AccessRequestActReject, comment)
+}
+
+/*
+ * 申请人撤回
+ */
+func (s *AccessRequest) Cancel(id primitive.ObjectID, comment string) *radarerror.CommonError {
+	request, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+	if request.User != s.ME.Id {
+		log.Errorf("not requester: %v, %v", s.ME.Id.Hex(), id.Hex())
+		return &radarerror.ExceedAuthority
+	}
+	if request.Status != AccessRequestPending {
+		log.Errorf("access request processed: %v", id.Hex())
+		return &radarerror.AccessRequestProcessed
+	}
+	return s.finish(request, AccessRequestPending, AccessRequestCancelled, AccessRequestActCancel, comment)
+}
+
+func (s *AccessRequest) getPendingForApprover(id primitive.ObjectID) (model.AccessRequest, *radarerror.CommonError) {
+	request, cerr := s.GetById(id)
+	if cerr != nil {
+		return request, cerr
+	}
+	if !isApprover(request, s.ME.Id) {
+		log.Errorf("not approver: %v, %v", s.ME.Id.Hex(), id.Hex())
+		return request, &radarerror.ExceedAuthority
+	}
+	if request.Status != AccessRequestPending {
+		log.Errorf("access request processed: %v", id.Hex())
+		return request, &radarerror.AccessRequestProcessed
+	}
+	return request, nil
+}
+
+/*
+ * 审批单从from状态改为to状态，状态已被其他请求改变时返回AccessRequestProcessed
+ */
+func (s *AccessRequest) transit(id primitive.ObjectID, from, to string) *radarerror.CommonError {
+	filter := bson.M{
+		modelbase.ColId:              id,
+		model.ColAccessRequestStatus: from,
+	}
+	modified, err := s.Dao.Update(s.ME.Id, filter, bson.M{"$set": bson.M{model.ColAccessRequestStatus: to}})
+	if err != nil {
+		log.Errorf("fail to update access request: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if modified == 0 {
+		log.Errorf("access request processed: %v", id.Hex())
+		return &radarerror.AccessRequestProcessed
+	}
+	return nil
+}
+
+/*
+ * 结束审批单并记录处理步骤，只有处于from状态的才能结束
+ */
+func (s *AccessRequest) finish(request model.AccessRequest, from, status, action, comment string) *radarerror.CommonError {
+	filter := bson.M{
+		modelbase.ColId:              request.Id,
+		model.ColAccessRequestStatus: from,
+	}
+	update := bson.M{
+		"$set": bson.M{model.ColAccessRequestStatus: status},
+		"$push": bson.M{model.ColAccessRequestSteps: model.AccessRequestStep{
+			Action:   action,
+			Operator: s.ME.Id,
+			Comment:  comment,
+			Time:     time.Now(),
+		}},
+	}
+	modified, err := s.Dao.Update(s.ME.Id, filter, update)
+	if err != nil {
+		log.Errorf("fail to update access request: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if modified == 0 {
+		log.Errorf("access request processed: %v", request.Id.Hex())
+		return &radarerror.AccessRequestProcessed
+	}
+
+	if action != AccessRequestActCancel {
+		PublishEvent(EventAccessRequestResult, request.User, map[string]string{
+			"id":     request.Id.Hex(),
+			"status": status,
+		})
+	}
+	return nil
+}
+
+/*
+ * 确定审批人
+ */
+func (s *AccessRequest) resolveApprovers(user model.User) ([]primitive.ObjectID, *radarerror.CommonError) {
+	approvers, cerr := findDepartmentRoleHolders(s.ME.Tenant, accessRequestCfg.ApproverRole, user)
+	if cerr != nil {
+		return nil, cerr
+	}
+	if len(approvers) == 0 {
+		log.Errorf("no approver for user: %v", user.Id.Hex())
+		return nil, &radarerror.NoApprover
+	}
+	return approvers, nil
+}
+
+/*
+ * 从用户所在部门逐级向上，取最近一级拥有指定角色的用户（不含用户本人）；
+ * 部门链上都没有时取所有拥有该角色的用户
+ */
+func findDepartmentRoleHolders(tenant int64, roleName string, user model.User) ([]primitive.ObjectID, *radarerror.CommonError) {
+	svcRole := NewRoleService(SystemME(tenant))
+	role, cerr := svcRole.GetByName(roleName)
+	if cerr == &radarerror.RoleNotFound {
+		log.Errorf("role not found: %v", roleName)
+		return nil, nil
+	} else if cerr != nil {
+		return nil, cerr
+	}
+
+	var chain []primitive.ObjectID
+	if user.Department != primitive.NilObjectID {
+		svcDepartment := NewDepartmentService(SystemME(tenant))
+		department, cerr := svcDepartment.GetById(user.Department)
+		if cerr != nil && cerr != &radarerror.DepartmentNotFound {
+			return nil, cerr
+		}
+		if cerr == nil {
+			chain = departmentChain(department)
+		}
+	}
+
+	svcUser := NewUserService(SystemME(tenant))
+	for i := 0; i <= len(chain); i++ {
+		filter := FilterUser{Role: &role.Id}
+		if i < len(chain) {
+			filter.Department = &chain[i]
+		}
+		users, cerr := svcUser.Gets(0, 0, filter)
+		if cerr != nil {
+			return nil, cerr
+		}
+		var holders []primitive.ObjectID
+		for _, u := range users {
+			if u.Id != user.Id {
+				holders = append(holders, u.Id)
+			}
+		}
+		if len(holders) > 0 {
+			return holders, nil
+		}
+	}
+	return nil, nil
+}
+
+// 从部门本身逐级向上到顶级部门的id
+func departmentChain(department model.Department) []primitive.ObjectID {
+	chain := make([]primitive.ObjectID, 0, len(department.Ancestors)+1)
+	chain = append(chain, department.Id)
+	for i := len(department.Ancestors) - 1; i >= 0; i-- {
+		chain = append(chain, department.Ancestors[i])
+	}
+	return chain
+}
+
+func isApprover(request model.AccessRequest, id primitive.ObjectID) bool {
+	for _, approver := range request.Approvers {
+		if approver == id {
+			return true
+		}
+	}
+	return false
+}
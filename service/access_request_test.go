@@ -0,0 +1,91 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAccessRequestConvertFilter(t *testing.T) {
+	me := primitive.NewObjectID()
+	s := AccessRequest{ME: ME{Id: me}}
+	approved := AccessRequestApproved
+	related := []bson.M{
+		{model.ColAccessRequestUser: me},
+		{model.ColAccessRequestApprovers: me},
+	}
+
+	cases := []struct {
+		filter FilterAccessRequest
+		expect bson.M
+	}{
+		{FilterAccessRequest{}, bson.M{"$or": related}},
+		{FilterAccessRequest{Mine: true}, bson.M{model.ColAccessRequestUser: me}},
+		{FilterAccessRequest{Todo: true}, bson.M{
+			model.ColAccessRequestApprovers: me,
+			model.ColAccessRequestStatus:    AccessRequestPending,
+		}},
+		{FilterAccessRequest{Status: &approved}, bson.M{
+			model.ColAccessRequestStatus: approved,
+			"$or":                        related,
+		}},
+		{FilterAccessRequest{Mine: true, Status: &approved}, bson.M{
+			model.ColAccessRequestUser:   me,
+			model.ColAccessRequestStatus: approved,
+		}},
+	}
+	for i, c := range cases {
+		got := s.ConvertFilter(c.filter)
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Fatalf("case %v: expect %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestDepartmentChain(t *testing.T) {
+	root, mid, leaf := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	cases := []struct {
+		department model.Department
+		expect     []primitive.ObjectID
+	}{
+		{model.Department{DataModel: modelbase.DataModel{Id: root}}, []primitive.ObjectID{root}},
+		{model.Department{DataModel: modelbase.DataModel{Id: mid}, Ancestors: []primitive.ObjectID{root}}, []primitive.ObjectID{mid, root}},
+		{model.Department{DataModel: modelbase.DataModel{Id: leaf}, Ancestors: []primitive.ObjectID{root, mid}}, []primitive.ObjectID{leaf, mid, root}},
+	}
+	for i, c := range cases {
+		got := departmentChain(c.department)
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Fatalf("case %v: expect %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestMergeGrants(t *testing.T) {
+	roleA, roleB := primitive.NewObjectID(), primitive.NewObjectID()
+	grants := []model.Grant{
+		{Auths: map[int64]int64{19: 1}, Roles: []primitive.ObjectID{roleA}},
+		{Auths: map[int64]int64{19: 2, 20: 4}, Roles: []primitive.ObjectID{roleB}},
+	}
+
+	cases := []struct {
+		platform int64
+		auths    map[int64]int64
+	}{
+		{0, map[int64]int64{18: 1, 19: 1 | 2, 20: 4}},
+		{2, map[int64]int64{18: 1}}, // 其他平台的会话只取附加的角色
+	}
+	for i, c := range cases {
+		me := ME{Platform: c.platform, AuthMp: map[int64]int64{18: 1}}
+		roles := mergeGrants(&me, grants)
+		if !reflect.DeepEqual(roles, []primitive.ObjectID{roleA, roleB}) {
+			t.Fatalf("case %v: unexpected roles %v", i, roles)
+		}
+		if !reflect.DeepEqual(me.AuthMp, c.auths) {
+			t.Fatalf("case %v: expect %v, got %v", i, c.auths, me.AuthMp)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/SeeJson/account/util/jwt"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// 归档文件旁的清单文件后缀
+	ArchiveManifestSuffix = ".manifest.json"
+
+	// 归档文件单行的最大长度
+	archiveMaxLine = 16 * 1024 * 1024
+)
+
+// 一个表的保留策略
+type ArchivePolicy struct {
+	Collection    string `mapstructure:"collection"`     // 表名 audit_log|operation_record
+	RetentionDays int    `mapstructure:"retention_days"` // 保留天数，更早的记录归档后从数据库删除；0)不归档
+}
+
+type ArchiveConfig struct {
+	Dir           string          `mapstructure:"dir"`            // 归档文件目录，按租户分子目录
+	CheckInterval int             `mapstructure:"check_interval"` // 检查过期记录的间隔，单位：秒
+	BatchSize     int64           `mapstructure:"batch_size"`     // 每个归档文件的最大记录数，0)不限
+	Policies      []ArchivePolicy `mapstructure:"policies"`       // 各表的保留策略
+}
+
+var archiveCfg ArchiveConfig
+
+func SetArchiveConfig(c ArchiveConfig) {
+	archiveCfg = c
+}
+
+var errArchiveChainBroken = errors.New("chain broken in archived records")
+
+/*
+ * 归档文件旁的清单，恢复时据此校验签名和文件摘要
+ */
+type ArchiveManifest struct {
+	Collection string `json:"collection"` // 归档的表名
+	Tenant     int64  `json:"tenant"`     // 租户uid
+	File       string `json:"file"`       // 归档文件名
+	Count      int64  `json:"count"`      // 记录数
+	FirstSeq   int64  `json:"first_seq"`  // 第一条记录的链序号
+	LastSeq    int64  `json:"last_seq"`   // 最后一条记录的链序号
+	LastHash   string `json:"last_hash"`  // 最后一条记录的哈希
+	Before     int64  `json:"before"`     // 归档的是创建时间早于该时间戳的记录
+	Sha256     string `json:"sha256"`     // 归档文件的sha256
+	Sign       string `json:"sign"`       // 签名，base64
+}
+
+func (m ArchiveManifest) signData() []byte {
+	return []byte(fmt.Sprintf("%v:%v:%v:%v:%v:%v:%v:%v:%v",
+		m.Collection, m.Tenant, m.File, m.Count, m.FirstSeq, m.LastSeq, m.LastHash, m.Before, m.Sha256))
+}
+
+/*
+ * 审计日志、操作记录的归档：过期记录写入压缩、签名的jsonl文件后从数据库删除
+ */
+type Archive struct {
+	ME  ME
+	Dao model.ArchiveDao
+}
+
+func NewArchiveService(me *ME) Archive {
+	s := Archive{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewArchiveDao()
+	s.Dao.Tenant = s.ME.Tenant
+	return s
+}
+
+// 可以归档的表
+func archiveDao(collection string, tenant int64) (*modelbase.DataDao, bool) {
+	switch collection {
+	case model.CollectionAuditLog:
+		d := model.NewAuditLogDao()
+		d.Tenant = tenant
+		return &d.DataDao, true
+	case model.CollectionOperationRecord:
+		d := model.NewOperationRecordDao()
+		d.Tenant = tenant
+		return &d.DataDao, true
+	}
+	return nil, false
+}
+
+/*
+ * 按保留策略归档本租户的过期记录，分批写入归档文件，直到没有过期记录
+ */
+func (s *Archive) Run(policy ArchivePolicy) *radarerror.CommonError {
+	if policy.RetentionDays <= 0 {
+		return nil
+	}
+	dao, ok := archiveDao(policy.Collection, s.ME.Tenant)
+	if !ok {
+		log.Errorf("collection cannot be archived: %v", policy.Collection)
+		return &radarerror.InvalidArgs
+	}
+	before := time.Now().AddDate(0, 0, -policy.RetentionDays)
+	for {
+		count, cerr := s.archiveBatch(dao, before)
+		if cerr != nil {
+			return cerr
+		}
+		if count == 0 || archiveCfg.BatchSize <= 0 || count < archiveCfg.BatchSize {
+			return nil
+		}
+	}
+}
+
+/*
+ * 最后一个归档的哈希链衔接点，没有归档时为0和空
+ * 归档登记的签名无效时返回断开处
+ */
+func (s *Archive) lastAnchor(collection string) (int64, string, *modelbase.ChainBreak, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	opts.SetSort(bson.M{model.ColArchiveLastSeq: -1})
+	opts.SetLimit(1)
+	var archives []model.Archive
+	err := s.Dao.Gets(&archives, bson.M{model.ColArchiveCollection: collection}, opts)
+	if err != nil {
+		log.Errorf("fail to get archives: %v", err)
+		return 0, "", nil, &radarerror.InternalServerError
+	}
+	if len(archives) == 0 {
+		return 0, "", nil, nil
+	}
+	archive := archives[0]
+	manifest := archiveManifest(s.ME.Tenant, archive)
+	err = jwt.VerifySign(manifest.signData(), archive.Sign)
+	if err != nil {
+		log.Errorf("invalid archive sign: %v %v: %v", collection, archive.File, err)
+		return 0, "", &modelbase.ChainBreak{Seq: archive.LastSeq, Reason: modelbase.ChainBrokenSign}, nil
+	}
+	return archive.LastSeq, archive.LastHash, nil, nil
+}
+
+/*
+ * 归档一批过期记录：先写归档文件、清单和登记，再从数据库删除
+ * 归档的记录须与上一个归档衔接成完整的哈希链，否则不归档，以免删除篡改的证据
+ */
+func (s *Archive) archiveBatch(dao *modelbase.DataDao, before time.Time) (int64, *radarerror.CommonError) {
+	collection := dao.Coll.GetCollectionName()
+	prevSeq, prevHash, brk, cerr := s.lastAnchor(collection)
+	if cerr != nil {
+		return 0, cerr
+	}
+	if brk != nil {
+		return 0, &radarerror.AuditChainBroken
+	}
+	if prevSeq > 0 {
+		removed, err := dao.RemoveChainedThrough(prevSeq)
+		if err != nil {
+			log.Errorf("fail to remove archived records: %v", err)
+			return 0, &radarerror.InternalServerError
+		}
+		if removed > 0 {
+			log.Warnf("removed %v records left over from archive: tenant %v, %v, through seq %v", removed, s.ME.Tenant, collection, prevSeq)
+		}
+	}
+
+	dir := filepath.Join(archiveCfg.Dir, strconv.FormatInt(s.ME.Tenant, 10))
+	err := os.MkdirAll(dir, 0750)
+	if err != nil {
+		log.Errorf("fail to create archive dir: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	archiveId := primitive.NewObjectID()
+	manifest := ArchiveManifest{
+		Collection: collection,
+		Tenant:     s.ME.Tenant,
+		File:       fmt.Sprintf("%v_%v.jsonl.gz", collection, archiveId.Hex()),
+		Before:     before.Unix(),
+	}
+	path := filepath.Join(dir, manifest.File)
+
+	// 先写临时文件，写完再改名，中途失败不留下不完整的归档
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		log.Errorf("fail to create archive file: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	defer os.Remove(path + ".tmp")
+	defer f.Close()
+	hasher := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(f, hasher))
+
+	var ids []primitive.ObjectID
+	err = dao.ScanBefore(prevSeq, before, archiveCfg.BatchSize, func(doc bson.M) error {
+		if seq, _ := doc[modelbase.ColChainSeq].(int64); seq > 0 {
+			brk, err := modelbase.CheckChainLink(prevSeq, prevHash, doc, nil)
+			if err != nil {
+				return err
+			}
+			if brk != nil {
+				log.Errorf("chain broken: tenant %v, %v, %+v", s.ME.Tenant, collection, *brk)
+				return errArchiveChainBroken
+			}
+			prevSeq, prevHash = seq, doc[modelbase.ColChainHash].(string)
+			if manifest.FirstSeq == 0 {
+				manifest.FirstSeq = seq
+			}
+			manifest.LastSeq, manifest.LastHash = prevSeq, prevHash
+		}
+		line, err := bson.MarshalExtJSON(doc, true, false)
+		if err != nil {
+			return err
+		}
+		_, err = gz.Write(append(line, '\n'))
+		if err != nil {
+			return err
+		}
+		ids = append(ids, doc[modelbase.ColId].(primitive.ObjectID))
+		return nil
+	})
+	if err == errArchiveChainBroken {
+		return 0, &radarerror.AuditChainBroken
+	} else if err != nil {
+		log.Errorf("fail to write archive file: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	err = gz.Close()
+	if err == nil {
+		err = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		log.Errorf("fail to write archive file: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+
+	manifest.Count = int64(len(ids))
+	manifest.Sha256 = hex.EncodeToString(hasher.Sum(nil))
+	manifest.Sign, err = jwt.Sign(manifest.signData())
+	if err != nil {
+		return 0, &radarerror.InternalServerError
+	}
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		log.Errorf("fail to marshal archive manifest: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	err = ioutil.WriteFile(path+ArchiveManifestSuffix, b, 0640)
+	if err != nil {
+		log.Errorf("fail to write archive manifest: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+
+	archive := model.Archive{
+		Collection: collection,
+		File:       manifest.File,
+		Count:      manifest.Count,
+		FirstSeq:   manifest.FirstSeq,
+		LastSeq:    manifest.LastSeq,
+		LastHash:   manifest.LastHash,
+		Before:     time.Unix(manifest.Before, 0),
+		Sha256:     manifest.Sha256,
+		Sign:       manifest.Sign,
+	}
+	archive.Id = archiveId
+	_, err = s.Dao.Add(s.ME.Id, archive)
+	if err != nil {
+		log.Errorf("fail to add archive: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+
+	deleted, err := dao.Remove(ids)
+	if err != nil {
+		log.Errorf("fail to remove archived records: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	log.Infof("archived %v: tenant %v, file %v, records %v, deleted %v", collection, s.ME.Tenant, manifest.File, manifest.Count, deleted)
+	return manifest.Count, nil
+}
+
+func archiveManifest(tenant int64, archive model.Archive) ArchiveManifest {
+	return ArchiveManifest{
+		Collection: archive.Collection,
+		Tenant:     tenant,
+		File:       archive.File,
+		Count:      archive.Count,
+		FirstSeq:   archive.FirstSeq,
+		LastSeq:    archive.LastSeq,
+		LastHash:   archive.LastHash,
+		Before:     archive.Before.Unix(),
+		Sha256:     archive.Sha256,
+		Sign:       archive.Sign,
+	}
+}
+
+/*
+ * 定期按保留策略归档各租户的过期记录
+ */
+func RunArchiveJob() {
+	if len(archiveCfg.Policies) == 0 {
+		return
+	}
+	interval := time.Duration(archiveCfg.CheckInterval) * time.Second
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		tenants, cerr := TenantUids()
+		if cerr != nil {
+			log.Errorf("fail to get tenants: %v", cerr)
+		}
+		for _, tenant := range tenants {
+			svcArchive := NewArchiveService(SystemME(tenant))
+			for _, policy := range archiveCfg.Policies {
+				cerr = svcArchive.Run(policy)
+				if cerr != nil {
+					log.Errorf("fail to archive %v of tenant %v: %v", policy.Collection, tenant, cerr)
+				}
+			}
+		}
+		<-ticker.C
+	}
+}
+
+/*
+ * 把归档文件恢复到只读表restored_{collection}，供调查使用；可重复执行
+ * 先校验清单的签名、文件摘要和记录数
+ */
+func RestoreArchive(path string) (ArchiveManifest, *radarerror.CommonError) {
+	var manifest ArchiveManifest
+	b, err := ioutil.ReadFile(path + ArchiveManifestSuffix)
+	if err != nil {
+		log.Errorf("fail to read archive manifest: %v", err)
+		return manifest, &radarerror.InvalidArchive
+	}
+	err = json.Unmarshal(b, &manifest)
+	if err != nil {
+		log.Errorf("invalid archive manifest: %v", err)
+		return manifest, &radarerror.InvalidArchive
+	}
+	err = jwt.VerifySign(manifest.signData(), manifest.Sign)
+	if err != nil || manifest.File != filepath.Base(path) {
+		log.Errorf("invalid archive manifest sign: %v", path)
+		return manifest, &radarerror.InvalidArchive
+	}
+	if _, ok := archiveDao(manifest.Collection, manifest.Tenant); !ok {
+		log.Errorf("collection cannot be archived: %v", manifest.Collection)
+		return manifest, &radarerror.InvalidArchive
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Errorf("fail to open archive file: %v", err)
+		return manifest, &radarerror.InvalidArchive
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	reader := io.TeeReader(f, hasher)
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		log.Errorf("invalid archive file: %v", err)
+		return manifest, &radarerror.InvalidArchive
+	}
+	docs := make([]bson.M, 0, manifest.Count)
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), archiveMaxLine)
+	for scanner.Scan() {
+		var doc bson.M
+		err = bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc)
+		if err != nil {
+			log.Errorf("invalid archive record: %v", err)
+			return manifest, &radarerror.InvalidArchive
+		}
+		docs = append(docs, doc)
+	}
+	if err = scanner.Err(); err != nil {
+		log.Errorf("fail to read archive file: %v", err)
+		return manifest, &radarerror.InvalidArchive
+	}
+	// 读完压缩流之后可能还有剩余字节，一并计入摘要
+	_, err = io.Copy(ioutil.Discard, reader)
+	if err != nil {
+		log.Errorf("fail to read archive file: %v", err)
+		return manifest, &radarerror.InvalidArchive
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != manifest.Sha256 || int64(len(docs)) != manifest.Count {
+		log.Errorf("archive file mismatch manifest: %v", path)
+		return manifest, &radarerror.InvalidArchive
+	}
+
+	dao := model.NewRestoredDao(manifest.Collection)
+	err = dao.ReplaceDocs(docs)
+	if err != nil {
+		log.Errorf("fail to restore archive: %v", err)
+		return manifest, &radarerror.InternalServerError
+	}
+	return manifest, nil
+}
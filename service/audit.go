@@ -0,0 +1,176 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// 审计严重级别
+	AuditSeverityInfo     = "info"
+	AuditSeverityWarning  = "warning"
+	AuditSeverityCritical = "critical"
+
+	// 审计动作
+	AuditActionBreakGlassLogin     = "break_glass_login"      // 应急账号登录
+	AuditActionBreakGlassLoginFail = "break_glass_login_fail" // 应急账号登录失败
+	AuditActionBreakGlassAccess    = "break_glass_access"     // 应急账号访问接口
+
+	// 审计结果
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// 一次修改数据的http请求
+type AuditRequest struct {
+	Ip        string                  // 来源ip
+	Method    string                  // 请求方法
+	Route     string                  // 路由，如/api/v3/user/:id
+	Path      string                  // 请求路径
+	Target    string                  // 目标实体id，可为空
+	RequestId string                  // 请求id
+	Err       *radarerror.CommonError // 失败时的错误，nil)成功
+}
+
+type Audit struct {
+	ME  ME
+	Dao model.AuditLogDao
+}
+
+func NewAuditService(me *ME) Audit {
+	s := Audit{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewAuditLogDao()
+	s.Dao.Tenant = s.ME.Tenant
+	return s
+}
+
+/*
+ * 添加审计记录
+ * 写入失败时把整条记录输出到告警日志，不能静默丢失
+ */
+func (s *Audit) Add(auditLog model.AuditLog) *radarerror.CommonError {
+	_, err := s.Dao.AddChained(s.ME.Id, auditLog)
+	if err != nil {
+		record, _ := json.Marshal(auditLog)
+		log.WithFields(log.Fields{
+			"alert":  "audit_lost",
+			"tenant": s.ME.Tenant,
+			"actor":  s.ME.Id.Hex(),
+			"record": string(record),
+		}).Errorf("fail to add audit log: %v", err)
+		return &radarerror.InternalServerError
+	}
+	return nil
+}
+
+/*
+ * 记录修改数据的请求：操作人、目标、动作、结果，以及操作人ME上记录的数据变更
+ */
+func (s *Audit) AddRequest(req AuditRequest) *radarerror.CommonError {
+	auditLog := model.AuditLog{
+		Actor:        s.ME.Id,
+		ActorAccount: s.ME.Account,
+		Action:       req.Method + " " + req.Route,
+		Severity:     AuditSeverityInfo,
+		Ip:           req.Ip,
+		Method:       req.Method,
+		Path:         req.Path,
+		Target:       req.Target,
+		Outcome:      AuditOutcomeSuccess,
+		RequestId:    req.RequestId,
+		Changes:      make([]modelbase.Change, 0),
+	}
+	if s.ME.Changes != nil {
+		auditLog.Changes = append(auditLog.Changes, s.ME.Changes.Changes()...)
+	}
+	if req.Err != nil {
+		auditLog.Severity = AuditSeverityWarning
+		auditLog.Outcome = AuditOutcomeFailure
+		auditLog.ErrorCode = req.Err.Code
+		auditLog.Desc = req.Err.Message
+	}
+	return s.Add(auditLog)
+}
+
+type FilterAuditLog struct {
+	Actor    *primitive.ObjectID // 操作人id
+	Action   *string             // 动作
+	Severity *string             // 严重级别
+	Outcome  *string             // 结果
+	Target   *string             // 目标实体id
+	Time     *TimeRange          // 记录时间，结束时间为0表示不限
+}
+
+func (s *Audit) ConvertFilter(filter FilterAuditLog) bson.M {
+	mFilter := bson.M{}
+	if filter.Actor != nil {
+		mFilter[model.ColAuditLogActor] = *filter.Actor
+	}
+	if filter.Action != nil {
+		mFilter[model.ColAuditLogAction] = *filter.Action
+	}
+	if filter.Severity != nil {
+		mFilter[model.ColAuditLogSeverity] = *filter.Severity
+	}
+	if filter.Outcome != nil {
+		mFilter[model.ColAuditLogOutcome] = *filter.Outcome
+	}
+	if filter.Target != nil {
+		mFilter[model.ColAuditLogTarget] = *filter.Target
+	}
+	if filter.Time != nil {
+		cond := bson.M{"$gte": time.Unix(filter.Time.Start, 0)}
+		if filter.Time.End > 0 {
+			cond["$lte"] = time.Unix(filter.Time.End, 0)
+		}
+		mFilter[modelbase.ColCreateTime] = cond
+	}
+	// 数据范围不是全部的只能查到自己的操作
+	if isDataScoped(&s.ME) {
+		mFilter[model.ColAuditLogActor] = s.ME.Id
+	}
+	return mFilter
+}
+
+/*
+ * 根据筛选条件分页获取，按记录时间倒序
+ * 注意：page是从0开始
+ */
+func (s *Audit) Gets(page, pageSize int64, filter FilterAuditLog) ([]model.AuditLog, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	if pageSize > 0 {
+		opts.SetLimit(pageSize)
+	}
+	opts.SetSkip(page * pageSize)
+	opts.SetSort(bson.M{modelbase.ColId: -1})
+	auditLogs := make([]model.AuditLog, 0)
+	err := s.Dao.Gets(&auditLogs, s.ConvertFilter(filter), opts)
+	if err != nil {
+		log.Errorf("fail to get audit logs: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return auditLogs, nil
+}
+
+/*
+ * 根据筛选条件获取结果集总数
+ */
+func (s *Audit) GetCount(filter FilterAuditLog) (int64, *radarerror.CommonError) {
+	count, err := s.Dao.GetCount(s.ConvertFilter(filter))
+	if err != nil {
+		log.Errorf("fail to get audit log count: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	return count, nil
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/SeeJson/account/util/jwt"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AuditChainConfig struct {
+	CheckpointInterval int `mapstructure:"checkpoint_interval"` // 生成签名检查点的间隔，单位：秒；0)不生成
+}
+
+var auditChainCfg AuditChainConfig
+
+func SetAuditChainConfig(c AuditChainConfig) {
+	auditChainCfg = c
+}
+
+// 一条哈希链的校验报告
+type AuditChainReport struct {
+	Collection  string                // 表名
+	Count       int64                 // 校验的记录数
+	LastSeq     int64                 // 最后一条记录的链序号
+	Checkpoints int                   // 签名有效的检查点数
+	Broken      *modelbase.ChainBreak // 第一处断开，nil)完整
+}
+
+/*
+ * 审计日志、操作记录的哈希链：校验和生成签名检查点
+ */
+type AuditChain struct {
+	ME                 ME
+	AuditLogDao        model.AuditLogDao
+	OperationRecordDao model.OperationRecordDao
+	CheckpointDao      model.ChainCheckpointDao
+}
+
+func NewAuditChainService(me *ME) AuditChain {
+	s := AuditChain{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.AuditLogDao = model.NewAuditLogDao()
+	s.AuditLogDao.Tenant = s.ME.Tenant
+	s.OperationRecordDao = model.NewOperationRecordDao()
+	s.OperationRecordDao.Tenant = s.ME.Tenant
+	s.CheckpointDao = model.NewChainCheckpointDao()
+	s.CheckpointDao.Tenant = s.ME.Tenant
+	return s
+}
+
+func (s *AuditChain) chains() []*modelbase.DataDao {
+	return []*modelbase.DataDao{&s.AuditLogDao.DataDao, &s.OperationRecordDao.DataDao}
+}
+
+/*
+ * 校验租户内的各条哈希链，报告各自的第一处断开
+ */
+func (s *AuditChain) Verify() ([]AuditChainReport, *radarerror.CommonError) {
+	reports := make([]AuditChainReport, 0)
+	for _, dao := range s.chains() {
+		collection := dao.Coll.GetCollectionName()
+		checkpoints, signBroken, cerr := s.loadCheckpoints(collection)
+		if cerr != nil {
+			return nil, cerr
+		}
+		// 已归档的记录从数据库删除，从最后一个归档之后开始校验
+		svcArchive := NewArchiveService(&s.ME)
+		fromSeq, fromHash, archiveBroken, cerr := svcArchive.lastAnchor(collection)
+		if cerr != nil {
+			return nil, cerr
+		}
+		result, err := dao.VerifyChain(fromSeq, fromHash, checkpoints)
+		if err != nil {
+			log.Errorf("fail to verify chain %v: %v", collection, err)
+			return nil, &radarerror.InternalServerError
+		}
+
+		report := AuditChainReport{
+			Collection:  collection,
+			Count:       result.Count,
+			LastSeq:     result.LastSeq,
+			Checkpoints: len(checkpoints),
+			Broken:      result.Broken,
+		}
+		// 签名无效的检查点在更前面时以它为准
+		if signBroken != nil && (report.Broken == nil || signBroken.Seq <= report.Broken.Seq) {
+			report.Broken = signBroken
+		}
+		// 归档登记的签名无效时，校验没有可信的起点
+		if archiveBroken != nil {
+			report.Broken = archiveBroken
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+/*
+ * 签名有效的检查点（链序号 -> 哈希），以及第一个签名无效的检查点
+ */
+func (s *AuditChain) loadCheckpoints(collection string) (map[int64]string, *modelbase.ChainBreak, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	opts.SetSort(bson.M{model.ColChainCheckpointSeq: 1})
+	var checkpoints []model.ChainCheckpoint
+	err := s.CheckpointDao.Gets(&checkpoints, bson.M{model.ColChainCheckpointCollection: collection}, opts)
+	if err != nil {
+		log.Errorf("fail to get chain checkpoints: %v", err)
+		return nil, nil, &radarerror.InternalServerError
+	}
+
+	valid := make(map[int64]string, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		err = jwt.VerifySign(checkpointData(s.ME.Tenant, collection, checkpoint.Seq, checkpoint.Hash), checkpoint.Sign)
+		if err != nil {
+			log.Errorf("invalid chain checkpoint sign: %v %v: %v", collection, checkpoint.Seq, err)
+			return valid, &modelbase.ChainBreak{Seq: checkpoint.Seq, Id: checkpoint.Id, Reason: modelbase.ChainBrokenSign}, nil
+		}
+		valid[checkpoint.Seq] = checkpoint.Hash
+	}
+	return valid, nil, nil
+}
+
+/*
+ * 给各条哈希链的链尾生成签名检查点，链尾没有变化的跳过
+ */
+func (s *AuditChain) Checkpoint() *radarerror.CommonError {
+	for _, dao := range s.chains() {
+		collection := dao.Coll.GetCollectionName()
+		seq, hash, err := dao.ChainHead()
+		if err != nil {
+			log.Errorf("fail to get chain head: %v", err)
+			return &radarerror.InternalServerError
+		}
+		if seq == 0 {
+			continue
+		}
+
+		opts := &options.FindOptions{}
+		opts.SetSort(bson.M{model.ColChainCheckpointSeq: -1})
+		opts.SetLimit(1)
+		var lasts []model.ChainCheckpoint
+		err = s.CheckpointDao.Gets(&lasts, bson.M{model.ColChainCheckpointCollection: collection}, opts)
+		if err != nil {
+			log.Errorf("fail to get chain checkpoints: %v", err)
+			return &radarerror.InternalServerError
+		}
+		if len(lasts) > 0 && lasts[0].Seq >= seq {
+			continue
+		}
+
+		sign, err := jwt.Sign(checkpointData(s.ME.Tenant, collection, seq, hash))
+		if err != nil {
+			return &radarerror.InternalServerError
+		}
+		_, err = s.CheckpointDao.Add(s.ME.Id, model.ChainCheckpoint{
+			Collection: collection,
+			Seq:        seq,
+			Hash:       hash,
+			Sign:       sign,
+		})
+		if err != nil {
+			log.Errorf("fail to add chain checkpoint: %v", err)
+			return &radarerror.InternalServerError
+		}
+	}
+	return nil
+}
+
+// 检查点签名的内容，带上租户和表名，防止检查点被挪用到其他链
+func checkpointData(tenant int64, collection string, seq int64, hash string) []byte {
+	return []byte(fmt.Sprintf("%v:%v:%v:%v", collection, tenant, seq, hash))
+}
+
+/*
+ * 定期给各租户的哈希链生成签名检查点
+ */
+func RunAuditCheckpointJob() {
+	interval := time.Duration(auditChainCfg.CheckpointInterval) * time.Second
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		tenants, cerr := TenantUids()
+		if cerr != nil {
+			log.Errorf("fail to get tenants: %v", cerr)
+		}
+		for _, tenant := range tenants {
+			svcAuditChain := NewAuditChainService(SystemME(tenant))
+			cerr = svcAuditChain.Checkpoint()
+			if cerr != nil {
+				log.Errorf("fail to checkpoint audit chains of tenant %v: %v", tenant, cerr)
+			}
+		}
+	}
+}
+
+/*
+ * 校验全部租户的哈希链，返回是否全部完整
+ */
+func VerifyAllAuditChains() (bool, *radarerror.CommonError) {
+	tenants, cerr := TenantUids()
+	if cerr != nil {
+		return false, cerr
+	}
+	intact := true
+	for _, tenant := range tenants {
+		svcAuditChain := NewAuditChainService(SystemME(tenant))
+		reports, cerr := svcAuditChain.Verify()
+		if cerr != nil {
+			return false, cerr
+		}
+		for _, report := range reports {
+			if report.Broken != nil {
+				intact = false
+				log.Errorf("tenant %v, %v: broken at seq %v, id %v, reason %v, checked %v",
+					tenant, report.Collection, report.Broken.Seq, report.Broken.Id.Hex(), report.Broken.Reason, report.Count)
+				continue
+			}
+			log.Infof("tenant %v, %v: intact, records %v, last seq %v, checkpoints %v",
+				tenant, report.Collection, report.Count, report.LastSeq, report.Checkpoints)
+		}
+	}
+	return intact, nil
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"reflect"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+ * 权限对象、权限动作的登记表
+ * 以代码中的常量为准，启动时同步到数据库，供前端渲染权限矩阵
+ */
+type Auth struct {
+	ME     ME
+	ObjDao model.AuthObjDao
+	ActDao model.AuthActDao
+}
+
+func NewAuthService(me *ME) Auth {
+	s := Auth{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.ObjDao = model.NewAuthObjDao()
+	s.ActDao = model.NewAuthActDao()
+	return s
+}
+
+/*
+ * 获取平台的全部权限对象，按模块、排序展示
+ */
+func (s *Auth) GetsObj(platform int64) ([]model.AuthObj, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	opts.SetSort(bson.D{
+		{Key: model.ColAuthObjSort, Value: 1},
+		{Key: modelbase.ColUid, Value: 1},
+	})
+	var objs []model.AuthObj
+	err := s.ObjDao.Gets(&objs, bson.M{model.ColAuthObjPlatform: model.PlatformFilter(platform)}, opts)
+	if err != nil {
+		log.Errorf("fail to get auth objs: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return objs, nil
+}
+
+/*
+ * 获取全部权限动作
+ */
+func (s *Auth) GetsAct() ([]model.AuthAct, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	opts.SetSort(bson.M{modelbase.ColUid: 1})
+	var acts []model.AuthAct
+	err := s.ActDao.Gets(&acts, bson.M{}, opts)
+	if err != nil {
+		log.Errorf("fail to get auth acts: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return acts, nil
+}
+
+/*
+ * 同步账号中心的权限对象：新增缺少的，更新显示名等有变化的，逻辑删除代码中已移除的
+ * 其他平台的权限对象由管理员登记，不参与同步
+ */
+func (s *Auth) SyncObjs(objs []model.AuthObj) *radarerror.CommonError {
+	var existed []model.AuthObj
+	// 包含已逻辑删除的，重新加回时恢复即可
+	err := s.ObjDao.Gets(&existed, bson.M{modelbase.ColIsDelete: bson.M{"$in": []bool{true, false}}})
+	if err != nil {
+		log.Errorf("fail to get auth objs: %v", err)
+		return &radarerror.InternalServerError
+	}
+	existedEntries := make([]authEntry, 0, len(existed))
+	for _, obj := range existed {
+		if obj.Platform != 0 {
+			continue
+		}
+		existedEntries = append(existedEntries, authObjEntry(obj))
+	}
+	entries := make([]authEntry, 0, len(objs))
+	for _, obj := range objs {
+		obj.Uid = obj.BitMark
+		entries = append(entries, authObjEntry(obj))
+	}
+	return syncAuthEntries(&s.ObjDao.MetaDao, "auth obj", existedEntries, entries)
+}
+
+/*
+ * 同步权限动作，规则同SyncObjs
+ */
+func (s *Auth) SyncActs(acts []model.AuthAct) *radarerror.CommonError {
+	var existed []model.AuthAct
+	// 包含已逻辑删除的，重新加回时恢复即可
+	err := s.ActDao.Gets(&existed, bson.M{modelbase.ColIsDelete: bson.M{"$in": []bool{true, false}}})
+	if err != nil {
+		log.Errorf("fail to get auth acts: %v", err)
+		return &radarerror.InternalServerError
+	}
+	existedEntries := make([]authEntry, 0, len(existed))
+	for _, act := range existed {
+		existedEntries = append(existedEntries, authActEntry(act))
+	}
+	entries := make([]authEntry, 0, len(acts))
+	for _, act := range acts {
+		act.Uid = act.BitMark
+		entries = append(entries, authActEntry(act))
+	}
+	return syncAuthEntries(&s.ActDao.MetaDao, "auth act", existedEntries, entries)
+}
+
+// 按uid（即bit_mark）同步的登记项
+type authEntry struct {
+	Uid      int64
+	IsDelete bool
+	Model    interface{} // 新增时写入的文档
+	Fields   bson.M      // 需要与代码保持一致的字段，如显示名
+}
+
+func authObjEntry(obj model.AuthObj) authEntry {
+	return authEntry{
+		Uid:      obj.Uid,
+		IsDelete: obj.IsDelete,
+		Model:    obj,
+		Fields: bson.M{
+			model.ColAuthObjName:   obj.Name,
+			model.ColAuthObjModule: obj.Module,
+			model.ColAuthObjSort:   obj.Sort,
+		},
+	}
+}
+
+func authActEntry(act model.AuthAct) authEntry {
+	return authEntry{
+		Uid:      act.Uid,
+		IsDelete: act.IsDelete,
+		Model:    act,
+		Fields:   bson.M{model.ColAuthActName: act.Name},
+	}
+}
+
+/*
+ * 以entries为准同步登记表：新增缺少的，更新Fields有变化的或恢复已逻辑删除的，逻辑删除多余的
+ */
+func syncAuthEntries(dao *modelbase.MetaDao, kind string, existed, entries []authEntry) *radarerror.CommonError {
+	uid2Existed := make(map[int64]authEntry, len(existed))
+	for _, entry := range existed {
+		uid2Existed[entry.Uid] = entry
+	}
+
+	uids := make(map[int64]bool, len(entries))
+	for _, entry := range entries {
+		uids[entry.Uid] = true
+
+		old, ok := uid2Existed[entry.Uid]
+		if !ok {
+			log.Infof("add %v: %v %v", kind, entry.Uid, entry.Fields)
+			_, err := dao.Add(entry.Model)
+			if err != nil {
+				log.Errorf("fail to add %v: %v", kind, err)
+				return &radarerror.InternalServerError
+			}
+			continue
+		}
+		if !old.IsDelete && reflect.DeepEqual(old.Fields, entry.Fields) {
+			continue
+		}
+		log.Infof("update %v: %v %v", kind, entry.Uid, entry.Fields)
+		set := bson.M{modelbase.ColIsDelete: false}
+		for field, value := range entry.Fields {
+			set[field] = value
+		}
+		filter := bson.M{modelbase.ColUid: entry.Uid, modelbase.ColIsDelete: old.IsDelete}
+		_, err := dao.Update(filter, bson.M{"$set": set})
+		if err != nil {
+			log.Errorf("fail to update %v: %v", kind, err)
+			return &radarerror.InternalServerError
+		}
+	}
+
+	for uid, old := range uid2Existed {
+		if uids[uid] || old.IsDelete {
+			continue
+		}
+		log.Infof("delete %v: %v", kind, uid)
+		_, err := dao.UpdateByUid(uid, bson.M{"$set": bson.M{modelbase.ColIsDelete: true}})
+		if err != nil {
+			log.Errorf("fail to delete %v: %v", kind, err)
+			return &radarerror.InternalServerError
+		}
+	}
+	return nil
+}
+
+/*
+ * 登记其他平台的权限对象，bit_mark在平台内唯一
+ */
+func (s *Auth) AddPlatformObj(obj model.AuthObj) *radarerror.CommonError {
+	if obj.Platform <= 0 || obj.BitMark <= 0 || obj.BitMark >= 1<<32 || obj.Name == "" {
+		log.Errorf("invalid auth obj: %+v", obj)
+		return &radarerror.InvalidArgs
+	}
+	cerr := checkHostTenant(&s.ME)
+	if cerr != nil {
+		return cerr
+	}
+	svcPlatform := NewPlatformService(&s.ME)
+	_, cerr = svcPlatform.GetByUid(obj.Platform)
+	if cerr != nil {
+		return cerr
+	}
+
+	obj.Uid = model.AuthObjUid(obj.Platform, obj.BitMark)
+	var old model.AuthObj
+	err := s.ObjDao.Get(&old, bson.M{
+		modelbase.ColUid:      obj.Uid,
+		modelbase.ColIsDelete: bson.M{"$in": []bool{true, false}},
+	})
+	if err == nil && !old.IsDelete {
+		log.Errorf("duplicated auth obj: %v %v", obj.Platform, obj.BitMark)
+		return &radarerror.DuplicatedAuthObj
+	} else if err == nil {
+		// 删除后重新登记，恢复即可
+		_, err = s.ObjDao.Update(bson.M{modelbase.ColUid: obj.Uid, modelbase.ColIsDelete: true}, bson.M{"$set": bson.M{
+			model.ColAuthObjName:   obj.Name,
+			model.ColAuthObjModule: obj.Module,
+			model.ColAuthObjSort:   obj.Sort,
+			modelbase.ColIsDelete:  false,
+		}})
+		if err != nil {
+			log.Errorf("fail to update auth obj: %v", err)
+			return &radarerror.InternalServerError
+		}
+		return nil
+	} else if err != mongo.ErrNoDocuments {
+		log.Errorf("fail to get auth obj: %v", err)
+		return &radarerror.InternalServerError
+	}
+
+	_, err = s.ObjDao.Add(obj)
+	if err != nil {
+		log.Errorf("fail to add auth obj: %v", err)
+		return &radarerror.InternalServerError
+	}
+	return nil
+}
+
+/*
+ * 删除其他平台的权限对象，已授予的权限集不变，但不能再授予
+ */
+func (s *Auth) DeletePlatformObj(platform, bitMark int64) *radarerror.CommonError {
+	if platform <= 0 {
+		log.Errorf("cannot delete auth obj of account center: %v", bitMark)
+		return &radarerror.InvalidArgs
+	}
+	cerr := checkHostTenant(&s.ME)
+	if cerr != nil {
+		return cerr
+	}
+	modified, err := s.ObjDao.UpdateByUid(model.AuthObjUid(platform, bitMark), bson.M{"$set": bson.M{modelbase.ColIsDelete: true}})
+	if err != nil {
+		log.Errorf("fail to delete auth obj: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if modified == 0 {
+		log.Errorf("auth obj not found: %v %v", platform, bitMark)
+		return &radarerror.AuthObjNotFound
+	}
+	return nil
+}
+
+/*
+ * 校验其他平台的权限集：权限对象须已在该平台登记，权限动作须已登记
+ */
+func (s *Auth) CheckPlatformAuths(platform int64, auths map[int64]int64) *radarerror.CommonError {
+	if len(auths) == 0 {
+		return nil
+	}
+	objs, cerr := s.GetsObj(platform)
+	if cerr != nil {
+		return cerr
+	}
+	acts, cerr := s.GetsAct()
+	if cerr != nil {
+		return cerr
+	}
+	var allActs int64
+	for _, act := range acts {
+		allActs |= act.BitMark
+	}
+	registered := make(map[int64]bool, len(objs))
+	for _, obj := range objs {
+		registered[obj.BitMark] = true
+	}
+	for obj, act := range auths {
+		if !registered[obj] || act == 0 || act&^allActs != 0 {
+			log.Errorf("invalid auths of platform %v: %v", platform, auths)
+			return &radarerror.InvalidAuths
+		}
+	}
+	return nil
+}
@@ -3,25 +3,36 @@ package service
 import (
 	"encoding/json"
 
+	modelbase "github.com/SeeJson/account/model/base"
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // 会话里的操作人信息
 type ME struct {
-	Id      primitive.ObjectID `json:"id"`       // 用户id
-	Version int64              `json:"version"`  // 会话版本号
-	AuthMp  map[int64]int64    `json:"auth_map"` // 所拥有的权限集 map的key是权限对象的二进制掩码，value是权限动作的二进制掩码取或
-
-	Account        string             `json:"account"`         // 登录账号
-	Name           string             `json:"name"`            // 显示名
-	PasswordReset  bool               `json:"password_reset"`  // 是否已重设密码
-	Department     primitive.ObjectID `json:"department"`      // 部门id
-	DepartmentName string             `json:"department_name"` // 部门名
-	Role           primitive.ObjectID `json:"role"`            // 角色id
-	RoleName       string             `json:"role_name"`       // 角色名
-	PoliceNumber   string             `json:"police_number"`   // 警号
-	Phone          string             `json:"phone"`           // 手机号
+	Id       primitive.ObjectID `json:"id"`       // 用户id
+	Version  int64              `json:"version"`  // 会话版本号
+	Tenant   int64              `json:"tenant"`   // 所属租户uid，0)默认租户；只能访问该租户的数据
+	Platform int64              `json:"platform"` // 令牌所属平台uid，0)账号中心；权限集、数据范围只包含该平台的角色
+	AuthMp   map[int64]int64    `json:"auth_map"` // 所拥有的权限集 map的key是权限对象的二进制掩码，value是权限动作的二进制掩码取或
+
+	DataScope            string               `json:"data_scope"`                       // 数据范围，多个角色时取最大的，见DataScope*
+	DataScopeDepartments []primitive.ObjectID `json:"data_scope_departments,omitempty"` // 额外可访问的部门id，即各角色custom数据范围的并集
+
+	Changes *modelbase.ChangeLog `json:"-"` // 本次请求的数据变更，由审计中间件设置；为nil时不记录
+
+	ReauthTime int64 `json:"reauth_time,omitempty"` // 最近一次重新验证身份的时间戳，0)未验证
+	BreakGlass bool  `json:"break_glass,omitempty"` // 是否应急账号
+
+	Account        string               `json:"account"`         // 登录账号
+	Name           string               `json:"name"`            // 显示名
+	PasswordReset  bool                 `json:"password_reset"`  // 是否已重设密码
+	Department     primitive.ObjectID   `json:"department"`      // 部门id
+	DepartmentName string               `json:"department_name"` // 部门名
+	Roles          []primitive.ObjectID `json:"roles"`           // 角色id
+	RoleNames      []string             `json:"role_names"`      // 角色名
+	PoliceNumber   string               `json:"police_number"`   // 警号
+	Phone          string               `json:"phone"`           // 手机号
 }
 
 func (m ME) Json() string {
@@ -32,6 +43,21 @@ func (m ME) Json() string {
 	return string(s)
 }
 
+/*
+ * 系统内部调用的操作人：不受数据范围限制，但只访问指定租户的数据
+ */
+func SystemME(tenant int64) *ME {
+	return &ME{Tenant: tenant}
+}
+
+/*
+ * 按操作人设置dao的租户和变更记录
+ */
+func (m *ME) bindDao(d *modelbase.DataDao) {
+	d.Tenant = m.Tenant
+	d.Changes = m.Changes
+}
+
 func LoadME(jsonStr string) (*ME, error) {
 	var me ME
 	err := json.Unmarshal([]byte(jsonStr), &me)
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/util/crypt"
+	"github.com/SeeJson/account/util/jwt"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type BreakGlassConfig struct {
+	Accounts   []BreakGlassAccount `mapstructure:"accounts"`
+	AllowedIps []string            `mapstructure:"allowed_ips"` // 除本机外允许使用应急账号的ip
+}
+
+// 应急账号
+type BreakGlassAccount struct {
+	Account  string `mapstructure:"account"`  // 登录账号
+	Password string `mapstructure:"password"` // 密码的bcrypt哈希，经crypt.Encrypt(jwt_config.key_factory)加密后的密文
+}
+
+var breakGlassCfg BreakGlassConfig
+
+func SetBreakGlassConfig(c BreakGlassConfig) {
+	breakGlassCfg = c
+}
+
+/*
+ * 应急账号登录，应急账号由部署配置，可登录任一租户
+ * 账号不是应急账号时返回nil, nil，由调用方继续走普通登录
+ */
+func BreakGlassLogin(tenant int64, account, password, ip string, authMp map[int64]int64) (*ME, *radarerror.CommonError) {
+	var bgAccount *BreakGlassAccount
+	for i := range breakGlassCfg.Accounts {
+		if breakGlassCfg.Accounts[i].Account == account {
+			bgAccount = &breakGlassCfg.Accounts[i]
+			break
+		}
+	}
+	if bgAccount == nil {
+		return nil, nil
+	}
+
+	me := ME{
+		Id:            breakGlassId(account),
+		Tenant:        tenant,
+		AuthMp:        authMp,
+		BreakGlass:    true,
+		Account:       account,
+		Name:          account,
+		PasswordReset: true,
+	}
+
+	if !IsBreakGlassIpAllowed(ip) {
+		auditBreakGlass(&me, AuditActionBreakGlassLoginFail, ip, "", "", "ip not allowed")
+		return nil, &radarerror.ForbiddenAccess
+	}
+
+	hash, err := crypt.Decrypt(jwt.GetKeyFactory(), bgAccount.Password)
+	if err != nil {
+		log.Errorf("fail to decrypt break-glass password: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		auditBreakGlass(&me, AuditActionBreakGlassLoginFail, ip, "", "", "password not match")
+		return nil, &radarerror.InvalidPassword
+	}
+
+	me.Version = RefreshSessionVersion(me.Id)
+	auditBreakGlass(&me, AuditActionBreakGlassLogin, ip, "", "", "")
+	return &me, nil
+}
+
+/*
+ * 应急账号每次访问接口都需要重新检查来源ip，并留下审计记录
+ */
+func CheckBreakGlassAccess(me *ME, ip, method, path string) *radarerror.CommonError {
+	if !IsBreakGlassIpAllowed(ip) {
+		auditBreakGlass(me, AuditActionBreakGlassAccess, ip, method, path, "ip not allowed")
+		return &radarerror.ForbiddenAccess
+	}
+	auditBreakGlass(me, AuditActionBreakGlassAccess, ip, method, path, "")
+	return nil
+}
+
+func IsBreakGlassAccount(account string) bool {
+	for _, bgAccount := range breakGlassCfg.Accounts {
+		if bgAccount.Account == account {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * 与已有用户同名的应急账号，登录时会遮蔽该用户，启动时检查
+ */
+func BreakGlassAccountConflicts() ([]string, *radarerror.CommonError) {
+	if len(breakGlassCfg.Accounts) == 0 {
+		return nil, nil
+	}
+	tenants, cerr := TenantUids()
+	if cerr != nil {
+		return nil, cerr
+	}
+	var conflicts []string
+	for _, tenant := range tenants {
+		svcUser := NewUserService(SystemME(tenant))
+		for _, bgAccount := range breakGlassCfg.Accounts {
+			_, cerr := svcUser.GetByAccount(bgAccount.Account)
+			if cerr == nil {
+				conflicts = append(conflicts, fmt.Sprintf("%v@%v", bgAccount.Account, tenant))
+			} else if cerr != &radarerror.UserNotFound {
+				return nil, cerr
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+func IsBreakGlassIpAllowed(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed != nil && parsed.IsLoopback() {
+		return true
+	}
+	for _, allowed := range breakGlassCfg.AllowedIps {
+		if allowed == ip {
+			return true
+		}
+	}
+	return false
+}
+
+/***** 辅助函数 *****/
+
+// 应急账号没有用户文档，用账号生成固定的id，以便使用会话版本号
+func breakGlassId(account string) primitive.ObjectID {
+	var id primitive.ObjectID
+	sum := md5.Sum([]byte("break_glass:" + account))
+	copy(id[:], sum[:])
+	return id
+}
+
+// 按id查找应急账号，用于展示应急账号创建、编辑的数据
+func BreakGlassAccountById(id primitive.ObjectID) (string, bool) {
+	for _, bgAccount := range breakGlassCfg.Accounts {
+		if breakGlassId(bgAccount.Account) == id {
+			return bgAccount.Account, true
+		}
+	}
+	return "", false
+}
+
+// 应急账号的每次使用都记录高级别审计并输出告警日志
+func auditBreakGlass(me *ME, action, ip, method, path, desc string) {
+	log.WithFields(log.Fields{
+		"alert":   "break_glass",
+		"account": me.Account,
+		"action":  action,
+		"ip":      ip,
+		"method":  method,
+		"path":    path,
+		"desc":    desc,
+	}).Warn(fmt.Sprintf("break-glass account used: %v", me.Account))
+
+	svcAudit := NewAuditService(me)
+	svcAudit.Add(model.AuditLog{
+		Actor:        me.Id,
+		ActorAccount: me.Account,
+		Action:       action,
+		Severity:     AuditSeverityCritical,
+		Ip:           ip,
+		Method:       method,
+		Path:         path,
+		Desc:         desc,
+	})
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// 角色的数据范围：决定能访问哪些用户记录
+	DataScopeSelf       = "self"       // 仅本人
+	DataScopeDepartment = "department" // 本部门
+	DataScopeSubtree    = "subtree"    // 本部门及所有下级部门
+	DataScopeCustom     = "custom"     // 指定部门
+	DataScopeAll        = "all"        // 全部
+)
+
+// 数据范围从小到大，custom只额外增加部门，不扩大基础范围
+var dataScopeRank = map[string]int{
+	DataScopeSelf:       0,
+	DataScopeCustom:     0,
+	DataScopeDepartment: 1,
+	DataScopeSubtree:    2,
+	DataScopeAll:        3,
+}
+
+func IsValidDataScope(scope string) bool {
+	switch scope {
+	case DataScopeSelf, DataScopeDepartment, DataScopeSubtree, DataScopeCustom, DataScopeAll:
+		return true
+	}
+	return false
+}
+
+/*
+ * 把角色的数据范围合并到会话：基础范围取最大的，custom指定的部门取并集
+ */
+func MergeDataScope(me *ME, scope string, deptIds []primitive.ObjectID) {
+	if !IsValidDataScope(scope) {
+		return
+	}
+	if me.DataScope == "" || dataScopeRank[scope] > dataScopeRank[me.DataScope] {
+		me.DataScope = scope
+	}
+	if scope != DataScopeCustom {
+		return
+	}
+	for _, id := range deptIds {
+		existed := false
+		for _, old := range me.DataScopeDepartments {
+			if old == id {
+				existed = true
+				break
+			}
+		}
+		if !existed {
+			me.DataScopeDepartments = append(me.DataScopeDepartments, id)
+		}
+	}
+}
+
+/*
+ * 当前操作人是否受数据范围限制
+ * 系统内部调用（没有操作人）和应急账号不受限制
+ */
+func isDataScoped(me *ME) bool {
+	return me.Id != primitive.NilObjectID && !me.BreakGlass && me.DataScope != DataScopeAll
+}
+
+/*
+ * 获取当前操作人可访问的部门id：基础范围对应的部门加上custom指定的部门
+ */
+func getDataScopeDepartments(me *ME) ([]primitive.ObjectID, *radarerror.CommonError) {
+	var deptIds []primitive.ObjectID
+	switch me.DataScope {
+	case DataScopeDepartment:
+		deptIds = []primitive.ObjectID{me.Department}
+	case DataScopeSubtree:
+		svcDepartment := NewDepartmentService(me)
+		subtree, cerr := svcDepartment.GetSubtreeIds(me.Department)
+		if cerr != nil {
+			return nil, cerr
+		}
+		deptIds = subtree
+	}
+	return append(deptIds, me.DataScopeDepartments...), nil
+}
+
+/*
+ * 把数据范围注入用户查询条件
+ */
+func scopeUserFilter(me *ME, mFilter bson.M) *radarerror.CommonError {
+	if !isDataScoped(me) {
+		return nil
+	}
+
+	// 本人总是可以访问
+	deptIds, cerr := getDataScopeDepartments(me)
+	if cerr != nil {
+		return cerr
+	}
+	cond := bson.M{modelbase.ColId: me.Id}
+	if len(deptIds) > 0 {
+		cond = bson.M{"$or": []bson.M{
+			cond,
+			{model.ColUserDepartment: bson.M{"$in": deptIds}},
+		}}
+	}
+
+	and, _ := mFilter["$and"].([]bson.M)
+	mFilter["$and"] = append(and, cond)
+	return nil
+}
+
+/*
+ * 检查单个用户是否在当前操作人的数据范围内
+ */
+func CheckUserInScope(me *ME, user model.User) *radarerror.CommonError {
+	if !isDataScoped(me) {
+		return nil
+	}
+	if user.Id == me.Id {
+		return nil
+	}
+	return CheckDepartmentInScope(me, user.Department)
+}
+
+/*
+ * 检查部门是否在当前操作人的数据范围内，用于新增用户或把用户调入某部门
+ */
+func CheckDepartmentInScope(me *ME, deptId primitive.ObjectID) *radarerror.CommonError {
+	if !isDataScoped(me) {
+		return nil
+	}
+	deptIds, cerr := getDataScopeDepartments(me)
+	if cerr != nil {
+		return cerr
+	}
+	for _, id := range deptIds {
+		if id == deptId {
+			return nil
+		}
+	}
+	log.Errorf("department out of data scope, me: %v, department: %v", me.Id.Hex(), deptId.Hex())
+	return &radarerror.ExceedAuthority
+}
+
+/*
+ * 检查分配给用户的角色（含继承的上级角色）不超出当前操作人的权限和数据范围，用于分配角色和临时授权
+ * 账号中心的角色与会话比较；其他平台的角色与操作人在该平台的权限比较
+ * 系统内部调用和应急账号不受限制
+ */
+func CheckRolesWithinMe(me *ME, roleIds []primitive.ObjectID) *radarerror.CommonError {
+	if me.Id == primitive.NilObjectID || me.BreakGlass || len(roleIds) == 0 {
+		return nil
+	}
+	svcRole := NewRoleService(SystemME(me.Tenant))
+	roles, cerr := svcRole.GetsWithAncestors(roleIds)
+	if cerr != nil {
+		return cerr
+	}
+	auths := make(map[int64]map[int64]int64)
+	var scope ME
+	for _, role := range roles {
+		if auths[role.Platform] == nil {
+			auths[role.Platform] = make(map[int64]int64)
+		}
+		MergeAuthMp(auths[role.Platform], role.Auths)
+		if role.Platform == 0 {
+			MergeDataScope(&scope, role.DataScope, role.DataScopeDepartments)
+		}
+	}
+
+	for platform, authMp := range auths {
+		own := me.AuthMp
+		if platform != 0 {
+			own, cerr = platformAuthMp(me, platform)
+			if cerr != nil {
+				return cerr
+			}
+		}
+		if !authsWithin(authMp, own) {
+			log.Errorf("roles exceed own auths, me: %v, platform: %v, roles: %v", me.Id.Hex(), platform, roleIds)
+			return &radarerror.ExceedAuthority
+		}
+	}
+
+	if me.DataScope == DataScopeAll {
+		return nil
+	}
+	var ownDepts []primitive.ObjectID
+	if len(scope.DataScopeDepartments) > 0 {
+		ownDepts, cerr = getDataScopeDepartments(me)
+		if cerr != nil {
+			return cerr
+		}
+	}
+	if !dataScopeWithin(scope.DataScope, scope.DataScopeDepartments, me.DataScope, ownDepts) {
+		log.Errorf("roles exceed own data scope, me: %v, roles: %v", me.Id.Hex(), roleIds)
+		return &radarerror.ExceedAuthority
+	}
+	return nil
+}
+
+// 操作人在其他平台的权限集：按用户文档重新计算
+func platformAuthMp(me *ME, platform int64) (map[int64]int64, *radarerror.CommonError) {
+	svcUser := NewUserService(SystemME(me.Tenant))
+	user, cerr := svcUser.GetById(me.Id)
+	if cerr != nil {
+		return nil, cerr
+	}
+	platformMe, cerr := NewME(user, me.Version, platform)
+	if cerr != nil {
+		return nil, cerr
+	}
+	return platformMe.AuthMp, nil
+}
+
+// 权限集auths的每个权限动作都在own里
+func authsWithin(auths, own map[int64]int64) bool {
+	for obj, acts := range auths {
+		if own[obj]&acts != acts {
+			return false
+		}
+	}
+	return true
+}
+
+// 数据范围scope不大于own；custom指定的部门须在ownDepts（操作人可访问的部门）里
+func dataScopeWithin(scope string, deptIds []primitive.ObjectID, own string, ownDepts []primitive.ObjectID) bool {
+	if own == DataScopeAll {
+		return true
+	}
+	if dataScopeRank[scope] > dataScopeRank[own] {
+		return false
+	}
+	for _, id := range deptIds {
+		found := false
+		for _, ownId := range ownDepts {
+			if ownId == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
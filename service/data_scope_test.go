@@ -0,0 +1,123 @@
+package service
+
+import (
+	"testing"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestScopeUserFilter(t *testing.T) {
+	me := ME{Id: primitive.NewObjectID(), Department: primitive.NewObjectID()}
+
+	// 全部
+	me.DataScope = DataScopeAll
+	mFilter := bson.M{}
+	if cerr := scopeUserFilter(&me, mFilter); cerr != nil || len(mFilter) != 0 {
+		t.Fatalf("all scope should not filter: %v %v", mFilter, cerr)
+	}
+
+	// 仅本人
+	me.DataScope = DataScopeSelf
+	mFilter = bson.M{}
+	if cerr := scopeUserFilter(&me, mFilter); cerr != nil {
+		t.Fatal(cerr)
+	}
+	and := mFilter["$and"].([]bson.M)
+	if len(and) != 1 || and[0][modelbase.ColId] != me.Id {
+		t.Fatalf("unexpected self filter: %v", mFilter)
+	}
+
+	// 本部门，与已有的部门筛选条件同时生效
+	me.DataScope = DataScopeDepartment
+	other := primitive.NewObjectID()
+	mFilter = bson.M{model.ColUserDepartment: other}
+	if cerr := scopeUserFilter(&me, mFilter); cerr != nil {
+		t.Fatal(cerr)
+	}
+	if mFilter[model.ColUserDepartment] != other {
+		t.Fatalf("existing filter overwritten: %v", mFilter)
+	}
+	and = mFilter["$and"].([]bson.M)
+	or := and[0]["$or"].([]bson.M)
+	in := or[1][model.ColUserDepartment].(bson.M)["$in"].([]primitive.ObjectID)
+	if or[0][modelbase.ColId] != me.Id || len(in) != 1 || in[0] != me.Department {
+		t.Fatalf("unexpected department filter: %v", mFilter)
+	}
+
+	// 系统内部调用不受限制
+	mFilter = bson.M{}
+	if cerr := scopeUserFilter(&ME{}, mFilter); cerr != nil || len(mFilter) != 0 {
+		t.Fatalf("system call should not filter: %v %v", mFilter, cerr)
+	}
+}
+
+func TestCheckUserInScope(t *testing.T) {
+	allowed := primitive.NewObjectID()
+	me := ME{
+		Id:                   primitive.NewObjectID(),
+		DataScope:            DataScopeCustom,
+		DataScopeDepartments: []primitive.ObjectID{allowed},
+	}
+
+	user := model.User{DataModel: modelbase.DataModel{Id: primitive.NewObjectID()}, Department: allowed}
+	if cerr := CheckUserInScope(&me, user); cerr != nil {
+		t.Fatalf("user in custom department should be allowed: %v", cerr)
+	}
+
+	user.Department = primitive.NewObjectID()
+	if cerr := CheckUserInScope(&me, user); cerr != &radarerror.ExceedAuthority {
+		t.Fatalf("user out of custom departments should be rejected: %v", cerr)
+	}
+
+	// 本人总是可以访问
+	user.Id = me.Id
+	if cerr := CheckUserInScope(&me, user); cerr != nil {
+		t.Fatalf("self should be allowed: %v", cerr)
+	}
+}
+
+func TestMergeDataScope(t *testing.T) {
+	deptA := primitive.NewObjectID()
+	deptB := primitive.NewObjectID()
+	me := ME{DataScope: DataScopeSelf}
+
+	MergeDataScope(&me, DataScopeCustom, []primitive.ObjectID{deptA})
+	MergeDataScope(&me, DataScopeDepartment, nil)
+	MergeDataScope(&me, DataScopeCustom, []primitive.ObjectID{deptA, deptB})
+	MergeDataScope(&me, DataScopeSelf, nil)
+
+	if me.DataScope != DataScopeDepartment {
+		t.Fatalf("widest scope should win: %v", me.DataScope)
+	}
+	if len(me.DataScopeDepartments) != 2 {
+		t.Fatalf("custom departments should be merged: %v", me.DataScopeDepartments)
+	}
+}
+
+func TestRolesWithinMe(t *testing.T) {
+	own := map[int64]int64{1: 3, 2: 1}
+	if !authsWithin(map[int64]int64{1: 1, 2: 1}, own) {
+		t.Fatal("subset auths should be within")
+	}
+	if authsWithin(map[int64]int64{1: 4}, own) || authsWithin(map[int64]int64{3: 1}, own) {
+		t.Fatal("extra auths should not be within")
+	}
+
+	dept, other := primitive.NewObjectID(), primitive.NewObjectID()
+	if !dataScopeWithin(DataScopeAll, nil, DataScopeAll, nil) {
+		t.Fatal("all scope should cover everything")
+	}
+	if dataScopeWithin(DataScopeSubtree, nil, DataScopeDepartment, nil) {
+		t.Fatal("subtree should exceed department")
+	}
+	if !dataScopeWithin(DataScopeCustom, []primitive.ObjectID{dept}, DataScopeSubtree, []primitive.ObjectID{dept}) {
+		t.Fatal("custom departments within own should be within")
+	}
+	if dataScopeWithin(DataScopeCustom, []primitive.ObjectID{dept, other}, DataScopeSubtree, []primitive.ObjectID{dept}) {
+		t.Fatal("custom departments outside own should exceed")
+	}
+}
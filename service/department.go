@@ -0,0 +1,393 @@
+package service
+
+import (
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Department struct {
+	ME  ME
+	Dao model.DepartmentDao
+}
+
+func NewDepartmentService(me *ME) Department {
+	s := Department{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewDepartmentDao()
+	s.ME.bindDao(&s.Dao.DataDao)
+	return s
+}
+
+/*
+ * 获取department信息
+ */
+func (s *Department) GetById(id primitive.ObjectID) (model.Department, *radarerror.CommonError) {
+	var department model.Department
+	err := s.Dao.GetById(&department, id)
+	if err == mongo.ErrNoDocuments {
+		log.Errorf("department not found: %v", id.Hex())
+		return department, &radarerror.DepartmentNotFound
+	} else if err != nil {
+		log.Errorf("fail to get department: %v", err)
+		return department, &radarerror.InternalServerError
+	}
+	return department, nil
+}
+
+/*
+ * 获取部门id到部门名的映射，用于列表展示
+ */
+func (s *Department) GetNameMap(ids []primitive.ObjectID) (map[primitive.ObjectID]string, *radarerror.CommonError) {
+	var departments []model.Department
+	err := s.Dao.GetByIds(&departments, ids)
+	if err != nil {
+		log.Errorf("fail to get departments: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	names := make(map[primitive.ObjectID]string, len(departments))
+	for _, department := range departments {
+		names[department.Id] = department.Name
+	}
+	return names, nil
+}
+
+/*
+ * 获取全部部门，按同级排序
+ */
+func (s *Department) GetsAll() ([]model.Department, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	opts.SetSort(bson.D{{Key: model.ColDepartmentSort, Value: 1}, {Key: modelbase.ColId, Value: 1}})
+	var models []model.Department
+	err := s.Dao.Gets(&models, bson.M{}, opts)
+	if err != nil {
+		log.Errorf("fail to get departments: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return models, nil
+}
+
+/*
+ * 按名称获取顶级部门，不存在则创建
+ */
+func (s *Department) GetOrAddRoot(name string) (primitive.ObjectID, *radarerror.CommonError) {
+	filter := bson.M{
+		model.ColDepartmentParent: primitive.NilObjectID,
+		model.ColDepartmentName:   name,
+	}
+	var department model.Department
+	err := s.Dao.Get(&department, filter)
+	if err == nil {
+		return department.Id, nil
+	} else if err != mongo.ErrNoDocuments {
+		log.Errorf("fail to get department: %v", err)
+		return primitive.NilObjectID, &radarerror.InternalServerError
+	}
+	return s.Add(model.Department{Name: name})
+}
+
+/*
+ * 获取部门及其所有下级部门的id
+ */
+func (s *Department) GetSubtreeIds(id primitive.ObjectID) ([]primitive.ObjectID, *radarerror.CommonError) {
+	filter := bson.M{
+		model.ColDepartmentAncestors: id,
+	}
+	var models []model.Department
+	err := s.Dao.Gets(&models, filter)
+	if err != nil {
+		log.Errorf("fail to get departments: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	ids := make([]primitive.ObjectID, 0, len(models)+1)
+	ids = append(ids, id)
+	for _, department := range models {
+		ids = append(ids, department.Id)
+	}
+	return ids, nil
+}
+
+// 部门树节点
+type DepartmentNode struct {
+	Id             primitive.ObjectID
+	Name           string
+	Parent         primitive.ObjectID
+	Sort           int64
+	UserCount      int64             // 本部门用户数
+	TotalUserCount int64             // 本部门及所有下级部门用户数
+	Children       []*DepartmentNode // 下级部门，按同级排序
+}
+
+/*
+ * 获取部门树，附带各节点的用户数
+ */
+func (s *Department) GetTree() ([]*DepartmentNode, *radarerror.CommonError) {
+	departments, cerr := s.GetsAll()
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	svcUser := NewUserService(&s.ME)
+	userCounts, cerr := svcUser.CountByDepartment()
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	return buildDepartmentTree(departments, userCounts), nil
+}
+
+/*
+ * 按上级部门组装部门树，departments需已按同级排序
+ */
+func buildDepartmentTree(departments []model.Department, userCounts map[primitive.ObjectID]int64) []*DepartmentNode {
+	nodes := make(map[primitive.ObjectID]*DepartmentNode, len(departments))
+	for _, department := range departments {
+		nodes[department.Id] = &DepartmentNode{
+			Id:        department.Id,
+			Name:      department.Name,
+			Parent:    department.Parent,
+			Sort:      department.Sort,
+			UserCount: userCounts[department.Id],
+			Children:  []*DepartmentNode{},
+		}
+	}
+
+	roots := make([]*DepartmentNode, 0)
+	for _, department := range departments {
+		node := nodes[department.Id]
+		if parent, ok := nodes[department.Parent]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	for _, root := range roots {
+		sumUserCount(root)
+	}
+	return roots
+}
+
+func sumUserCount(node *DepartmentNode) int64 {
+	node.TotalUserCount = node.UserCount
+	for _, child := range node.Children {
+		node.TotalUserCount += sumUserCount(child)
+	}
+	return node.TotalUserCount
+}
+
+/*
+ * 检查同级部门下是否重名
+ */
+func (s *Department) checkDuplicatedName(parent primitive.ObjectID, name string, excludeId primitive.ObjectID) *radarerror.CommonError {
+	filter := bson.M{
+		model.ColDepartmentParent: parent,
+		model.ColDepartmentName:   name,
+		modelbase.ColId:           bson.M{"$ne": excludeId},
+	}
+	count, err := s.Dao.GetCount(filter)
+	if err != nil {
+		log.Errorf("fail to get department count: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if count > 0 {
+		log.Errorf("duplicated department name: %v", name)
+		return &radarerror.DuplicatedDepartmentName
+	}
+	return nil
+}
+
+/*
+ * 获取上级部门下新节点的id路径
+ */
+func (s *Department) getAncestors(parent primitive.ObjectID) ([]primitive.ObjectID, *radarerror.CommonError) {
+	if parent == primitive.NilObjectID {
+		return []primitive.ObjectID{}, nil
+	}
+	parentDepartment, cerr := s.GetById(parent)
+	if cerr != nil {
+		return nil, cerr
+	}
+	ancestors := make([]primitive.ObjectID, 0, len(parentDepartment.Ancestors)+1)
+	ancestors = append(ancestors, parentDepartment.Ancestors...)
+	ancestors = append(ancestors, parent)
+	return ancestors, nil
+}
+
+/*
+ * 添加
+ */
+func (s *Department) Add(department model.Department) (primitive.ObjectID, *radarerror.CommonError) {
+	if department.Name == "" {
+		log.Errorf("department name cannot empty")
+		return primitive.NilObjectID, &radarerror.InvalidArgs
+	}
+
+	ancestors, cerr := s.getAncestors(department.Parent)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+	department.Ancestors = ancestors
+
+	cerr = s.checkDuplicatedName(department.Parent, department.Name, primitive.NilObjectID)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+
+	id, err := s.Dao.Add(s.ME.Id, department)
+	if err != nil {
+		log.Errorf("fail to add department: %v", err)
+		return primitive.NilObjectID, &radarerror.InternalServerError
+	}
+	return id, nil
+}
+
+type SetDepartment struct {
+	Name   *string `json:"name"`   // 部门名
+	Parent *string `json:"parent"` // 上级部门id，传空串表示移到顶级
+	Sort   *int64  `json:"sort"`   // 同级排序
+}
+
+/*
+ * 编辑：重命名、移动、调整排序
+ */
+func (s *Department) Update(id primitive.ObjectID, setCVs SetDepartment) *radarerror.CommonError {
+	department, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+
+	update := bson.M{"$set": bson.M{}}
+
+	name := department.Name
+	if setCVs.Name != nil {
+		if *setCVs.Name == "" {
+			log.Errorf("department name cannot empty")
+			return &radarerror.InvalidArgs
+		}
+		name = *setCVs.Name
+		update["$set"].(bson.M)[model.ColDepartmentName] = name
+	}
+
+	parent := department.Parent
+	var ancestors []primitive.ObjectID
+	if setCVs.Parent != nil {
+		parent = primitive.NilObjectID
+		if *setCVs.Parent != "" {
+			parent = mongodao.Hex2Id(*setCVs.Parent)
+			if parent == primitive.NilObjectID {
+				log.Errorf("invalid parent: %v", *setCVs.Parent)
+				return &radarerror.InvalidArgs
+			}
+		}
+		ancestors, cerr = s.getAncestors(parent)
+		if cerr != nil {
+			return cerr
+		}
+		// 不能移动到自己或自己的下级部门下
+		for _, ancestor := range ancestors {
+			if ancestor == id {
+				log.Errorf("cannot move department under itself: %v", id.Hex())
+				return &radarerror.InvalidArgs
+			}
+		}
+		update["$set"].(bson.M)[model.ColDepartmentParent] = parent
+		update["$set"].(bson.M)[model.ColDepartmentAncestors] = ancestors
+	}
+
+	if setCVs.Name != nil || setCVs.Parent != nil {
+		cerr = s.checkDuplicatedName(parent, name, id)
+		if cerr != nil {
+			return cerr
+		}
+	}
+	if setCVs.Sort != nil {
+		update["$set"].(bson.M)[model.ColDepartmentSort] = *setCVs.Sort
+	}
+
+	_, err := s.Dao.UpdateById(s.ME.Id, id, update)
+	if err != nil {
+		log.Errorf("fail to update department: %v", err)
+		return &radarerror.InternalServerError
+	}
+
+	// 移动后，所有下级部门的id路径随之变化
+	if setCVs.Parent != nil {
+		cerr = s.rebuildDescendantAncestors(id, append(ancestors, id))
+		if cerr != nil {
+			return cerr
+		}
+	}
+	return nil
+}
+
+func (s *Department) rebuildDescendantAncestors(id primitive.ObjectID, prefix []primitive.ObjectID) *radarerror.CommonError {
+	filter := bson.M{
+		model.ColDepartmentAncestors: id,
+	}
+	var descendants []model.Department
+	err := s.Dao.Gets(&descendants, filter)
+	if err != nil {
+		log.Errorf("fail to get departments: %v", err)
+		return &radarerror.InternalServerError
+	}
+
+	for _, descendant := range descendants {
+		ancestors := make([]primitive.ObjectID, 0, len(descendant.Ancestors)+len(prefix))
+		ancestors = append(ancestors, prefix...)
+		for i, ancestor := range descendant.Ancestors {
+			if ancestor == id {
+				ancestors = append(ancestors, descendant.Ancestors[i+1:]...)
+				break
+			}
+		}
+		update := bson.M{"$set": bson.M{model.ColDepartmentAncestors: ancestors}}
+		_, err = s.Dao.UpdateById(s.ME.Id, descendant.Id, update)
+		if err != nil {
+			log.Errorf("fail to update department: %v", err)
+			return &radarerror.InternalServerError
+		}
+	}
+	return nil
+}
+
+/*
+ * 删除
+ * 部门下仍有下级部门或用户时不允许删除
+ */
+func (s *Department) Delete(id primitive.ObjectID) *radarerror.CommonError {
+	_, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+
+	childCount, err := s.Dao.GetCount(bson.M{model.ColDepartmentParent: id})
+	if err != nil {
+		log.Errorf("fail to get department count: %v", err)
+		return &radarerror.InternalServerError
+	}
+	// 不受操作人数据范围限制，统计租户内全部用户
+	svcUser := NewUserService(SystemME(s.ME.Tenant))
+	userCount, cerr := svcUser.GetCount(FilterUser{Department: &id})
+	if cerr != nil {
+		return cerr
+	}
+	if childCount > 0 || userCount > 0 {
+		log.Errorf("department not empty: %v, children: %v, users: %v", id.Hex(), childCount, userCount)
+		return &radarerror.DepartmentNotEmpty
+	}
+
+	_, err = s.Dao.DelById(s.ME.Id, id)
+	if err != nil {
+		log.Errorf("fail to delete department: %v", err)
+		return &radarerror.InternalServerError
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBuildDepartmentTree(t *testing.T) {
+	root := primitive.NewObjectID()
+	child := primitive.NewObjectID()
+	grandChild := primitive.NewObjectID()
+	orphan := primitive.NewObjectID()
+
+	departments := []model.Department{
+		{DataModel: modelbase.DataModel{Id: root}, Name: "root"},
+		{DataModel: modelbase.DataModel{Id: child}, Name: "child", Parent: root},
+		{DataModel: modelbase.DataModel{Id: grandChild}, Name: "grand child", Parent: child},
+		{DataModel: modelbase.DataModel{Id: orphan}, Name: "orphan", Parent: primitive.NewObjectID()},
+	}
+	userCounts := map[primitive.ObjectID]int64{
+		root:       1,
+		child:      2,
+		grandChild: 3,
+	}
+
+	roots := buildDepartmentTree(departments, userCounts)
+	if len(roots) != 2 {
+		t.Fatalf("expect 2 roots, got %v", len(roots))
+	}
+	if roots[0].Id != root || roots[1].Id != orphan {
+		t.Fatalf("unexpected roots order: %v, %v", roots[0].Name, roots[1].Name)
+	}
+	if roots[0].TotalUserCount != 6 {
+		t.Errorf("expect root total 6, got %v", roots[0].TotalUserCount)
+	}
+	if len(roots[0].Children) != 1 || roots[0].Children[0].TotalUserCount != 5 {
+		t.Errorf("unexpected child subtree: %+v", roots[0].Children)
+	}
+	if roots[1].TotalUserCount != 0 {
+		t.Errorf("expect orphan total 0, got %v", roots[1].TotalUserCount)
+	}
+}
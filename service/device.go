@@ -0,0 +1,208 @@
+package service
+
+import (
+	"crypto/hmac"
+	"strings"
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	"github.com/SeeJson/account/util/crypt"
+	mstring "github.com/SeeJson/account/util/string"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	deviceIdLen = 16 // 设备标识的字节数
+)
+
+type DeviceConfig struct {
+	SignKey        string `mapstructure:"sign_key"`        // 设备令牌的签名密钥
+	RequireCaptcha bool   `mapstructure:"require_captcha"` // 新设备登录是否必须输入验证码
+	MaxAge         int    `mapstructure:"max_age"`         // 设备cookie有效期，单位：秒
+}
+
+var deviceCfg DeviceConfig
+
+func SetDeviceConfig(c DeviceConfig) {
+	deviceCfg = c
+}
+
+func GetDeviceConfig() DeviceConfig {
+	return deviceCfg
+}
+
+type Device struct {
+	ME  ME
+	Dao model.DeviceDao
+}
+
+func NewDeviceService(me *ME) Device {
+	s := Device{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewDeviceDao()
+	s.ME.bindDao(&s.Dao.DataDao)
+	return s
+}
+
+/*
+ * 获取用户的指定设备
+ */
+func (s *Device) GetByDeviceId(userId primitive.ObjectID, deviceId string) (model.Device, *radarerror.CommonError) {
+	filter := bson.M{
+		model.ColDeviceUser:     userId,
+		model.ColDeviceDeviceId: deviceId,
+	}
+	var device model.Device
+	err := s.Dao.Get(&device, filter)
+	if err == mongo.ErrNoDocuments {
+		return device, &radarerror.DeviceNotFound
+	} else if err != nil {
+		log.Errorf("fail to get device: %v", err)
+		return device, &radarerror.InternalServerError
+	}
+	return device, nil
+}
+
+/*
+ * 获取用户的受信任设备列表
+ */
+func (s *Device) GetsByUser(userId primitive.ObjectID) ([]model.Device, *radarerror.CommonError) {
+	filter := bson.M{
+		model.ColDeviceUser: userId,
+	}
+	opts := &options.FindOptions{}
+	opts.SetSort(bson.M{model.ColDeviceLastSeen: -1})
+	var models []model.Device
+	err := s.Dao.Gets(&models, filter, opts)
+	if err != nil {
+		log.Errorf("fail to get devices: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return models, nil
+}
+
+/*
+ * 检查是否新设备登录
+ * 新设备且配置了必须验证码时，未通过验证码校验的登录会被拒绝
+ */
+func (s *Device) CheckNewDevice(userId primitive.ObjectID, deviceId string, captchaVerified bool) (bool, *radarerror.CommonError) {
+	isNew := true
+	if deviceId != "" {
+		_, cerr := s.GetByDeviceId(userId, deviceId)
+		if cerr == nil {
+			isNew = false
+		} else if cerr != &radarerror.DeviceNotFound {
+			return false, cerr
+		}
+	}
+
+	if isNew && deviceCfg.RequireCaptcha && !captchaVerified {
+		log.Errorf("new device need captcha: %v", userId.Hex())
+		return isNew, &radarerror.NewDeviceNeedCaptcha
+	}
+	return isNew, nil
+}
+
+/*
+ * 登录成功后记录设备，返回签名后的设备令牌
+ * 首次出现的设备会发布新设备通知事件
+ */
+func (s *Device) Trust(userId primitive.ObjectID, deviceId, userAgent, ip string) (string, *radarerror.CommonError) {
+	now := time.Now()
+
+	if deviceId != "" {
+		device, cerr := s.GetByDeviceId(userId, deviceId)
+		if cerr == nil {
+			update := bson.M{
+				"$set": bson.M{
+					model.ColDeviceUserAgent: userAgent,
+					model.ColDeviceIp:        ip,
+					model.ColDeviceLastSeen:  now,
+				},
+			}
+			_, err := s.Dao.UpdateById(s.ME.Id, device.Id, update)
+			if err != nil {
+				log.Errorf("fail to update device: %v", err)
+				return "", &radarerror.InternalServerError
+			}
+			return SignDeviceToken(deviceId), nil
+		} else if cerr != &radarerror.DeviceNotFound {
+			return "", cerr
+		}
+	} else {
+		var err error
+		deviceId, err = mstring.GetRandomHex(deviceIdLen)
+		if err != nil {
+			log.Errorf("fail to generate device id: %v", err)
+			return "", &radarerror.InternalServerError
+		}
+	}
+
+	device := model.Device{
+		User:      userId,
+		DeviceId:  deviceId,
+		UserAgent: userAgent,
+		Ip:        ip,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+	_, err := s.Dao.Add(s.ME.Id, device)
+	if err != nil {
+		log.Errorf("fail to add device: %v", err)
+		return "", &radarerror.InternalServerError
+	}
+
+	PublishEvent(EventNewDevice, userId, map[string]interface{}{
+		"user_agent": userAgent,
+		"ip":         ip,
+	})
+
+	return SignDeviceToken(deviceId), nil
+}
+
+/*
+ * 移除用户的受信任设备
+ */
+func (s *Device) Delete(userId primitive.ObjectID, id primitive.ObjectID) *radarerror.CommonError {
+	filter := bson.M{
+		modelbase.ColId:     id,
+		model.ColDeviceUser: userId,
+	}
+	deletedCount, err := s.Dao.Del(s.ME.Id, filter)
+	if err != nil {
+		log.Errorf("fail to delete device: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if deletedCount == 0 {
+		return &radarerror.DeviceNotFound
+	}
+	return nil
+}
+
+/***** 辅助函数 *****/
+
+// 设备令牌格式：{device id}.{签名}
+func SignDeviceToken(deviceId string) string {
+	return deviceId + "." + crypt.CalHmacSha256(deviceCfg.SignKey, deviceId)
+}
+
+// 校验设备令牌，返回设备标识；签名不符返回空串
+func ParseDeviceToken(token string) string {
+	fields := strings.Split(token, ".")
+	if len(fields) != 2 || fields[0] == "" {
+		return ""
+	}
+	if !hmac.Equal([]byte(SignDeviceToken(fields[0])), []byte(token)) {
+		log.Errorf("invalid device token: %v", token)
+		return ""
+	}
+	return fields[0]
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	redisdao "github.com/SeeJson/account/util/redis"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	EventNewDevice = "new_device" // 新设备登录
+)
+
+type EventConfig struct {
+	Channel string `mapstructure:"channel"` // 发布事件的redis频道，为空则只记录日志
+}
+
+var eventCfg EventConfig
+
+func SetEventConfig(c EventConfig) {
+	eventCfg = c
+}
+
+// 通知事件
+type Event struct {
+	Type   string      `json:"type"`    // 事件类型
+	UserId string      `json:"user_id"` // 相关用户id
+	Time   int64       `json:"time"`    // 发生时间-时间戳
+	Data   interface{} `json:"data"`    // 事件内容
+}
+
+/*
+ * 发布通知事件，由订阅方（消息中心、邮件短信等）负责送达
+ */
+func PublishEvent(eventType string, userId primitive.ObjectID, data interface{}) {
+	event := Event{
+		Type:   eventType,
+		UserId: userId.Hex(),
+		Time:   time.Now().Unix(),
+		Data:   data,
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("fail to marshal event: %v", err)
+		return
+	}
+	log.Infof("event: %v", string(b))
+
+	if eventCfg.Channel == "" {
+		return
+	}
+	err = redisdao.Publish(eventCfg.Channel, string(b))
+	if err != nil {
+		log.Errorf("fail to publish event: %v", err)
+	}
+}
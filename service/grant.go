@@ -0,0 +1,363 @@
+package service
+
+import (
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type GrantConfig struct {
+	CheckInterval int `mapstructure:"check_interval"` // 检查临时授权生效、到期的间隔，单位：秒
+}
+
+var grantCfg GrantConfig
+
+func SetGrantConfig(c GrantConfig) {
+	grantCfg = c
+}
+
+type Grant struct {
+	ME  ME
+	Dao model.GrantDao
+}
+
+func NewGrantService(me *ME) Grant {
+	s := Grant{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewGrantDao()
+	s.ME.bindDao(&s.Dao.DataDao)
+	return s
+}
+
+/*
+ * 获取临时授权
+ */
+func (s *Grant) GetById(id primitive.ObjectID) (model.Grant, *radarerror.CommonError) {
+	var grant model.Grant
+	err := s.Dao.GetById(&grant, id)
+	if err == mongo.ErrNoDocuments {
+		log.Errorf("grant not found: %v", id.Hex())
+		return grant, &radarerror.GrantNotFound
+	} else if err != nil {
+		log.Errorf("fail to get grant: %v", err)
+		return grant, &radarerror.InternalServerError
+	}
+	return grant, nil
+}
+
+/*
+ * 获取用户未撤销的临时授权，包括尚未生效的
+ */
+func (s *Grant) GetsByUser(userId primitive.ObjectID) ([]model.Grant, *radarerror.CommonError) {
+	svcUser := NewUserService(&s.ME)
+	user, cerr := svcUser.GetById(userId)
+	if cerr != nil {
+		return nil, cerr
+	}
+	cerr = CheckUserInScope(&s.ME, user)
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	filter := bson.M{
+		model.ColGrantUser: userId,
+	}
+	opts := &options.FindOptions{}
+	opts.SetSort(bson.M{model.ColGrantStartTime: 1})
+	grants := make([]model.Grant, 0)
+	err := s.Dao.Gets(&grants, filter, opts)
+	if err != nil {
+		log.Errorf("fail to get grants: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return grants, nil
+}
+
+/*
+ * 获取用户当前有效的临时授权
+ */
+func (s *Grant) GetsActiveByUser(userId primitive.ObjectID) ([]model.Grant, *radarerror.CommonError) {
+	now := time.Now()
+	filter := bson.M{
+		model.ColGrantUser:       userId,
+		model.ColGrantStartTime:  bson.M{"$lte": now},
+		model.ColGrantExpireTime: bson.M{"$gt": now},
+	}
+	grants := make([]model.Grant, 0)
+	err := s.Dao.Gets(&grants, filter)
+	if err != nil {
+		log.Errorf("fail to get grants: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return grants, nil
+}
+
+/*
+ * 获取用户未到期的临时授权，包括尚未生效的
+ */
+func (s *Grant) GetsUnexpiredByUser(userId primitive.ObjectID) ([]model.Grant, *radarerror.CommonError) {
+	filter := bson.M{
+		model.ColGrantUser:       userId,
+		model.ColGrantExpireTime: bson.M{"$gt": time.Now()},
+	}
+	grants := make([]model.Grant, 0)
+	err := s.Dao.Gets(&grants, filter)
+	if err != nil {
+		log.Errorf("fail to get grants: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return grants, nil
+}
+
+/*
+ * 获取租户内全部当前有效的临时授权
+ */
+func (s *Grant) GetsActive() ([]model.Grant, *radarerror.CommonError) {
+	now := time.Now()
+	filter := bson.M{
+		model.ColGrantStartTime:  bson.M{"$lte": now},
+		model.ColGrantExpireTime: bson.M{"$gt": now},
+	}
+	grants := make([]model.Grant, 0)
+	err := s.Dao.Gets(&grants, filter)
+	if err != nil {
+		log.Errorf("fail to get grants: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return grants, nil
+}
+
+/*
+ * 获取附加了指定角色的有效临时授权
+ */
+func (s *Grant) GetsActiveByRole(roleId primitive.ObjectID) ([]model.Grant, *radarerror.CommonError) {
+	now := time.Now()
+	filter := bson.M{
+		model.ColGrantRoles:      roleId,
+		model.ColGrantStartTime:  bson.M{"$lte": now},
+		model.ColGrantExpireTime: bson.M{"$gt": now},
+	}
+	grants := make([]model.Grant, 0)
+	err := s.Dao.Gets(&grants, filter)
+	if err != nil {
+		log.Errorf("fail to get grants: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return grants, nil
+}
+
+/*
+ * 新增临时授权
+ * 不能给自己授权，直接授予的权限和角色不能超出自己拥有的
+ */
+func (s *Grant) Add(grant model.Grant) (primitive.ObjectID, *radarerror.CommonError) {
+	if !authsWithin(grant.Auths, s.ME.AuthMp) {
+		log.Errorf("grant auths exceed own: %v", grant.Auths)
+		return primitive.NilObjectID, &radarerror.ExceedAuthority
+	}
+	// 授予的角色（含继承的上级角色）同样不能超出自己的权限和数据范围
+	cerr := CheckRolesWithinMe(&s.ME, grant.Roles)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+	return s.add(grant)
+}
+
+/*
+ * 新增临时授权，审批通过的申请直接调用，权限来自审批流程
+ * 已生效的授权会刷新用户的session版本号，用户重新登录后获得权限
+ */
+func (s *Grant) add(grant model.Grant) (primitive.ObjectID, *radarerror.CommonError) {
+	var id primitive.ObjectID
+	if grant.User == s.ME.Id {
+		log.Errorf("grant to self: %v", s.ME.Id.Hex())
+		return id, &radarerror.ExceedAuthority
+	}
+	if len(grant.Auths) == 0 && len(grant.Roles) == 0 {
+		log.Errorf("empty grant")
+		return id, &radarerror.InvalidArgs
+	}
+	now := time.Now()
+	if grant.StartTime.IsZero() {
+		grant.StartTime = now
+	}
+	if !grant.ExpireTime.After(grant.StartTime) || !grant.ExpireTime.After(now) {
+		log.Errorf("invalid grant time: %v - %v", grant.StartTime, grant.ExpireTime)
+		return id, &radarerror.InvalidGrantTime
+	}
+
+	// 用户须在数据范围内
+	svcUser := NewUserService(&s.ME)
+	user, cerr := svcUser.GetById(grant.User)
+	if cerr != nil {
+		return id, cerr
+	}
+	cerr = CheckUserInScope(&s.ME, user)
+	if cerr != nil {
+		return id, cerr
+	}
+
+	// 角色
+	if len(grant.Roles) > 0 {
+		svcRole := NewRoleService(&s.ME)
+		grant.Roles, cerr = svcRole.CheckIds(grant.Roles)
+		if cerr != nil {
+			return id, cerr
+		}
+	}
+
+	// 职责分离：用户的角色加上全部未到期的临时授权（含本次）不能违反约束
+	grants, cerr := s.GetsUnexpiredByUser(grant.User)
+	if cerr != nil {
+		return id, cerr
+	}
+	roleIds, grantAuths := mergeGrantHoldings(user.Roles, append(grants, grant))
+	cerr = CheckSodRoles(s.ME.Tenant, roleIds, grantAuths)
+	if cerr != nil {
+		return id, cerr
+	}
+
+	grant.Activated = !grant.StartTime.After(now)
+	id, err := s.Dao.Add(s.ME.Id, grant)
+	if err != nil {
+		log.Errorf("fail to add grant: %v", err)
+		return id, &radarerror.InternalServerError
+	}
+	if grant.Activated {
+		RefreshSessionVersion(grant.User)
+	}
+	return id, nil
+}
+
+/*
+ * 撤销临时授权
+ */
+func (s *Grant) Revoke(id primitive.ObjectID) *radarerror.CommonError {
+	grant, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+	svcUser := NewUserService(&s.ME)
+	user, cerr := svcUser.GetById(grant.User)
+	if cerr != nil && cerr != &radarerror.UserNotFound {
+		return cerr
+	}
+	if cerr == nil {
+		cerr = CheckUserInScope(&s.ME, user)
+		if cerr != nil {
+			return cerr
+		}
+	}
+
+	_, err := s.Dao.DelById(s.ME.Id, id)
+	if err != nil {
+		log.Errorf("fail to revoke grant: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if grant.Activated {
+		RefreshSessionVersion(grant.User)
+	}
+	return nil
+}
+
+/*
+ * 生效到达生效时间的临时授权，撤销已到期的临时授权，并刷新相关用户的session版本号
+ */
+func (s *Grant) CheckExpiry() *radarerror.CommonError {
+	now := time.Now()
+
+	// 到期
+	var expired []model.Grant
+	err := s.Dao.Gets(&expired, bson.M{model.ColGrantExpireTime: bson.M{"$lte": now}})
+	if err != nil {
+		log.Errorf("fail to get expired grants: %v", err)
+		return &radarerror.InternalServerError
+	}
+	ids := make([]primitive.ObjectID, 0, len(expired))
+	for _, grant := range expired {
+		ids = append(ids, grant.Id)
+	}
+	if len(ids) > 0 {
+		_, err = s.Dao.DelByIds(s.ME.Id, ids)
+		if err != nil {
+			log.Errorf("fail to revoke expired grants: %v", err)
+			return &radarerror.InternalServerError
+		}
+		for _, grant := range expired {
+			log.Infof("grant expired: %v, user: %v", grant.Id.Hex(), grant.User.Hex())
+			if grant.Activated {
+				RefreshSessionVersion(grant.User)
+			}
+		}
+	}
+
+	// 生效
+	var started []model.Grant
+	err = s.Dao.Gets(&started, bson.M{
+		model.ColGrantStartTime: bson.M{"$lte": now},
+		model.ColGrantActivated: false,
+	})
+	if err != nil {
+		log.Errorf("fail to get started grants: %v", err)
+		return &radarerror.InternalServerError
+	}
+	for _, grant := range started {
+		_, err = s.Dao.UpdateById(s.ME.Id, grant.Id, bson.M{"$set": bson.M{model.ColGrantActivated: true}})
+		if err != nil {
+			log.Errorf("fail to activate grant: %v", err)
+			return &radarerror.InternalServerError
+		}
+		log.Infof("grant activated: %v, user: %v", grant.Id.Hex(), grant.User.Hex())
+		RefreshSessionVersion(grant.User)
+	}
+	return nil
+}
+
+/*
+ * 后台定时逐个租户检查临时授权
+ */
+func RunGrantJob() {
+	interval := time.Duration(grantCfg.CheckInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		tenants, cerr := TenantUids()
+		if cerr != nil {
+			log.Errorf("fail to get tenants: %v", cerr)
+		}
+		for _, tenant := range tenants {
+			svcGrant := NewGrantService(SystemME(tenant))
+			cerr = svcGrant.CheckExpiry()
+			if cerr != nil {
+				log.Errorf("fail to check grants of tenant %v: %v", tenant, cerr)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+/*
+ * 把用户当前有效的临时授权合并到会话，返回临时授权附加的角色id
+ * 临时授权的权限集属于账号中心，其他平台的会话只取附加的角色
+ */
+func mergeGrants(me *ME, grants []model.Grant) []primitive.ObjectID {
+	var roleIds []primitive.ObjectID
+	for _, grant := range grants {
+		if me.Platform == 0 {
+			MergeAuthMp(me.AuthMp, grant.Auths)
+		}
+		roleIds = append(roleIds, grant.Roles...)
+	}
+	return roleIds
+}
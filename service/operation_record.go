@@ -0,0 +1,149 @@
+package service
+
+import (
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OperationRecord struct {
+	ME  ME
+	Dao model.OperationRecordDao
+}
+
+func NewOperationRecordService(me *ME) OperationRecord {
+	s := OperationRecord{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewOperationRecordDao()
+	s.ME.bindDao(&s.Dao.DataDao)
+	return s
+}
+
+/*
+ * 新增操作记录，操作人须是本租户的用户，记录操作时的账号、姓名和部门
+ */
+func (s *OperationRecord) Add(record model.OperationRecord) (primitive.ObjectID, *radarerror.CommonError) {
+	if record.Module <= 0 || record.Desc == "" {
+		log.Errorf("invalid operation record: %+v", record)
+		return primitive.NilObjectID, &radarerror.InvalidArgs
+	}
+
+	svcUser := NewUserService(SystemME(s.ME.Tenant))
+	user, cerr := svcUser.GetById(record.User)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+	record.UserAccount = user.Account
+	record.UserName = user.Name
+	record.Department = user.Department
+
+	id, err := s.Dao.AddChained(s.ME.Id, record)
+	if err != nil {
+		log.Errorf("fail to add operation record: %v", err)
+		return primitive.NilObjectID, &radarerror.InternalServerError
+	}
+	return id, nil
+}
+
+type FilterOperationRecord struct {
+	User       *primitive.ObjectID // 操作人id
+	Department *primitive.ObjectID // 操作时所在的部门id
+	Module     *int64              // 模块id
+	Service    *string             // 来源服务名
+	Time       *TimeRange          // 操作时间，结束时间为0表示不限
+}
+
+func (s *OperationRecord) ConvertFilter(filter FilterOperationRecord) bson.M {
+	mFilter := bson.M{}
+	if filter.User != nil {
+		mFilter[model.ColOperationRecordUser] = *filter.User
+	}
+	if filter.Department != nil {
+		mFilter[model.ColOperationRecordDepartment] = *filter.Department
+	}
+	if filter.Module != nil {
+		mFilter[model.ColOperationRecordModule] = *filter.Module
+	}
+	if filter.Service != nil {
+		mFilter[model.ColOperationRecordService] = *filter.Service
+	}
+	if filter.Time != nil {
+		cond := bson.M{"$gte": time.Unix(filter.Time.Start, 0)}
+		if filter.Time.End > 0 {
+			cond["$lte"] = time.Unix(filter.Time.End, 0)
+		}
+		mFilter[modelbase.ColCreateTime] = cond
+	}
+	return mFilter
+}
+
+/*
+ * 根据筛选条件分页获取，按操作时间倒序
+ * 注意：page是从0开始
+ */
+func (s *OperationRecord) Gets(page, pageSize int64, filter FilterOperationRecord) ([]model.OperationRecord, *radarerror.CommonError) {
+	mFilter := s.ConvertFilter(filter)
+	cerr := s.scopeFilter(mFilter)
+	if cerr != nil {
+		return nil, cerr
+	}
+	opts := &options.FindOptions{}
+	if pageSize > 0 {
+		opts.SetLimit(pageSize)
+	}
+	opts.SetSkip(page * pageSize)
+	opts.SetSort(bson.M{modelbase.ColId: -1})
+	records := make([]model.OperationRecord, 0)
+	err := s.Dao.Gets(&records, mFilter, opts)
+	if err != nil {
+		log.Errorf("fail to get operation records: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return records, nil
+}
+
+/*
+ * 根据筛选条件获取结果集总数
+ */
+func (s *OperationRecord) GetCount(filter FilterOperationRecord) (int64, *radarerror.CommonError) {
+	mFilter := s.ConvertFilter(filter)
+	cerr := s.scopeFilter(mFilter)
+	if cerr != nil {
+		return 0, cerr
+	}
+	count, err := s.Dao.GetCount(mFilter)
+	if err != nil {
+		log.Errorf("fail to get operation record count: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	return count, nil
+}
+
+// 数据范围：本人的记录，以及操作时所在部门在数据范围内的记录
+func (s *OperationRecord) scopeFilter(mFilter bson.M) *radarerror.CommonError {
+	if !isDataScoped(&s.ME) {
+		return nil
+	}
+	deptIds, cerr := getDataScopeDepartments(&s.ME)
+	if cerr != nil {
+		return cerr
+	}
+	cond := bson.M{model.ColOperationRecordUser: s.ME.Id}
+	if len(deptIds) > 0 {
+		cond = bson.M{"$or": []bson.M{
+			cond,
+			{model.ColOperationRecordDepartment: bson.M{"$in": deptIds}},
+		}}
+	}
+	and, _ := mFilter["$and"].([]bson.M)
+	mFilter["$and"] = append(and, cond)
+	return nil
+}
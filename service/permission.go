@@ -0,0 +1,322 @@
+package service
+
+import (
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// 权限判定原因
+	PermReasonAllowed        = "allowed"             // 允许
+	PermReasonUserNotFound   = "user_not_found"      // 用户不存在
+	PermReasonNoPermission   = "no_permission"       // 角色没有该权限
+	PermReasonOutOfDataScope = "out_of_data_scope"   // 目标部门不在数据范围内
+	PermReasonUserDeleted    = "user_deleted"        // 用户已删除
+	PermReasonNeedResetPwd   = "need_reset_password" // 未重设初始密码
+
+	// 账号状态
+	UserStatusActive   = "active"
+	UserStatusDeleted  = "deleted"
+	UserStatusNotFound = "not_found"
+)
+
+type PermDecision struct {
+	Allowed bool
+	Reason  string
+}
+
+type EffectivePermissions struct {
+	Auths       map[int64]int64      // 合并继承角色后的权限
+	DataScope   string               // 数据范围
+	Departments []primitive.ObjectID // 数据范围内的部门id，范围为all时为空
+	Roles       []string             // 角色名
+}
+
+/*
+ * 按用户当前在某平台的角色（含继承）和数据范围判定是否拥有权限，用户须属于租户tenant
+ * deptId为空时不校验数据范围
+ */
+func CheckPermission(tenant int64, userId primitive.ObjectID, platform, obj, act int64, deptId primitive.ObjectID) (PermDecision, *radarerror.CommonError) {
+	me, decision, cerr := loadPermME(tenant, userId, platform)
+	if cerr != nil || !decision.Allowed {
+		return decision, cerr
+	}
+	return decidePermission(&me, obj, act, deptId)
+}
+
+/*
+ * 在已加载的会话上判定权限
+ */
+func decidePermission(me *ME, obj, act int64, deptId primitive.ObjectID) (PermDecision, *radarerror.CommonError) {
+	if me.AuthMp[obj]&act != act {
+		return PermDecision{Allowed: false, Reason: PermReasonNoPermission}, nil
+	}
+	if deptId != primitive.NilObjectID {
+		cerr := CheckDepartmentInScope(me, deptId)
+		if cerr == &radarerror.ExceedAuthority {
+			return PermDecision{Allowed: false, Reason: PermReasonOutOfDataScope}, nil
+		} else if cerr != nil {
+			return PermDecision{}, cerr
+		}
+	}
+	return PermDecision{Allowed: true, Reason: PermReasonAllowed}, nil
+}
+
+/*
+ * 获取用户在某平台的有效权限：该平台各角色及继承角色的权限并集和数据范围
+ */
+func GetEffectivePermissions(tenant int64, userId primitive.ObjectID, platform int64) (EffectivePermissions, *radarerror.CommonError) {
+	var perms EffectivePermissions
+	me, decision, cerr := loadPermME(tenant, userId, platform)
+	if cerr != nil {
+		return perms, cerr
+	}
+	if !decision.Allowed {
+		return perms, &radarerror.UserNotFound
+	}
+
+	perms.Auths = me.AuthMp
+	perms.DataScope = me.DataScope
+	perms.Roles = me.RoleNames
+	if me.DataScope != DataScopeAll {
+		perms.Departments, cerr = getDataScopeDepartments(&me)
+		if cerr != nil {
+			return perms, cerr
+		}
+	}
+	return perms, nil
+}
+
+/*
+ * 加载用户会话，用户不存在（或不属于该租户）时返回拒绝结果
+ */
+func loadPermME(tenant int64, userId primitive.ObjectID, platform int64) (ME, PermDecision, *radarerror.CommonError) {
+	svcUser := NewUserService(SystemME(tenant))
+	user, cerr := svcUser.GetById(userId)
+	if cerr == &radarerror.UserNotFound {
+		return ME{}, PermDecision{Allowed: false, Reason: PermReasonUserNotFound}, nil
+	} else if cerr != nil {
+		return ME{}, PermDecision{}, cerr
+	}
+
+	me, cerr := NewME(user, 0, platform)
+	if cerr != nil {
+		return me, PermDecision{}, cerr
+	}
+	return me, PermDecision{Allowed: true}, nil
+}
+
+// 需要的权限：权限对象及需同时拥有的权限动作
+type PermRequirement struct {
+	Obj int64
+	Act int64
+}
+
+type PermExplanation struct {
+	UserStatus    string                   // 账号状态
+	PasswordReset bool                     // 是否已重设初始密码
+	Roles         []PermExplainRole        // 用户直接拥有及继承得到的角色
+	Requirements  []PermExplainRequirement // 每项需要的权限的判定
+	DataScope     PermExplainScope         // 数据范围判定
+	Allowed       bool
+	Reason        string // 第一个未通过的环节，全部通过为allowed
+}
+
+type PermExplainRole struct {
+	Id        primitive.ObjectID
+	Name      string
+	Inherited bool // 通过上级角色继承得到，用户并未直接拥有
+	Temporary bool // 通过临时授权得到
+	Auths     map[int64]int64
+}
+
+type PermExplainRequirement struct {
+	Obj     int64
+	Act     int64
+	Granted bool
+	Bits    []PermExplainBit // 按权限动作逐位说明
+}
+
+type PermExplainBit struct {
+	Act       int64
+	Granted   bool
+	GrantedBy []string // 授予该权限位的角色名或临时授权
+	LackedBy  []string // 缺少该权限位的角色名
+}
+
+type PermExplainScope struct {
+	DataScope   string
+	Departments []primitive.ObjectID // 数据范围内的部门id，范围为all时为空
+	Department  primitive.ObjectID   // 目标部门，为空则未校验
+	InScope     bool
+}
+
+/*
+ * 解释用户对账号中心某组权限的判定过程，判定顺序与接口鉴权一致：
+ * 账号状态 -> 角色权限 -> 是否已重设密码 -> 数据范围
+ * me为操作人，目标用户须在操作人的数据范围内
+ */
+func ExplainPermission(me *ME, userId primitive.ObjectID, reqs []PermRequirement, deptId primitive.ObjectID) (PermExplanation, *radarerror.CommonError) {
+	explain := PermExplanation{
+		Roles:        make([]PermExplainRole, 0),
+		Requirements: make([]PermExplainRequirement, 0, len(reqs)),
+	}
+
+	// 账号状态，已删除的用户也要能解释
+	svcUser := NewUserService(SystemME(me.Tenant))
+	var user model.User
+	err := svcUser.Dao.Get(&user, bson.M{
+		modelbase.ColId:       userId,
+		modelbase.ColIsDelete: bson.M{"$in": []bool{true, false}},
+	})
+	if err == mongo.ErrNoDocuments {
+		explain.UserStatus = UserStatusNotFound
+		explain.Reason = PermReasonUserNotFound
+		return explain, nil
+	} else if err != nil {
+		log.Errorf("fail to get user: %v", err)
+		return explain, &radarerror.InternalServerError
+	}
+	cerr := CheckUserInScope(me, user)
+	if cerr != nil {
+		return explain, cerr
+	}
+	explain.UserStatus = UserStatusActive
+	if user.IsDelete {
+		explain.UserStatus = UserStatusDeleted
+	}
+	explain.PasswordReset = user.PasswordReset
+
+	target, cerr := NewME(user, 0, 0)
+	if cerr != nil {
+		return explain, cerr
+	}
+
+	// 临时授权
+	svcGrant := NewGrantService(me)
+	grants, cerr := svcGrant.GetsActiveByUser(user.Id)
+	if cerr != nil {
+		return explain, cerr
+	}
+	grantRoles := make(map[primitive.ObjectID]bool)
+	for _, grant := range grants {
+		for _, id := range grant.Roles {
+			grantRoles[id] = true
+		}
+	}
+
+	// 角色
+	roleIds := append([]primitive.ObjectID{}, user.Roles...)
+	for id := range grantRoles {
+		roleIds = append(roleIds, id)
+	}
+	svcRole := NewRoleService(me)
+	roles, cerr := svcRole.GetsWithAncestors(roleIds)
+	if cerr != nil {
+		return explain, cerr
+	}
+	own := make(map[primitive.ObjectID]bool, len(user.Roles))
+	for _, id := range user.Roles {
+		own[id] = true
+	}
+	// 只解释账号中心的角色
+	accountRoles := make([]model.Role, 0, len(roles))
+	for _, role := range roles {
+		if role.Platform == 0 {
+			accountRoles = append(accountRoles, role)
+		}
+	}
+	roles = accountRoles
+	for _, role := range roles {
+		explain.Roles = append(explain.Roles, PermExplainRole{
+			Id:        role.Id,
+			Name:      role.Name,
+			Inherited: !own[role.Id] && !grantRoles[role.Id],
+			Temporary: !own[role.Id] && grantRoles[role.Id],
+			Auths:     role.Auths,
+		})
+	}
+
+	// 权限逐位说明
+	granted := true
+	for _, req := range reqs {
+		explainReq := PermExplainRequirement{
+			Obj:     req.Obj,
+			Act:     req.Act,
+			Granted: target.AuthMp[req.Obj]&req.Act == req.Act,
+			Bits:    make([]PermExplainBit, 0),
+		}
+		for bit := int64(1); bit > 0 && bit <= req.Act; bit <<= 1 {
+			if req.Act&bit == 0 {
+				continue
+			}
+			explainBit := PermExplainBit{
+				Act:       bit,
+				GrantedBy: make([]string, 0),
+				LackedBy:  make([]string, 0),
+			}
+			for _, role := range roles {
+				if role.Auths[req.Obj]&bit != 0 {
+					explainBit.GrantedBy = append(explainBit.GrantedBy, role.Name)
+				} else {
+					explainBit.LackedBy = append(explainBit.LackedBy, role.Name)
+				}
+			}
+			for _, grant := range grants {
+				if grant.Auths[req.Obj]&bit != 0 {
+					explainBit.GrantedBy = append(explainBit.GrantedBy, PermGrantLabel(grant))
+				}
+			}
+			explainBit.Granted = len(explainBit.GrantedBy) > 0
+			explainReq.Bits = append(explainReq.Bits, explainBit)
+		}
+		granted = granted && explainReq.Granted
+		explain.Requirements = append(explain.Requirements, explainReq)
+	}
+
+	// 数据范围
+	explain.DataScope = PermExplainScope{
+		DataScope:  target.DataScope,
+		Department: deptId,
+		InScope:    true,
+	}
+	if target.DataScope != DataScopeAll {
+		explain.DataScope.Departments, cerr = getDataScopeDepartments(&target)
+		if cerr != nil {
+			return explain, cerr
+		}
+	}
+	if deptId != primitive.NilObjectID {
+		cerr = CheckDepartmentInScope(&target, deptId)
+		if cerr == &radarerror.ExceedAuthority {
+			explain.DataScope.InScope = false
+		} else if cerr != nil {
+			return explain, cerr
+		}
+	}
+
+	switch {
+	case user.IsDelete:
+		explain.Reason = PermReasonUserDeleted
+	case !granted:
+		explain.Reason = PermReasonNoPermission
+	case len(reqs) > 0 && !user.PasswordReset:
+		explain.Reason = PermReasonNeedResetPwd
+	case !explain.DataScope.InScope:
+		explain.Reason = PermReasonOutOfDataScope
+	default:
+		explain.Allowed = true
+		explain.Reason = PermReasonAllowed
+	}
+	return explain, nil
+}
+
+// 临时授权在解释结果中的显示名
+func PermGrantLabel(grant model.Grant) string {
+	return "grant:" + grant.Id.Hex()
+}
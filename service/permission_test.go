@@ -0,0 +1,37 @@
+package service
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDecidePermission(t *testing.T) {
+	me := ME{
+		Id:         primitive.NewObjectID(),
+		Department: primitive.NewObjectID(),
+		AuthMp:     map[int64]int64{19: 1 | 4},
+		DataScope:  DataScopeDepartment,
+	}
+
+	cases := []struct {
+		obj, act int64
+		dept     primitive.ObjectID
+		reason   string
+	}{
+		{19, 1, primitive.NilObjectID, PermReasonAllowed},
+		{19, 1 | 4, me.Department, PermReasonAllowed},
+		{19, 1 | 2, primitive.NilObjectID, PermReasonNoPermission},
+		{18, 1, primitive.NilObjectID, PermReasonNoPermission},
+		{19, 1, primitive.NewObjectID(), PermReasonOutOfDataScope},
+	}
+	for _, c := range cases {
+		decision, cerr := decidePermission(&me, c.obj, c.act, c.dept)
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+		if decision.Reason != c.reason || decision.Allowed != (c.reason == PermReasonAllowed) {
+			t.Fatalf("obj %v act %v: unexpected decision %+v", c.obj, c.act, decision)
+		}
+	}
+}
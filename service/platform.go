@@ -0,0 +1,235 @@
+package service
+
+import (
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	PlatformMinPriority = 1
+	PlatformMaxPriority = 100
+)
+
+// 系统预设平台，部署时通过配置指定
+type PlatformPreset struct {
+	Name     string `mapstructure:"name"`     // 显示名
+	Priority int32  `mapstructure:"priority"` // 优先级权重(1-100)
+}
+
+/*
+ * 平台登记表，供接入的应用通过rpc发现有哪些平台
+ * 各租户共享，只有默认租户可以修改
+ */
+type Platform struct {
+	ME  ME
+	Dao model.PlatformDao
+}
+
+func NewPlatformService(me *ME) Platform {
+	s := Platform{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewPlatformDao()
+	return s
+}
+
+/*
+ * 获取平台
+ */
+func (s *Platform) GetByUid(uid int64) (model.Platform, *radarerror.CommonError) {
+	var platform model.Platform
+	err := s.Dao.GetByUid(&platform, uid)
+	if err == mongo.ErrNoDocuments {
+		log.Errorf("platform not found: %v", uid)
+		return platform, &radarerror.PlatformNotFound
+	} else if err != nil {
+		log.Errorf("fail to get platform: %v", err)
+		return platform, &radarerror.InternalServerError
+	}
+	return platform, nil
+}
+
+/*
+ * 获取全部平台，按优先级从高到低
+ */
+func (s *Platform) Gets() ([]model.Platform, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	opts.SetSort(bson.D{
+		{Key: model.ColPlatformPriority, Value: -1},
+		{Key: modelbase.ColUid, Value: 1},
+	})
+	platforms := make([]model.Platform, 0)
+	err := s.Dao.Gets(&platforms, bson.M{}, opts)
+	if err != nil {
+		log.Errorf("fail to get platforms: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return platforms, nil
+}
+
+/*
+ * 新增
+ */
+func (s *Platform) Add(platform model.Platform) (int64, *radarerror.CommonError) {
+	cerr := checkHostTenant(&s.ME)
+	if cerr != nil {
+		return 0, cerr
+	}
+	if platform.Name == "" {
+		log.Errorf("platform name cannot empty")
+		return 0, &radarerror.InvalidArgs
+	}
+	if platform.Priority < PlatformMinPriority || platform.Priority > PlatformMaxPriority {
+		log.Errorf("invalid platform priority: %v", platform.Priority)
+		return 0, &radarerror.InvalidArgs
+	}
+	cerr = s.checkDuplicatedName(platform.Name, 0)
+	if cerr != nil {
+		return 0, cerr
+	}
+
+	uid, err := s.Dao.NextUid()
+	if err != nil {
+		log.Errorf("fail to generate platform uid: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	platform.Uid = uid
+	platform.CreateTime = time.Now()
+	_, err = s.Dao.Add(platform)
+	if err != nil {
+		log.Errorf("fail to add platform: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	return uid, nil
+}
+
+type SetPlatform struct {
+	Name     *string `json:"name"`     // 显示名
+	Priority *int32  `json:"priority"` // 优先级权重(1-100)
+}
+
+/*
+ * 编辑，系统预设平台也可以改名和调整优先级
+ */
+func (s *Platform) Update(uid int64, setCVs SetPlatform) *radarerror.CommonError {
+	cerr := checkHostTenant(&s.ME)
+	if cerr != nil {
+		return cerr
+	}
+	_, cerr = s.GetByUid(uid)
+	if cerr != nil {
+		return cerr
+	}
+
+	update := bson.M{"$set": bson.M{}}
+	if setCVs.Name != nil {
+		if *setCVs.Name == "" {
+			log.Errorf("platform name cannot empty")
+			return &radarerror.InvalidArgs
+		}
+		cerr = s.checkDuplicatedName(*setCVs.Name, uid)
+		if cerr != nil {
+			return cerr
+		}
+		update["$set"].(bson.M)[model.ColPlatformName] = *setCVs.Name
+	}
+	if setCVs.Priority != nil {
+		if *setCVs.Priority < PlatformMinPriority || *setCVs.Priority > PlatformMaxPriority {
+			log.Errorf("invalid platform priority: %v", *setCVs.Priority)
+			return &radarerror.InvalidArgs
+		}
+		update["$set"].(bson.M)[model.ColPlatformPriority] = *setCVs.Priority
+	}
+	if len(update["$set"].(bson.M)) == 0 {
+		return nil
+	}
+
+	_, err := s.Dao.UpdateByUid(uid, update)
+	if err != nil {
+		log.Errorf("fail to update platform: %v", err)
+		return &radarerror.InternalServerError
+	}
+	return nil
+}
+
+/*
+ * 删除（逻辑删除），系统预设平台不能删除
+ */
+func (s *Platform) Delete(uid int64) *radarerror.CommonError {
+	cerr := checkHostTenant(&s.ME)
+	if cerr != nil {
+		return cerr
+	}
+	platform, cerr := s.GetByUid(uid)
+	if cerr != nil {
+		return cerr
+	}
+	if platform.SysPreset {
+		log.Errorf("cannot delete preset platform: %v", uid)
+		return &radarerror.PlatformPreset
+	}
+
+	_, err := s.Dao.UpdateByUid(uid, bson.M{"$set": bson.M{modelbase.ColIsDelete: true}})
+	if err != nil {
+		log.Errorf("fail to delete platform: %v", err)
+		return &radarerror.InternalServerError
+	}
+	return nil
+}
+
+/*
+ * 初始化系统预设平台：按名称补上缺少的，已存在的标记为预设
+ */
+func (s *Platform) InitPresets(presets []PlatformPreset) *radarerror.CommonError {
+	for _, preset := range presets {
+		var platform model.Platform
+		err := s.Dao.Get(&platform, bson.M{model.ColPlatformName: preset.Name})
+		if err == nil {
+			if platform.SysPreset {
+				continue
+			}
+			log.Infof("mark platform preset: %v %v", platform.Uid, platform.Name)
+			_, err = s.Dao.UpdateByUid(platform.Uid, bson.M{"$set": bson.M{model.ColPlatformSysPreset: true}})
+			if err != nil {
+				log.Errorf("fail to update platform: %v", err)
+				return &radarerror.InternalServerError
+			}
+			continue
+		} else if err != mongo.ErrNoDocuments {
+			log.Errorf("fail to get platform: %v", err)
+			return &radarerror.InternalServerError
+		}
+
+		uid, cerr := s.Add(model.Platform{
+			Name:      preset.Name,
+			Priority:  preset.Priority,
+			SysPreset: true,
+		})
+		if cerr != nil {
+			return cerr
+		}
+		log.Infof("add preset platform: %v %v", uid, preset.Name)
+	}
+	return nil
+}
+
+func (s *Platform) checkDuplicatedName(name string, excludeUid int64) *radarerror.CommonError {
+	var platform model.Platform
+	err := s.Dao.Get(&platform, bson.M{model.ColPlatformName: name})
+	if err == nil && platform.Uid != excludeUid {
+		log.Errorf("duplicated platform name: %v", name)
+		return &radarerror.DuplicatedPlatformName
+	} else if err != nil && err != mongo.ErrNoDocuments {
+		log.Errorf("fail to get platform: %v", err)
+		return &radarerror.InternalServerError
+	}
+	return nil
+}
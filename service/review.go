@@ -0,0 +1,586 @@
+package service
+
+import (
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// 审查活动状态
+	ReviewCampaignActive = "active"
+	ReviewCampaignClosed = "closed"
+
+	// 到期未审查的处理方式
+	ReviewOnExpireRevoke   = "revoke"   // 自动撤销
+	ReviewOnExpireEscalate = "escalate" // 上报，上报后仍未审查则自动撤销
+
+	// 审查结论
+	ReviewDecisionPending    = ""
+	ReviewDecisionKeep       = "keep"
+	ReviewDecisionRevoke     = "revoke"
+	ReviewDecisionAutoRevoke = "auto_revoke"
+
+	EventReviewItem = "review_item" // 有新的审查项待处理
+)
+
+type ReviewConfig struct {
+	ReviewerRole     string `mapstructure:"reviewer_role"`     // 审查人角色名
+	EscalationRole   string `mapstructure:"escalation_role"`   // 超期上报的角色名
+	EscalationPeriod int64  `mapstructure:"escalation_period"` // 上报后的处理期限，单位：秒
+	CheckInterval    int    `mapstructure:"check_interval"`    // 检查审查项到期的间隔，单位：秒
+}
+
+var reviewCfg ReviewConfig
+
+func SetReviewConfig(c ReviewConfig) {
+	reviewCfg = c
+}
+
+type Review struct {
+	ME          ME
+	CampaignDao model.ReviewCampaignDao
+	ItemDao     model.ReviewItemDao
+}
+
+func NewReviewService(me *ME) Review {
+	s := Review{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.CampaignDao = model.NewReviewCampaignDao()
+	s.ItemDao = model.NewReviewItemDao()
+	s.ME.bindDao(&s.CampaignDao.DataDao)
+	s.ME.bindDao(&s.ItemDao.DataDao)
+	return s
+}
+
+/*
+ * 获取审查活动
+ */
+func (s *Review) GetCampaignById(id primitive.ObjectID) (model.ReviewCampaign, *radarerror.CommonError) {
+	var campaign model.ReviewCampaign
+	err := s.CampaignDao.GetById(&campaign, id)
+	if err == mongo.ErrNoDocuments {
+		log.Errorf("review campaign not found: %v", id.Hex())
+		return campaign, &radarerror.ReviewCampaignNotFound
+	} else if err != nil {
+		log.Errorf("fail to get review campaign: %v", err)
+		return campaign, &radarerror.InternalServerError
+	}
+	return campaign, nil
+}
+
+/*
+ * 分页获取审查活动
+ */
+func (s *Review) GetsCampaign(page, pageSize int64) ([]model.ReviewCampaign, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	if pageSize > 0 {
+		opts.SetLimit(pageSize)
+	}
+	opts.SetSkip(page * pageSize)
+	opts.SetSort(bson.M{modelbase.ColId: -1})
+	campaigns := make([]model.ReviewCampaign, 0)
+	err := s.CampaignDao.Gets(&campaigns, bson.M{}, opts)
+	if err != nil {
+		log.Errorf("fail to get review campaigns: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return campaigns, nil
+}
+
+/*
+ * 审查活动总数
+ */
+func (s *Review) GetCampaignCount() (int64, *radarerror.CommonError) {
+	count, err := s.CampaignDao.GetCount(bson.M{})
+	if err != nil {
+		log.Errorf("fail to get review campaign count: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	return count, nil
+}
+
+/*
+ * 新增审查活动，并为范围内（且在操作人数据范围内）的每个用户-角色生成审查项
+ * 审查人从用户所在部门逐级向上查找拥有审查人角色的用户，找不到则由活动创建人审查
+ */
+func (s *Review) AddCampaign(campaign model.ReviewCampaign) (primitive.ObjectID, int, *radarerror.CommonError) {
+	var id primitive.ObjectID
+	now := time.Now()
+	if !campaign.Deadline.After(now) {
+		log.Errorf("invalid deadline: %v", campaign.Deadline)
+		return id, 0, &radarerror.InvalidArgs
+	}
+	if campaign.OnExpire != ReviewOnExpireRevoke && campaign.OnExpire != ReviewOnExpireEscalate {
+		log.Errorf("invalid on_expire: %v", campaign.OnExpire)
+		return id, 0, &radarerror.InvalidArgs
+	}
+
+	// 范围
+	var cerr *radarerror.CommonError
+	var deptSet map[primitive.ObjectID]bool
+	if len(campaign.Departments) > 0 {
+		deptSet = make(map[primitive.ObjectID]bool)
+		svcDepartment := NewDepartmentService(&s.ME)
+		for _, deptId := range campaign.Departments {
+			_, cerr = svcDepartment.GetById(deptId)
+			if cerr != nil {
+				return id, 0, cerr
+			}
+			cerr = CheckDepartmentInScope(&s.ME, deptId)
+			if cerr != nil {
+				return id, 0, cerr
+			}
+			var subtree []primitive.ObjectID
+			subtree, cerr = svcDepartment.GetSubtreeIds(deptId)
+			if cerr != nil {
+				return id, 0, cerr
+			}
+			for _, subId := range subtree {
+				deptSet[subId] = true
+			}
+		}
+	}
+	var roleSet map[primitive.ObjectID]bool
+	if len(campaign.Roles) > 0 {
+		svcRole := NewRoleService(&s.ME)
+		campaign.Roles, cerr = svcRole.CheckIds(campaign.Roles)
+		if cerr != nil {
+			return id, 0, cerr
+		}
+		roleSet = make(map[primitive.ObjectID]bool)
+		for _, roleId := range campaign.Roles {
+			roleSet[roleId] = true
+		}
+	}
+
+	svcUser := NewUserService(&s.ME)
+	users, cerr := svcUser.Gets(0, 0, FilterUser{})
+	if cerr != nil {
+		return id, 0, cerr
+	}
+
+	campaign.Status = ReviewCampaignActive
+	id, err := s.CampaignDao.Add(s.ME.Id, campaign)
+	if err != nil {
+		log.Errorf("fail to add review campaign: %v", err)
+		return id, 0, &radarerror.InternalServerError
+	}
+
+	// 审查项
+	var items []interface{}
+	notify := make(map[primitive.ObjectID]bool)
+	for _, user := range users {
+		if deptSet != nil && !deptSet[user.Department] {
+			continue
+		}
+		var reviewers []primitive.ObjectID
+		for _, roleId := range user.Roles {
+			if roleSet != nil && !roleSet[roleId] {
+				continue
+			}
+			if reviewers == nil {
+				reviewers, cerr = findDepartmentRoleHolders(s.ME.Tenant, reviewCfg.ReviewerRole, user)
+				if cerr != nil {
+					return id, 0, cerr
+				}
+				if len(reviewers) == 0 {
+					reviewers = []primitive.ObjectID{s.ME.Id}
+				}
+			}
+			items = append(items, model.ReviewItem{
+				Campaign:   id,
+				User:       user.Id,
+				Role:       roleId,
+				Department: user.Department,
+				Reviewers:  reviewers,
+				Deadline:   campaign.Deadline,
+			})
+			for _, reviewer := range reviewers {
+				notify[reviewer] = true
+			}
+		}
+	}
+	if len(items) == 0 {
+		return id, 0, s.closeCampaign(id)
+	}
+	_, err = s.ItemDao.AddMany(s.ME.Id, items)
+	if err != nil {
+		log.Errorf("fail to add review items: %v", err)
+		return id, 0, &radarerror.InternalServerError
+	}
+	for reviewer := range notify {
+		PublishEvent(EventReviewItem, reviewer, map[string]string{"campaign": id.Hex()})
+	}
+	return id, len(items), nil
+}
+
+type FilterReviewItem struct {
+	Campaign *primitive.ObjectID // 审查活动id
+	Todo     bool                // 只返回待我审查的
+	Decision *string             // 结论
+}
+
+func (s *Review) ConvertItemFilter(filter FilterReviewItem) bson.M {
+	mFilter := bson.M{}
+	if filter.Campaign != nil {
+		mFilter[model.ColReviewItemCampaign] = *filter.Campaign
+	}
+	if filter.Todo {
+		mFilter[model.ColReviewItemReviewers] = s.ME.Id
+		mFilter[model.ColReviewItemDecision] = ReviewDecisionPending
+	}
+	if filter.Decision != nil {
+		mFilter[model.ColReviewItemDecision] = *filter.Decision
+	}
+	return mFilter
+}
+
+/*
+ * 根据筛选条件分页获取审查项
+ */
+func (s *Review) GetsItem(page, pageSize int64, filter FilterReviewItem) ([]model.ReviewItem, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	if pageSize > 0 {
+		opts.SetLimit(pageSize)
+	}
+	opts.SetSkip(page * pageSize)
+	opts.SetSort(bson.M{modelbase.ColId: 1})
+	items := make([]model.ReviewItem, 0)
+	err := s.ItemDao.Gets(&items, s.ConvertItemFilter(filter), opts)
+	if err != nil {
+		log.Errorf("fail to get review items: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return items, nil
+}
+
+/*
+ * 根据筛选条件获取审查项总数
+ */
+func (s *Review) GetItemCount(filter FilterReviewItem) (int64, *radarerror.CommonError) {
+	count, err := s.ItemDao.GetCount(s.ConvertItemFilter(filter))
+	if err != nil {
+		log.Errorf("fail to get review item count: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	return count, nil
+}
+
+/*
+ * 审查：保留或撤销角色
+ * 审查权限来自活动分配，撤销不受审查人自身数据范围的限制
+ */
+func (s *Review) ReviewItem(id primitive.ObjectID, decision, comment string) *radarerror.CommonError {
+	if decision != ReviewDecisionKeep && decision != ReviewDecisionRevoke {
+		log.Errorf("invalid decision: %v", decision)
+		return &radarerror.InvalidArgs
+	}
+	var item model.ReviewItem
+	err := s.ItemDao.GetById(&item, id)
+	if err == mongo.ErrNoDocuments {
+		log.Errorf("review item not found: %v", id.Hex())
+		return &radarerror.ReviewItemNotFound
+	} else if err != nil {
+		log.Errorf("fail to get review item: %v", err)
+		return &radarerror.InternalServerError
+	}
+	reviewer := false
+	for _, uid := range item.Reviewers {
+		if uid == s.ME.Id {
+			reviewer = true
+			break
+		}
+	}
+	if !reviewer {
+		log.Errorf("not reviewer: %v, %v", s.ME.Id.Hex(), id.Hex())
+		return &radarerror.ExceedAuthority
+	}
+	if item.Decision != ReviewDecisionPending {
+		log.Errorf("review item reviewed: %v", id.Hex())
+		return &radarerror.ReviewItemReviewed
+	}
+
+	// 先记录结论再撤销，并发审查时只有一方成功
+	cerr := s.decide(item, decision, s.ME.Id, comment)
+	if cerr != nil {
+		return cerr
+	}
+	if decision == ReviewDecisionRevoke {
+		cerr = s.revoke(item)
+		if cerr != nil {
+			s.undecide(item, decision)
+			return cerr
+		}
+	}
+	return nil
+}
+
+/*
+ * 处理到期未审查的审查项：按活动设置上报或自动撤销；全部处理完的活动关闭
+ * 单个审查项处理失败只记录日志，下次检查时重试，不影响其他审查项
+ */
+func (s *Review) CheckDeadline() *radarerror.CommonError {
+	now := time.Now()
+	var items []model.ReviewItem
+	err := s.ItemDao.Gets(&items, bson.M{
+		model.ColReviewItemDecision: ReviewDecisionPending,
+		model.ColReviewItemDeadline: bson.M{"$lte": now},
+	})
+	if err != nil {
+		log.Errorf("fail to get expired review items: %v", err)
+		return &radarerror.InternalServerError
+	}
+
+	campaigns := make(map[primitive.ObjectID]model.ReviewCampaign)
+	for _, item := range items {
+		campaign, ok := campaigns[item.Campaign]
+		if !ok {
+			var cerr *radarerror.CommonError
+			campaign, cerr = s.GetCampaignById(item.Campaign)
+			if cerr != nil {
+				log.Errorf("fail to get campaign of review item %v: %v", item.Id.Hex(), cerr)
+				continue
+			}
+			campaigns[item.Campaign] = campaign
+		}
+
+		if campaign.OnExpire == ReviewOnExpireEscalate && !item.Escalated {
+			cerr := s.escalate(item, now)
+			if cerr != nil {
+				log.Errorf("fail to escalate review item %v: %v", item.Id.Hex(), cerr)
+			}
+			continue
+		}
+		cerr := s.decide(item, ReviewDecisionAutoRevoke, primitive.NilObjectID, "")
+		if cerr == &radarerror.ReviewItemReviewed {
+			continue
+		} else if cerr != nil {
+			log.Errorf("fail to auto revoke review item %v: %v", item.Id.Hex(), cerr)
+			continue
+		}
+		cerr = s.revoke(item)
+		if cerr != nil && cerr != &radarerror.UserNotFound {
+			log.Errorf("fail to auto revoke review item %v: %v", item.Id.Hex(), cerr)
+			s.undecide(item, ReviewDecisionAutoRevoke)
+		}
+	}
+
+	// 关闭处理完的活动
+	var active []model.ReviewCampaign
+	err = s.CampaignDao.Gets(&active, bson.M{model.ColReviewCampaignStatus: ReviewCampaignActive})
+	if err != nil {
+		log.Errorf("fail to get active review campaigns: %v", err)
+		return &radarerror.InternalServerError
+	}
+	for _, campaign := range active {
+		pending, cerr := s.GetItemCount(FilterReviewItem{Campaign: &campaign.Id, Decision: strPtr(ReviewDecisionPending)})
+		if cerr != nil {
+			return cerr
+		}
+		if pending == 0 {
+			cerr = s.closeCampaign(campaign.Id)
+			if cerr != nil {
+				return cerr
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * 后台定时逐个租户检查审查项到期
+ */
+func RunReviewJob() {
+	interval := time.Duration(reviewCfg.CheckInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		tenants, cerr := TenantUids()
+		if cerr != nil {
+			log.Errorf("fail to get tenants: %v", cerr)
+		}
+		for _, tenant := range tenants {
+			svcReview := NewReviewService(SystemME(tenant))
+			cerr = svcReview.CheckDeadline()
+			if cerr != nil {
+				log.Errorf("fail to check review items of tenant %v: %v", tenant, cerr)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+type ReviewReport struct {
+	Campaign    model.ReviewCampaign
+	Total       int64
+	Kept        int64
+	Revoked     int64
+	AutoRevoked int64
+	Pending     int64
+	Escalated   int64
+	Items       []model.ReviewItem
+}
+
+/*
+ * 审查活动的完成情况报告
+ */
+func (s *Review) Report(campaignId primitive.ObjectID) (ReviewReport, *radarerror.CommonError) {
+	var report ReviewReport
+	campaign, cerr := s.GetCampaignById(campaignId)
+	if cerr != nil {
+		return report, cerr
+	}
+	items, cerr := s.GetsItem(0, 0, FilterReviewItem{Campaign: &campaignId})
+	if cerr != nil {
+		return report, cerr
+	}
+
+	report.Campaign = campaign
+	report.count(items)
+	return report, nil
+}
+
+// 按结论统计审查项
+func (r *ReviewReport) count(items []model.ReviewItem) {
+	r.Items = items
+	r.Total = int64(len(items))
+	for _, item := range items {
+		switch item.Decision {
+		case ReviewDecisionKeep:
+			r.Kept++
+		case ReviewDecisionRevoke:
+			r.Revoked++
+		case ReviewDecisionAutoRevoke:
+			r.AutoRevoked++
+		default:
+			r.Pending++
+		}
+		if item.Escalated {
+			r.Escalated++
+		}
+	}
+}
+
+/***** 辅助函数 *****/
+
+// 撤销审查项对应的角色
+func (s *Review) revoke(item model.ReviewItem) *radarerror.CommonError {
+	actor := ME{Id: s.ME.Id, Tenant: s.ME.Tenant, DataScope: DataScopeAll, Changes: s.ME.Changes}
+	svcUser := NewUserService(&actor)
+	return svcUser.RevokeRole(item.User, item.Role)
+}
+
+// 记录审查结论，只有待审查的才能记录
+func (s *Review) decide(item model.ReviewItem, decision string, reviewer primitive.ObjectID, comment string) *radarerror.CommonError {
+	filter := bson.M{
+		modelbase.ColId:             item.Id,
+		model.ColReviewItemDecision: ReviewDecisionPending,
+	}
+	update := bson.M{"$set": bson.M{
+		model.ColReviewItemDecision:   decision,
+		model.ColReviewItemReviewer:   reviewer,
+		model.ColReviewItemComment:    comment,
+		model.ColReviewItemReviewTime: time.Now(),
+	}}
+	modified, err := s.ItemDao.Update(s.ME.Id, filter, update)
+	if err != nil {
+		log.Errorf("fail to update review item: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if modified == 0 {
+		log.Errorf("review item reviewed: %v", item.Id.Hex())
+		return &radarerror.ReviewItemReviewed
+	}
+	return nil
+}
+
+// 撤销角色失败时把结论恢复为待审查，以便重新审查或下次到期检查时重试
+func (s *Review) undecide(item model.ReviewItem, decision string) {
+	filter := bson.M{
+		modelbase.ColId:             item.Id,
+		model.ColReviewItemDecision: decision,
+	}
+	update := bson.M{"$set": bson.M{
+		model.ColReviewItemDecision:   ReviewDecisionPending,
+		model.ColReviewItemReviewer:   primitive.NilObjectID,
+		model.ColReviewItemComment:    "",
+		model.ColReviewItemReviewTime: time.Time{},
+	}}
+	_, err := s.ItemDao.Update(s.ME.Id, filter, update)
+	if err != nil {
+		log.Errorf("fail to reset review item %v: %v", item.Id.Hex(), err)
+	}
+}
+
+// 超期上报：改由上报角色审查，并顺延截止时间
+func (s *Review) escalate(item model.ReviewItem, now time.Time) *radarerror.CommonError {
+	svcUser := NewUserService(SystemME(s.ME.Tenant))
+	user, cerr := svcUser.GetById(item.User)
+	if cerr != nil && cerr != &radarerror.UserNotFound {
+		return cerr
+	}
+	user.Id = item.User
+	reviewers, cerr := findDepartmentRoleHolders(s.ME.Tenant, reviewCfg.EscalationRole, user)
+	if cerr != nil {
+		return cerr
+	}
+	if len(reviewers) == 0 {
+		reviewers = item.Reviewers
+	}
+
+	update := bson.M{"$set": bson.M{
+		model.ColReviewItemReviewers: reviewers,
+		model.ColReviewItemDeadline:  now.Add(time.Duration(reviewCfg.EscalationPeriod) * time.Second),
+		model.ColReviewItemEscalated: true,
+	}}
+	// 期间已被审查的不再上报
+	filter := bson.M{
+		modelbase.ColId:              item.Id,
+		model.ColReviewItemDecision:  ReviewDecisionPending,
+		model.ColReviewItemEscalated: false,
+	}
+	modified, err := s.ItemDao.Update(s.ME.Id, filter, update)
+	if err != nil {
+		log.Errorf("fail to escalate review item: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if modified == 0 {
+		return nil
+	}
+	log.Infof("review item escalated: %v", item.Id.Hex())
+	for _, reviewer := range reviewers {
+		PublishEvent(EventReviewItem, reviewer, map[string]string{"campaign": item.Campaign.Hex(), "item": item.Id.Hex()})
+	}
+	return nil
+}
+
+func (s *Review) closeCampaign(id primitive.ObjectID) *radarerror.CommonError {
+	update := bson.M{"$set": bson.M{
+		model.ColReviewCampaignStatus:    ReviewCampaignClosed,
+		model.ColReviewCampaignCloseTime: time.Now(),
+	}}
+	_, err := s.CampaignDao.UpdateById(s.ME.Id, id, update)
+	if err != nil {
+		log.Errorf("fail to close review campaign: %v", err)
+		return &radarerror.InternalServerError
+	}
+	log.Infof("review campaign closed: %v", id.Hex())
+	return nil
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SeeJson/account/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReviewConvertItemFilter(t *testing.T) {
+	me := primitive.NewObjectID()
+	campaign := primitive.NewObjectID()
+	s := Review{ME: ME{Id: me}}
+	keep := ReviewDecisionKeep
+
+	cases := []struct {
+		filter FilterReviewItem
+		expect bson.M
+	}{
+		{FilterReviewItem{}, bson.M{}},
+		{FilterReviewItem{Campaign: &campaign}, bson.M{model.ColReviewItemCampaign: campaign}},
+		{FilterReviewItem{Todo: true}, bson.M{
+			model.ColReviewItemReviewers: me,
+			model.ColReviewItemDecision:  ReviewDecisionPending,
+		}},
+		{FilterReviewItem{Campaign: &campaign, Decision: &keep}, bson.M{
+			model.ColReviewItemCampaign: campaign,
+			model.ColReviewItemDecision: keep,
+		}},
+	}
+	for i, c := range cases {
+		got := s.ConvertItemFilter(c.filter)
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Fatalf("case %v: expect %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestReviewReportCount(t *testing.T) {
+	cases := []struct {
+		items  []model.ReviewItem
+		expect ReviewReport
+	}{
+		{nil, ReviewReport{}},
+		{
+			[]model.ReviewItem{
+				{Decision: ReviewDecisionKeep},
+				{Decision: ReviewDecisionRevoke},
+				{Decision: ReviewDecisionAutoRevoke, Escalated: true},
+				{Decision: ReviewDecisionPending},
+				{Decision: ReviewDecisionPending, Escalated: true},
+			},
+			ReviewReport{Total: 5, Kept: 1, Revoked: 1, AutoRevoked: 1, Pending: 2, Escalated: 2},
+		},
+	}
+	for i, c := range cases {
+		var report ReviewReport
+		report.count(c.items)
+		report.Items = nil
+		if !reflect.DeepEqual(report, c.expect) {
+			t.Fatalf("case %v: expect %+v, got %+v", i, c.expect, report)
+		}
+	}
+}
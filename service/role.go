@@ -0,0 +1,582 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	mongodao "github.com/SeeJson/account/util/mongo"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Role struct {
+	ME  ME
+	Dao model.RoleDao
+}
+
+func NewRoleService(me *ME) Role {
+	s := Role{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewRoleDao()
+	s.ME.bindDao(&s.Dao.DataDao)
+	return s
+}
+
+/*
+ * 获取role信息
+ */
+func (s *Role) GetById(id primitive.ObjectID) (model.Role, *radarerror.CommonError) {
+	var role model.Role
+	err := s.Dao.GetById(&role, id)
+	if err == mongo.ErrNoDocuments {
+		log.Errorf("role not found: %v", id.Hex())
+		return role, &radarerror.RoleNotFound
+	} else if err != nil {
+		log.Errorf("fail to get role: %v", err)
+		return role, &radarerror.InternalServerError
+	}
+	return role, nil
+}
+
+func (s *Role) GetByName(name string) (model.Role, *radarerror.CommonError) {
+	filter := bson.M{
+		model.ColRoleName: name,
+	}
+	var role model.Role
+	err := s.Dao.Get(&role, filter)
+	if err == mongo.ErrNoDocuments {
+		return role, &radarerror.RoleNotFound
+	} else if err != nil {
+		log.Errorf("fail to get role: %v", err)
+		return role, &radarerror.InternalServerError
+	}
+	return role, nil
+}
+
+/*
+ * 批量获取角色，不存在的忽略
+ */
+func (s *Role) GetByIds(ids []primitive.ObjectID) ([]model.Role, *radarerror.CommonError) {
+	var roles []model.Role
+	err := s.Dao.GetByIds(&roles, ids)
+	if err != nil {
+		log.Errorf("fail to get roles: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return roles, nil
+}
+
+/*
+ * 检查角色都存在，返回去重后的角色id
+ */
+func (s *Role) CheckIds(ids []primitive.ObjectID) ([]primitive.ObjectID, *radarerror.CommonError) {
+	uniq := make([]primitive.ObjectID, 0, len(ids))
+	existed := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		if existed[id] {
+			continue
+		}
+		existed[id] = true
+		uniq = append(uniq, id)
+	}
+
+	roles, cerr := s.GetByIds(uniq)
+	if cerr != nil {
+		return nil, cerr
+	}
+	if len(roles) != len(uniq) {
+		log.Errorf("role not found: %v", uniq)
+		return nil, &radarerror.RoleNotFound
+	}
+	return uniq, nil
+}
+
+/*
+ * 获取角色id到角色名的映射，用于列表展示
+ */
+func (s *Role) GetNameMap(ids []primitive.ObjectID) (map[primitive.ObjectID]string, *radarerror.CommonError) {
+	var roles []model.Role
+	err := s.Dao.GetByIds(&roles, ids)
+	if err != nil {
+		log.Errorf("fail to get roles: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	names := make(map[primitive.ObjectID]string, len(roles))
+	for _, role := range roles {
+		names[role.Id] = role.Name
+	}
+	return names, nil
+}
+
+type FilterRole struct {
+	Name     *string // 角色名；模糊匹配
+	Platform *int64  // 所属平台uid
+}
+
+func (s *Role) ConvertFilter(filter FilterRole) bson.M {
+	log.Debug("filter :", filter)
+	var mFilter = bson.M{}
+
+	if filter.Name != nil {
+		mFilter[model.ColRoleName] = bson.M{"$regex": fmt.Sprintf(".*%v*.", *filter.Name)}
+	}
+	if filter.Platform != nil {
+		mFilter[model.ColRolePlatform] = model.PlatformFilter(*filter.Platform)
+	}
+	return mFilter
+}
+
+/*
+ * 根据筛选条件获取列表
+ * 注意：page是从0开始
+ */
+func (s *Role) Gets(page, pageSize int64, filter FilterRole) ([]model.Role, *radarerror.CommonError) {
+	mFilter := s.ConvertFilter(filter)
+	opts := &options.FindOptions{}
+	if pageSize > 0 {
+		opts.SetLimit(pageSize)
+	}
+	opts.SetSkip(page * pageSize)
+	opts.SetSort(bson.M{modelbase.ColId: -1})
+	var models []model.Role
+	err := s.Dao.Gets(&models, mFilter, opts)
+	if err != nil {
+		log.Errorf("fail to get roles: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return models, nil
+}
+
+/*
+ * 根据筛选条件获取结果集总数
+ */
+func (s *Role) GetCount(filter FilterRole) (int64, *radarerror.CommonError) {
+	mFilter := s.ConvertFilter(filter)
+	count, err := s.Dao.GetCount(mFilter)
+	if err != nil {
+		log.Errorf("fail to get role count: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	return count, nil
+}
+
+/*
+ * 添加
+ */
+func (s *Role) Add(role model.Role) (primitive.ObjectID, *radarerror.CommonError) {
+	if role.Name == "" {
+		log.Errorf("role name cannot empty")
+		return primitive.NilObjectID, &radarerror.InvalidArgs
+	}
+
+	// name去重
+	_, cerr := s.GetByName(role.Name)
+	if cerr == nil {
+		log.Errorf("duplicated role name: %v", role.Name)
+		return primitive.NilObjectID, &radarerror.DuplicatedRoleName
+	} else if cerr != &radarerror.RoleNotFound {
+		return primitive.NilObjectID, cerr
+	}
+
+	if role.Auths == nil {
+		role.Auths = make(map[int64]int64)
+	}
+
+	// 所属平台，其他平台的权限集按该平台登记的权限对象校验
+	if role.Platform != 0 {
+		svcPlatform := NewPlatformService(&s.ME)
+		_, cerr = svcPlatform.GetByUid(role.Platform)
+		if cerr != nil {
+			return primitive.NilObjectID, cerr
+		}
+		svcAuth := NewAuthService(&s.ME)
+		cerr = svcAuth.CheckPlatformAuths(role.Platform, role.Auths)
+		if cerr != nil {
+			return primitive.NilObjectID, cerr
+		}
+	}
+
+	// 数据范围，默认本部门
+	if role.DataScope == "" {
+		role.DataScope = DataScopeDepartment
+	}
+	cerr = s.checkDataScope(role.DataScope, role.DataScopeDepartments)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+
+	// 上级角色
+	if role.Parents == nil {
+		role.Parents = make([]primitive.ObjectID, 0)
+	}
+	role.Parents, cerr = s.checkParents(primitive.NilObjectID, role.Platform, role.Parents)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+
+	// 职责分离
+	cerr = checkSodRole(s.ME.Tenant, role)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+
+	id, err := s.Dao.Add(s.ME.Id, role)
+	if err != nil {
+		log.Errorf("fail to add role: %v", err)
+		return primitive.NilObjectID, &radarerror.InternalServerError
+	}
+	return id, nil
+}
+
+type SetRole struct {
+	Name                 *string          `json:"name"`                   // 角色名
+	Auths                *map[int64]int64 `json:"auths"`                  // 权限集 key是权限对象的二进制掩码，value是权限动作的二进制掩码取或
+	DataScope            *string          `json:"data_scope"`             // 数据范围 self|department|subtree|custom|all
+	DataScopeDepartments *[]string        `json:"data_scope_departments"` // 数据范围为custom时可访问的部门id
+	Parents              *[]string        `json:"parents"`                // 继承的上级角色id
+}
+
+/*
+ * 编辑
+ * 权限集、数据范围或继承关系变更后，该角色及所有下级角色的用户需要重新登录
+ */
+func (s *Role) Update(id primitive.ObjectID, setCVs SetRole) *radarerror.CommonError {
+	old, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+
+	update := bson.M{"$set": bson.M{}}
+
+	if setCVs.Name != nil {
+		if *setCVs.Name == "" {
+			log.Errorf("role name cannot empty")
+			return &radarerror.InvalidArgs
+		}
+		// name去重
+		role, cerr := s.GetByName(*setCVs.Name)
+		if cerr == nil && role.Id != id {
+			log.Errorf("duplicated role name: %v", *setCVs.Name)
+			return &radarerror.DuplicatedRoleName
+		} else if cerr != nil && cerr != &radarerror.RoleNotFound {
+			return cerr
+		}
+		update["$set"].(bson.M)[model.ColRoleName] = *setCVs.Name
+	}
+	if setCVs.Auths != nil {
+		if old.Platform != 0 {
+			svcAuth := NewAuthService(&s.ME)
+			cerr = svcAuth.CheckPlatformAuths(old.Platform, *setCVs.Auths)
+			if cerr != nil {
+				return cerr
+			}
+		}
+		update["$set"].(bson.M)[model.ColRoleAuths] = *setCVs.Auths
+		old.Auths = *setCVs.Auths
+	}
+	if setCVs.DataScope != nil || setCVs.DataScopeDepartments != nil {
+		scope := old.DataScope
+		if setCVs.DataScope != nil {
+			scope = *setCVs.DataScope
+		}
+		deptIds := old.DataScopeDepartments
+		if setCVs.DataScopeDepartments != nil {
+			deptIds = make([]primitive.ObjectID, 0, len(*setCVs.DataScopeDepartments))
+			for _, hex := range *setCVs.DataScopeDepartments {
+				deptIds = append(deptIds, mongodao.Hex2Id(hex))
+			}
+		}
+		cerr = s.checkDataScope(scope, deptIds)
+		if cerr != nil {
+			return cerr
+		}
+		update["$set"].(bson.M)[model.ColRoleDataScope] = scope
+		update["$set"].(bson.M)[model.ColRoleDataScopeDepartments] = deptIds
+	}
+	if setCVs.Parents != nil {
+		parents := make([]primitive.ObjectID, 0, len(*setCVs.Parents))
+		for _, hex := range *setCVs.Parents {
+			parents = append(parents, mongodao.Hex2Id(hex))
+		}
+		parents, cerr = s.checkParents(id, old.Platform, parents)
+		if cerr != nil {
+			return cerr
+		}
+		update["$set"].(bson.M)[model.ColRoleParents] = parents
+		old.Parents = parents
+	}
+
+	// 职责分离：按编辑后的权限集和上级角色校验
+	if setCVs.Auths != nil || setCVs.Parents != nil {
+		cerr = checkSodRole(s.ME.Tenant, old)
+		if cerr != nil {
+			return cerr
+		}
+	}
+
+	_, err := s.Dao.UpdateById(s.ME.Id, id, update)
+	if err != nil {
+		log.Errorf("fail to update role: %v", err)
+		return &radarerror.InternalServerError
+	}
+
+	if setCVs.Auths != nil || setCVs.DataScope != nil || setCVs.DataScopeDepartments != nil || setCVs.Parents != nil {
+		descendantIds, cerr := s.GetDescendantIds(id)
+		if cerr != nil {
+			return cerr
+		}
+		svcUser := NewUserService(SystemME(s.ME.Tenant))
+		for _, roleId := range append([]primitive.ObjectID{id}, descendantIds...) {
+			cerr = svcUser.RefreshSessionVersionByRole(roleId)
+			if cerr != nil {
+				return cerr
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * 删除
+ * 角色下仍有用户或仍被其他角色继承时不允许删除
+ */
+func (s *Role) Delete(id primitive.ObjectID) *radarerror.CommonError {
+	_, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+
+	childCount, err := s.Dao.GetCount(bson.M{model.ColRoleParents: id})
+	if err != nil {
+		log.Errorf("fail to get role count: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if childCount > 0 {
+		log.Errorf("role inherited: %v, children: %v", id.Hex(), childCount)
+		return &radarerror.RoleInherited
+	}
+
+	// 不受操作人数据范围限制，统计租户内全部用户
+	svcUser := NewUserService(SystemME(s.ME.Tenant))
+	count, cerr := svcUser.GetCount(FilterUser{Role: &id})
+	if cerr != nil {
+		return cerr
+	}
+	if count > 0 {
+		log.Errorf("role in use: %v, users: %v", id.Hex(), count)
+		return &radarerror.RoleInUse
+	}
+
+	_, err = s.Dao.DelById(s.ME.Id, id)
+	if err != nil {
+		log.Errorf("fail to delete role: %v", err)
+		return &radarerror.InternalServerError
+	}
+	return nil
+}
+
+/*
+ * 复制角色：所属平台、权限集、数据范围、上级角色都与原角色相同
+ */
+func (s *Role) Clone(id primitive.ObjectID, name string) (primitive.ObjectID, *radarerror.CommonError) {
+	role, cerr := s.GetById(id)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+	return s.Add(model.Role{
+		Name:                 name,
+		Auths:                role.Auths,
+		DataScope:            role.DataScope,
+		DataScopeDepartments: role.DataScopeDepartments,
+		Parents:              role.Parents,
+		Platform:             role.Platform,
+	})
+}
+
+/*
+ * 获取角色及其所有上级角色（可传递），不存在的忽略
+ * 每个角色只取一次，即使继承关系有环也能结束
+ */
+func (s *Role) GetsWithAncestors(ids []primitive.ObjectID) ([]model.Role, *radarerror.CommonError) {
+	visited := make(map[primitive.ObjectID]bool)
+	var result []model.Role
+	for len(ids) > 0 {
+		batch := make([]primitive.ObjectID, 0, len(ids))
+		for _, id := range ids {
+			if !visited[id] {
+				visited[id] = true
+				batch = append(batch, id)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+		roles, cerr := s.GetByIds(batch)
+		if cerr != nil {
+			return nil, cerr
+		}
+		ids = nil
+		for _, role := range roles {
+			result = append(result, role)
+			ids = append(ids, role.Parents...)
+		}
+	}
+	return result, nil
+}
+
+/*
+ * 获取所有直接或间接继承该角色的下级角色id
+ */
+func (s *Role) GetDescendantIds(id primitive.ObjectID) ([]primitive.ObjectID, *radarerror.CommonError) {
+	visited := map[primitive.ObjectID]bool{id: true}
+	var result []primitive.ObjectID
+	frontier := []primitive.ObjectID{id}
+	for len(frontier) > 0 {
+		var roles []model.Role
+		err := s.Dao.Gets(&roles, bson.M{model.ColRoleParents: bson.M{"$in": frontier}})
+		if err != nil {
+			log.Errorf("fail to get roles: %v", err)
+			return nil, &radarerror.InternalServerError
+		}
+		frontier = nil
+		for _, role := range roles {
+			if visited[role.Id] {
+				continue
+			}
+			visited[role.Id] = true
+			result = append(result, role.Id)
+			frontier = append(frontier, role.Id)
+		}
+	}
+	return result, nil
+}
+
+/*
+ * 初始化超级管理员角色：不存在则创建，存在但权限集不全则更新为全部权限、全部数据
+ */
+func (s *Role) InitSuperAdmin(name string, auths map[int64]int64) (primitive.ObjectID, *radarerror.CommonError) {
+	role, cerr := s.GetByName(name)
+	if cerr == &radarerror.RoleNotFound {
+		log.Infof("init super admin role: %v", name)
+		return s.Add(model.Role{
+			Name:      name,
+			Auths:     auths,
+			DataScope: DataScopeAll,
+		})
+	} else if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+
+	if !reflect.DeepEqual(role.Auths, auths) || role.DataScope != DataScopeAll {
+		log.Infof("update super admin role: %v", name)
+		scope := DataScopeAll
+		cerr = s.Update(role.Id, SetRole{Auths: &auths, DataScope: &scope})
+		if cerr != nil {
+			return primitive.NilObjectID, cerr
+		}
+	}
+	return role.Id, nil
+}
+
+/*
+ * 为没有数据范围的旧角色补上数据范围
+ * 旧版本用“跨部门”权限对象控制能否访问其他部门的用户：拥有的迁移为全部，否则为本部门，并移除该权限对象
+ */
+func (s *Role) MigrateDataScope(transDepartmentObj int64) *radarerror.CommonError {
+	filter := bson.M{
+		model.ColRoleDataScope: bson.M{"$in": []interface{}{nil, ""}},
+	}
+	var roles []model.Role
+	err := s.Dao.Gets(&roles, filter)
+	if err != nil {
+		log.Errorf("fail to get roles: %v", err)
+		return &radarerror.InternalServerError
+	}
+
+	for _, role := range roles {
+		scope := DataScopeDepartment
+		if _, ok := role.Auths[transDepartmentObj]; ok {
+			scope = DataScopeAll
+		}
+		log.Infof("migrate role data scope: %v %v", role.Name, scope)
+		update := bson.M{
+			"$set":   bson.M{model.ColRoleDataScope: scope},
+			"$unset": bson.M{fmt.Sprintf("%v.%v", model.ColRoleAuths, transDepartmentObj): ""},
+		}
+		_, err = s.Dao.UpdateById(s.ME.Id, role.Id, update)
+		if err != nil {
+			log.Errorf("fail to update role: %v", err)
+			return &radarerror.InternalServerError
+		}
+	}
+	return nil
+}
+
+/***** 辅助函数 *****/
+
+// 校验上级角色都存在，且不会继承到自己；返回去重后的上级角色id
+func (s *Role) checkParents(id primitive.ObjectID, platform int64, parents []primitive.ObjectID) ([]primitive.ObjectID, *radarerror.CommonError) {
+	if len(parents) == 0 {
+		return parents, nil
+	}
+	parents, cerr := s.CheckIds(parents)
+	if cerr != nil {
+		return nil, cerr
+	}
+	// 只能继承同一平台的角色
+	parentRoles, cerr := s.GetByIds(parents)
+	if cerr != nil {
+		return nil, cerr
+	}
+	for _, parent := range parentRoles {
+		if parent.Platform != platform {
+			log.Errorf("parent role of another platform: %v, platform: %v", parent.Id.Hex(), parent.Platform)
+			return nil, &radarerror.PlatformMismatch
+		}
+	}
+	if id == primitive.NilObjectID {
+		return parents, nil
+	}
+	ancestors, cerr := s.GetsWithAncestors(parents)
+	if cerr != nil {
+		return nil, cerr
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.Id == id {
+			log.Errorf("role inherit cycle: %v, parents: %v", id.Hex(), parents)
+			return nil, &radarerror.RoleInheritCycle
+		}
+	}
+	return parents, nil
+}
+
+// 校验数据范围，custom时指定的部门必须存在
+func (s *Role) checkDataScope(scope string, deptIds []primitive.ObjectID) *radarerror.CommonError {
+	if !IsValidDataScope(scope) {
+		log.Errorf("invalid data scope: %v", scope)
+		return &radarerror.InvalidArgs
+	}
+	if scope != DataScopeCustom {
+		return nil
+	}
+	if len(deptIds) == 0 {
+		log.Errorf("custom data scope without department")
+		return &radarerror.InvalidArgs
+	}
+	svcDepartment := NewDepartmentService(&s.ME)
+	for _, id := range deptIds {
+		_, cerr := svcDepartment.GetById(id)
+		if cerr != nil {
+			return cerr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	"github.com/SeeJson/account/util/jwt"
+	redisdao "github.com/SeeJson/account/util/redis"
+	mstring "github.com/SeeJson/account/util/string"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SessionModeJwt    = "jwt"    // 会话信息全部写入jwt令牌
+	SessionModeOpaque = "opaque" // 令牌只是随机会话id，会话信息保存在redis
+
+	sessionToken    = "session_token_%v" // session_token_{token}
+	sessionTokenLen = 32                 // 随机会话id的字节数
+)
+
+type SessionConfig struct {
+	Mode   string `mapstructure:"mode"`    // 令牌模式 jwt|opaque，默认jwt
+	MaxAge int    `mapstructure:"max_age"` // opaque模式下的会话有效期，单位：秒
+}
+
+var sessionCfg SessionConfig
+
+func SetSessionConfig(c SessionConfig) {
+	sessionCfg = c
+}
+
+/*
+ * 根据用户信息组装某个平台的会话，只计算属于该平台的角色
+ */
+func NewME(user model.User, version int64, platform int64) (ME, *radarerror.CommonError) {
+	authMp := make(map[int64]int64)
+	me := ME{
+		Id:       user.Id,
+		Version:  version,
+		Tenant:   user.Tenant,
+		Platform: platform,
+		AuthMp:   authMp,
+
+		DataScope: DataScopeSelf,
+
+		Account:        user.Account,
+		Name:           user.Name,
+		PasswordReset:  user.PasswordReset,
+		Department:     user.Department,
+		DepartmentName: "",
+		Roles:          user.Roles,
+		RoleNames:      make([]string, 0, len(user.Roles)),
+		PoliceNumber:   user.PoliceNumber,
+		Phone:          user.Phone,
+	}
+
+	// 当前有效的临时授权：权限集直接合并，附加的角色与用户的角色一起计算
+	svcGrant := NewGrantService(&me)
+	grants, cerr := svcGrant.GetsActiveByUser(user.Id)
+	if cerr != nil {
+		return me, cerr
+	}
+	roleIds := append(append([]primitive.ObjectID{}, user.Roles...), mergeGrants(&me, grants)...)
+
+	// 各角色及其继承的上级角色的权限集、数据范围取并集
+	if len(roleIds) > 0 {
+		svcRole := NewRoleService(&me)
+		roles, cerr := svcRole.GetsWithAncestors(roleIds)
+		if cerr != nil {
+			return me, cerr
+		}
+		own := make(map[primitive.ObjectID]bool, len(roleIds))
+		for _, id := range roleIds {
+			own[id] = true
+		}
+		for _, role := range roles {
+			if role.Platform != platform {
+				continue
+			}
+			if own[role.Id] {
+				me.RoleNames = append(me.RoleNames, role.Name)
+			}
+			MergeAuthMp(me.AuthMp, role.Auths)
+			MergeDataScope(&me, role.DataScope, role.DataScopeDepartments)
+		}
+	}
+
+	// 部门名
+	if user.Department != primitive.NilObjectID {
+		svcDepartment := NewDepartmentService(&me)
+		department, cerr := svcDepartment.GetById(user.Department)
+		if cerr == nil {
+			me.DepartmentName = department.Name
+		} else if cerr != &radarerror.DepartmentNotFound {
+			return me, cerr
+		}
+	}
+	return me, nil
+}
+
+/*
+ * 把权限集auths合并到authMp，同一权限对象的权限动作取或
+ */
+func MergeAuthMp(authMp map[int64]int64, auths map[int64]int64) {
+	for obj, acts := range auths {
+		authMp[obj] |= acts
+	}
+}
+
+/*
+ * 签发令牌
+ * jwt模式下令牌携带完整会话；opaque模式下令牌是随机会话id，会话保存在redis
+ */
+func GenSessionToken(me ME) (string, error) {
+	if sessionCfg.Mode != SessionModeOpaque {
+		return jwt.GenBase64Token(me.Json())
+	}
+
+	token, err := mstring.GetRandomHex(sessionTokenLen)
+	if err != nil {
+		log.Errorf("fail to generate session token: %v", err)
+		return "", err
+	}
+	key := fmt.Sprintf(sessionToken, token)
+	err = redisdao.Set(key, me.Json(), time.Duration(sessionCfg.MaxAge)*time.Second)
+	if err != nil {
+		log.Errorf("fail to save session: %v", err)
+		return "", err
+	}
+	return token, nil
+}
+
+/*
+ * 重新签发令牌，用于重新验证身份等会话内容变更
+ * opaque模式下同时删除旧的会话，旧令牌立即失效；jwt模式下旧令牌无法撤销，仍到期失效
+ */
+func ReissueSessionToken(oldToken string, me ME) (string, error) {
+	token, err := GenSessionToken(me)
+	if err != nil {
+		return "", err
+	}
+	if sessionCfg.Mode == SessionModeOpaque && oldToken != "" {
+		err = redisdao.Del(fmt.Sprintf(sessionToken, oldToken))
+		if err != nil {
+			log.Errorf("fail to delete old session: %v", err)
+		}
+	}
+	return token, nil
+}
+
+/*
+ * 解析令牌，获得会话
+ * opaque模式下每次都根据最新的用户数据重新组装会话，权限变更可以立即生效
+ */
+func LoadSessionToken(token string) (*ME, error) {
+	if sessionCfg.Mode != SessionModeOpaque {
+		jwtClaim, err := jwt.DecodeB64Token(token)
+		if err != nil {
+			return nil, err
+		}
+
+		// check token timeout
+		if jwtClaim.Exp < time.Now().Unix() {
+			log.Errorf("token expired: %v", token)
+			return nil, errors.New("token expired")
+		}
+		return LoadME(jwtClaim.Payload)
+	}
+
+	key := fmt.Sprintf(sessionToken, token)
+	jsonStr, err := redisdao.Get(key)
+	if err != nil {
+		log.Errorf("session not found: %v", err)
+		return nil, err
+	}
+	me, err := LoadME(jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	if me.BreakGlass {
+		return me, nil
+	}
+
+	svcUser := NewUserService(me)
+	user, cerr := svcUser.GetById(me.Id)
+	if cerr != nil {
+		return nil, cerr
+	}
+	newMe, cerr := NewME(user, me.Version, me.Platform)
+	if cerr != nil {
+		return nil, cerr
+	}
+	newMe.ReauthTime = me.ReauthTime
+	return &newMe, nil
+}
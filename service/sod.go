@@ -0,0 +1,324 @@
+package service
+
+import (
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Sod struct {
+	ME  ME
+	Dao model.SodConstraintDao
+}
+
+func NewSodService(me *ME) Sod {
+	s := Sod{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewSodConstraintDao()
+	s.ME.bindDao(&s.Dao.DataDao)
+	return s
+}
+
+// 违反的一条约束，及用户同时拥有的互斥项
+type SodConflict struct {
+	Constraint model.SodConstraint
+	Roles      []primitive.ObjectID // 拥有的互斥角色
+	Auths      []model.SodAuth      // 拥有的互斥权限
+}
+
+// 已违反约束的用户
+type SodUserViolation struct {
+	User      model.User
+	Conflicts []SodConflict
+}
+
+/*
+ * 获取约束
+ */
+func (s *Sod) GetById(id primitive.ObjectID) (model.SodConstraint, *radarerror.CommonError) {
+	var constraint model.SodConstraint
+	err := s.Dao.GetById(&constraint, id)
+	if err == mongo.ErrNoDocuments {
+		log.Errorf("sod constraint not found: %v", id.Hex())
+		return constraint, &radarerror.SodConstraintNotFound
+	} else if err != nil {
+		log.Errorf("fail to get sod constraint: %v", err)
+		return constraint, &radarerror.InternalServerError
+	}
+	return constraint, nil
+}
+
+/*
+ * 获取全部约束
+ */
+func (s *Sod) Gets() ([]model.SodConstraint, *radarerror.CommonError) {
+	opts := &options.FindOptions{}
+	opts.SetSort(bson.M{modelbase.ColId: 1})
+	constraints := make([]model.SodConstraint, 0)
+	err := s.Dao.Gets(&constraints, bson.M{}, opts)
+	if err != nil {
+		log.Errorf("fail to get sod constraints: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return constraints, nil
+}
+
+/*
+ * 新增约束，互斥项（角色与权限合计）至少两项
+ * 已违反新约束的用户不受影响，可通过违规报告查看
+ */
+func (s *Sod) Add(constraint model.SodConstraint) (primitive.ObjectID, *radarerror.CommonError) {
+	if constraint.Name == "" {
+		log.Errorf("sod constraint name cannot empty")
+		return primitive.NilObjectID, &radarerror.InvalidArgs
+	}
+	var cerr *radarerror.CommonError
+	if len(constraint.Roles) > 0 {
+		svcRole := NewRoleService(&s.ME)
+		constraint.Roles, cerr = svcRole.CheckIds(constraint.Roles)
+		if cerr != nil {
+			return primitive.NilObjectID, cerr
+		}
+	} else {
+		constraint.Roles = make([]primitive.ObjectID, 0)
+	}
+	if constraint.Auths == nil {
+		constraint.Auths = make([]model.SodAuth, 0)
+	}
+	svcAuth := NewAuthService(&s.ME)
+	for _, auth := range constraint.Auths {
+		if auth.Platform < 0 || auth.Obj <= 0 || auth.Act <= 0 {
+			log.Errorf("invalid sod auth: %+v", auth)
+			return primitive.NilObjectID, &radarerror.InvalidAuths
+		}
+		if auth.Platform != 0 {
+			cerr = svcAuth.CheckPlatformAuths(auth.Platform, map[int64]int64{auth.Obj: auth.Act})
+			if cerr != nil {
+				return primitive.NilObjectID, cerr
+			}
+		}
+	}
+	if len(constraint.Roles)+len(constraint.Auths) < 2 {
+		log.Errorf("sod constraint needs at least 2 members: %v", constraint.Name)
+		return primitive.NilObjectID, &radarerror.InvalidArgs
+	}
+
+	id, err := s.Dao.Add(s.ME.Id, constraint)
+	if err != nil {
+		log.Errorf("fail to add sod constraint: %v", err)
+		return primitive.NilObjectID, &radarerror.InternalServerError
+	}
+	return id, nil
+}
+
+/*
+ * 删除约束
+ */
+func (s *Sod) Delete(id primitive.ObjectID) *radarerror.CommonError {
+	_, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+	_, err := s.Dao.DelById(s.ME.Id, id)
+	if err != nil {
+		log.Errorf("fail to delete sod constraint: %v", err)
+		return &radarerror.InternalServerError
+	}
+	return nil
+}
+
+/*
+ * 违规报告：数据范围内已违反约束的用户，含当前有效的临时授权
+ */
+func (s *Sod) Violations() ([]SodUserViolation, *radarerror.CommonError) {
+	result := make([]SodUserViolation, 0)
+	constraints, cerr := s.Gets()
+	if cerr != nil || len(constraints) == 0 {
+		return result, cerr
+	}
+	graph, cerr := loadSodRoleGraph(s.ME.Tenant, nil)
+	if cerr != nil {
+		return nil, cerr
+	}
+	svcUser := NewUserService(&s.ME)
+	users, cerr := svcUser.Gets(0, 0, FilterUser{})
+	if cerr != nil {
+		return nil, cerr
+	}
+	// 当前有效的临时授权附加的角色和权限也计入
+	svcGrant := NewGrantService(SystemME(s.ME.Tenant))
+	grants, cerr := svcGrant.GetsActive()
+	if cerr != nil {
+		return nil, cerr
+	}
+	userGrants := make(map[primitive.ObjectID][]model.Grant)
+	for _, grant := range grants {
+		userGrants[grant.User] = append(userGrants[grant.User], grant)
+	}
+	for _, user := range users {
+		roleIds, grantAuths := mergeGrantHoldings(user.Roles, userGrants[user.Id])
+		conflicts := sodConflicts(constraints, graph, roleIds, grantAuths)
+		if len(conflicts) > 0 {
+			result = append(result, SodUserViolation{User: user, Conflicts: conflicts})
+		}
+	}
+	return result, nil
+}
+
+/*
+ * 校验一组角色（含继承）加上临时授权的权限是否违反约束，用于给用户分配角色和新增临时授权
+ */
+func CheckSodRoles(tenant int64, roleIds []primitive.ObjectID, grantAuths map[int64]int64) *radarerror.CommonError {
+	svcSod := NewSodService(SystemME(tenant))
+	constraints, cerr := svcSod.Gets()
+	if cerr != nil || len(constraints) == 0 {
+		return cerr
+	}
+	graph, cerr := loadSodRoleGraph(tenant, nil)
+	if cerr != nil {
+		return cerr
+	}
+	conflicts := sodConflicts(constraints, graph, roleIds, grantAuths)
+	if len(conflicts) > 0 {
+		log.Errorf("sod violation: roles %v, auths %v, constraint: %v", roleIds, grantAuths, conflicts[0].Constraint.Name)
+		return &radarerror.SodViolation
+	}
+	return nil
+}
+
+/*
+ * 校验角色的新定义：角色本身，以及直接或通过下级角色间接拥有该角色的用户，都不能违反约束
+ * 新增角色时role.Id为空
+ */
+func checkSodRole(tenant int64, role model.Role) *radarerror.CommonError {
+	svcSod := NewSodService(SystemME(tenant))
+	constraints, cerr := svcSod.Gets()
+	if cerr != nil || len(constraints) == 0 {
+		return cerr
+	}
+	graph, cerr := loadSodRoleGraph(tenant, &role)
+	if cerr != nil {
+		return cerr
+	}
+	conflicts := sodConflicts(constraints, graph, []primitive.ObjectID{role.Id}, nil)
+	if len(conflicts) > 0 {
+		log.Errorf("sod violation: role %v, constraint: %v", role.Name, conflicts[0].Constraint.Name)
+		return &radarerror.SodViolation
+	}
+	if role.Id == primitive.NilObjectID {
+		return nil
+	}
+
+	svcRole := NewRoleService(SystemME(tenant))
+	roleIds, cerr := svcRole.GetDescendantIds(role.Id)
+	if cerr != nil {
+		return cerr
+	}
+	roleIds = append(roleIds, role.Id)
+	svcUser := NewUserService(SystemME(tenant))
+	var users []model.User
+	err := svcUser.Dao.Gets(&users, bson.M{model.ColUserRoles: bson.M{"$in": roleIds}})
+	if err != nil {
+		log.Errorf("fail to get users: %v", err)
+		return &radarerror.InternalServerError
+	}
+	for _, user := range users {
+		conflicts = sodConflicts(constraints, graph, user.Roles, nil)
+		if len(conflicts) > 0 {
+			log.Errorf("sod violation: role %v, user %v, constraint: %v", role.Name, user.Account, conflicts[0].Constraint.Name)
+			return &radarerror.SodViolation
+		}
+	}
+	return nil
+}
+
+// 用户的角色加上临时授权附加的角色，及临时授权的权限合集
+func mergeGrantHoldings(roleIds []primitive.ObjectID, grants []model.Grant) ([]primitive.ObjectID, map[int64]int64) {
+	roleIds = append([]primitive.ObjectID{}, roleIds...)
+	auths := make(map[int64]int64)
+	for _, grant := range grants {
+		roleIds = append(roleIds, grant.Roles...)
+		MergeAuthMp(auths, grant.Auths)
+	}
+	return roleIds, auths
+}
+
+// 租户内全部角色，override替换（或新增）其中一个角色的定义
+type sodRoleGraph map[primitive.ObjectID]model.Role
+
+func loadSodRoleGraph(tenant int64, override *model.Role) (sodRoleGraph, *radarerror.CommonError) {
+	svcRole := NewRoleService(SystemME(tenant))
+	var roles []model.Role
+	err := svcRole.Dao.Gets(&roles, bson.M{})
+	if err != nil {
+		log.Errorf("fail to get roles: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	graph := make(sodRoleGraph, len(roles)+1)
+	for _, role := range roles {
+		graph[role.Id] = role
+	}
+	if override != nil {
+		graph[override.Id] = *override
+	}
+	return graph, nil
+}
+
+// 展开角色及其所有上级角色，返回拥有的角色和按平台合并后的权限集
+func (g sodRoleGraph) expand(roleIds []primitive.ObjectID) (map[primitive.ObjectID]bool, map[int64]map[int64]int64) {
+	held := make(map[primitive.ObjectID]bool)
+	auths := make(map[int64]map[int64]int64)
+	for len(roleIds) > 0 {
+		var next []primitive.ObjectID
+		for _, id := range roleIds {
+			role, ok := g[id]
+			if !ok || held[id] {
+				continue
+			}
+			held[id] = true
+			if auths[role.Platform] == nil {
+				auths[role.Platform] = make(map[int64]int64)
+			}
+			MergeAuthMp(auths[role.Platform], role.Auths)
+			next = append(next, role.Parents...)
+		}
+		roleIds = next
+	}
+	return held, auths
+}
+
+// 一组角色加上直接授予的权限（临时授权，属于账号中心）违反的约束：同时拥有某条约束中的两项及以上
+func sodConflicts(constraints []model.SodConstraint, graph sodRoleGraph, roleIds []primitive.ObjectID, grantAuths map[int64]int64) []SodConflict {
+	held, auths := graph.expand(roleIds)
+	if len(grantAuths) > 0 {
+		if auths[0] == nil {
+			auths[0] = make(map[int64]int64)
+		}
+		MergeAuthMp(auths[0], grantAuths)
+	}
+	var conflicts []SodConflict
+	for _, constraint := range constraints {
+		conflict := SodConflict{Constraint: constraint}
+		for _, id := range constraint.Roles {
+			if held[id] {
+				conflict.Roles = append(conflict.Roles, id)
+			}
+		}
+		for _, auth := range constraint.Auths {
+			if auths[auth.Platform][auth.Obj]&auth.Act == auth.Act {
+				conflict.Auths = append(conflict.Auths, auth)
+			}
+		}
+		if len(conflict.Roles)+len(conflict.Auths) >= 2 {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
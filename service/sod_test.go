@@ -0,0 +1,74 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSodConflicts(t *testing.T) {
+	newRole := func(auths map[int64]int64, parents ...primitive.ObjectID) model.Role {
+		return model.Role{
+			DataModel: modelbase.DataModel{Id: primitive.NewObjectID()},
+			Auths:     auths,
+			Parents:   parents,
+		}
+	}
+	creator := newRole(map[int64]int64{19: 1 | 2})
+	approver := newRole(map[int64]int64{20: 4})
+	inherit := newRole(nil, approver.Id)
+	viewer := newRole(map[int64]int64{19: 1})
+	other := newRole(map[int64]int64{20: 4}) // 其他平台的同名掩码不算
+	other.Platform = 2
+	graph := sodRoleGraph{}
+	for _, role := range []model.Role{creator, approver, inherit, viewer, other} {
+		graph[role.Id] = role
+	}
+
+	byRole := model.SodConstraint{Name: "by role", Roles: []primitive.ObjectID{creator.Id, approver.Id}}
+	byAuth := model.SodConstraint{Name: "by auth", Auths: []model.SodAuth{{Obj: 19, Act: 2}, {Obj: 20, Act: 4}}}
+	constraints := []model.SodConstraint{byRole, byAuth}
+
+	cases := []struct {
+		roles      []primitive.ObjectID
+		grantAuths map[int64]int64
+		violated   int
+	}{
+		{[]primitive.ObjectID{creator.Id}, nil, 0},
+		{[]primitive.ObjectID{creator.Id, viewer.Id}, nil, 0},
+		{[]primitive.ObjectID{creator.Id, approver.Id}, nil, 2},
+		{[]primitive.ObjectID{creator.Id, inherit.Id}, nil, 2}, // 通过继承得到互斥角色
+		{[]primitive.ObjectID{viewer.Id, inherit.Id}, nil, 0},
+		{[]primitive.ObjectID{creator.Id, other.Id}, nil, 0},
+		{[]primitive.ObjectID{creator.Id}, map[int64]int64{20: 4}, 1}, // 临时授权的权限
+		{[]primitive.ObjectID{viewer.Id}, map[int64]int64{19: 2, 20: 4}, 1},
+	}
+	for i, c := range cases {
+		conflicts := sodConflicts(constraints, graph, c.roles, c.grantAuths)
+		if len(conflicts) != c.violated {
+			t.Fatalf("case %v: expect %v conflicts, got %+v", i, c.violated, conflicts)
+		}
+	}
+}
+
+func TestMergeGrantHoldings(t *testing.T) {
+	roleA, roleB, roleC := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	userRoles := []primitive.ObjectID{roleA}
+	grants := []model.Grant{
+		{Roles: []primitive.ObjectID{roleB}, Auths: map[int64]int64{19: 1}},
+		{Roles: []primitive.ObjectID{roleC}, Auths: map[int64]int64{19: 2, 20: 4}},
+	}
+	roleIds, auths := mergeGrantHoldings(userRoles, grants)
+	if !reflect.DeepEqual(roleIds, []primitive.ObjectID{roleA, roleB, roleC}) {
+		t.Fatalf("unexpected roles: %v", roleIds)
+	}
+	if !reflect.DeepEqual(auths, map[int64]int64{19: 3, 20: 4}) {
+		t.Fatalf("unexpected auths: %v", auths)
+	}
+	if len(userRoles) != 1 {
+		t.Fatalf("user roles modified: %v", userRoles)
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"time"
+
+	radarerror "github.com/SeeJson/account/error"
+	"github.com/SeeJson/account/model"
+	modelbase "github.com/SeeJson/account/model/base"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TenantConfig struct {
+	SuperAdminRole string `mapstructure:"super_admin_role"` // 新租户初始管理员的角色名，应与审批、审查配置的角色名一致
+}
+
+var tenantCfg TenantConfig
+
+func SetTenantConfig(c TenantConfig) {
+	tenantCfg = c
+}
+
+// 租户的初始管理员
+type TenantAdmin struct {
+	SuperAdminRole string // 超级管理员角色名，拥有全部权限
+	RootDepartment string // 初始管理员所在的顶级部门名
+	Account        string // 初始管理员账号，为空则只创建角色；初始密码为默认密码
+	Name           string // 初始管理员显示名
+}
+
+/*
+ * 租户管理，只有默认租户（平台运营方）可以查看、新增、编辑租户
+ */
+type Tenant struct {
+	ME  ME
+	Dao model.TenantDao
+}
+
+func NewTenantService(me *ME) Tenant {
+	s := Tenant{}
+	if me != nil {
+		s.ME = *me
+	}
+	s.Dao = model.NewTenantDao()
+	return s
+}
+
+/*
+ * 获取租户
+ */
+func (s *Tenant) GetByUid(uid int64) (model.Tenant, *radarerror.CommonError) {
+	var tenant model.Tenant
+	err := s.Dao.GetByUid(&tenant, uid)
+	if err == mongo.ErrNoDocuments {
+		log.Errorf("tenant not found: %v", uid)
+		return tenant, &radarerror.TenantNotFound
+	} else if err != nil {
+		log.Errorf("fail to get tenant: %v", err)
+		return tenant, &radarerror.InternalServerError
+	}
+	return tenant, nil
+}
+
+/*
+ * 校验租户是否存在，默认租户总是存在
+ */
+func (s *Tenant) Check(uid int64) *radarerror.CommonError {
+	if uid == modelbase.TenantDefault {
+		return nil
+	}
+	_, cerr := s.GetByUid(uid)
+	return cerr
+}
+
+/*
+ * 获取全部租户（不含默认租户）
+ */
+func (s *Tenant) Gets() ([]model.Tenant, *radarerror.CommonError) {
+	cerr := checkHostTenant(&s.ME)
+	if cerr != nil {
+		return nil, cerr
+	}
+	opts := &options.FindOptions{}
+	opts.SetSort(bson.M{modelbase.ColUid: 1})
+	tenants := make([]model.Tenant, 0)
+	err := s.Dao.Gets(&tenants, bson.M{}, opts)
+	if err != nil {
+		log.Errorf("fail to get tenants: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	return tenants, nil
+}
+
+/*
+ * 新增租户，并初始化超级管理员角色和初始管理员
+ * auths为超级管理员角色的权限集
+ */
+func (s *Tenant) Add(tenant model.Tenant, admin TenantAdmin, auths map[int64]int64) (int64, *radarerror.CommonError) {
+	cerr := checkHostTenant(&s.ME)
+	if cerr != nil {
+		return 0, cerr
+	}
+	if tenant.Name == "" {
+		log.Errorf("tenant name cannot empty")
+		return 0, &radarerror.InvalidArgs
+	}
+	cerr = s.checkDuplicatedName(tenant.Name, 0)
+	if cerr != nil {
+		return 0, cerr
+	}
+
+	uid, err := s.Dao.NextUid()
+	if err != nil {
+		log.Errorf("fail to generate tenant uid: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+	tenant.Uid = uid
+	tenant.CreateTime = time.Now()
+	_, err = s.Dao.Add(tenant)
+	if err != nil {
+		log.Errorf("fail to add tenant: %v", err)
+		return 0, &radarerror.InternalServerError
+	}
+
+	if admin.SuperAdminRole == "" {
+		admin.SuperAdminRole = tenantCfg.SuperAdminRole
+	}
+	if admin.RootDepartment == "" {
+		admin.RootDepartment = tenant.Name
+	}
+	cerr = InitTenantAdmin(uid, admin, auths)
+	if cerr != nil {
+		return uid, cerr
+	}
+	return uid, nil
+}
+
+type SetTenant struct {
+	Name *string `json:"name"` // 显示名
+}
+
+/*
+ * 编辑
+ */
+func (s *Tenant) Update(uid int64, setCVs SetTenant) *radarerror.CommonError {
+	cerr := checkHostTenant(&s.ME)
+	if cerr != nil {
+		return cerr
+	}
+	_, cerr = s.GetByUid(uid)
+	if cerr != nil {
+		return cerr
+	}
+
+	update := bson.M{"$set": bson.M{}}
+	if setCVs.Name != nil {
+		if *setCVs.Name == "" {
+			log.Errorf("tenant name cannot empty")
+			return &radarerror.InvalidArgs
+		}
+		cerr = s.checkDuplicatedName(*setCVs.Name, uid)
+		if cerr != nil {
+			return cerr
+		}
+		update["$set"].(bson.M)[model.ColTenantName] = *setCVs.Name
+	}
+	if len(update["$set"].(bson.M)) == 0 {
+		return nil
+	}
+
+	_, err := s.Dao.UpdateByUid(uid, update)
+	if err != nil {
+		log.Errorf("fail to update tenant: %v", err)
+		return &radarerror.InternalServerError
+	}
+	return nil
+}
+
+/*
+ * 租户、平台等各租户共享的数据只有默认租户（平台运营方）的操作人能管理
+ */
+func checkHostTenant(me *ME) *radarerror.CommonError {
+	if me.Tenant != modelbase.TenantDefault {
+		log.Errorf("tenant %v cannot modify shared data: %v", me.Tenant, me.Id.Hex())
+		return &radarerror.ForbiddenAccess
+	}
+	return nil
+}
+
+func (s *Tenant) checkDuplicatedName(name string, excludeUid int64) *radarerror.CommonError {
+	var tenant model.Tenant
+	err := s.Dao.Get(&tenant, bson.M{model.ColTenantName: name})
+	if err == nil && tenant.Uid != excludeUid {
+		log.Errorf("duplicated tenant name: %v", name)
+		return &radarerror.DuplicatedTenantName
+	} else if err != nil && err != mongo.ErrNoDocuments {
+		log.Errorf("fail to get tenant: %v", err)
+		return &radarerror.InternalServerError
+	}
+	return nil
+}
+
+/*
+ * 全部租户uid，含默认租户，供后台任务逐个租户执行
+ */
+func TenantUids() ([]int64, *radarerror.CommonError) {
+	svcTenant := NewTenantService(nil)
+	tenants, cerr := svcTenant.Gets()
+	if cerr != nil {
+		return nil, cerr
+	}
+	uids := make([]int64, 0, len(tenants)+1)
+	uids = append(uids, modelbase.TenantDefault)
+	for _, tenant := range tenants {
+		uids = append(uids, tenant.Uid)
+	}
+	return uids, nil
+}
+
+/*
+ * 初始化租户的超级管理员角色和初始管理员，可重复执行
+ */
+func InitTenantAdmin(tenant int64, admin TenantAdmin, auths map[int64]int64) *radarerror.CommonError {
+	me := SystemME(tenant)
+
+	// 超级管理员角色
+	svcRole := NewRoleService(me)
+	roleId, cerr := svcRole.InitSuperAdmin(admin.SuperAdminRole, auths)
+	if cerr != nil {
+		return cerr
+	}
+
+	// 初始管理员
+	if admin.Account == "" {
+		return nil
+	}
+	svcUser := NewUserService(me)
+	_, cerr = svcUser.GetByAccount(admin.Account)
+	if cerr == nil {
+		return nil
+	} else if cerr != &radarerror.UserNotFound {
+		return cerr
+	}
+
+	svcDepartment := NewDepartmentService(me)
+	departmentId, cerr := svcDepartment.GetOrAddRoot(admin.RootDepartment)
+	if cerr != nil {
+		return cerr
+	}
+
+	log.Infof("init admin account: %v, tenant: %v", admin.Account, tenant)
+	_, cerr = svcUser.Add(model.User{
+		Account:    admin.Account,
+		Name:       admin.Name,
+		Department: departmentId,
+		Roles:      []primitive.ObjectID{roleId},
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return nil
+}
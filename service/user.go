@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	radarerror "github.com/SeeJson/account/error"
@@ -24,6 +25,10 @@ import (
 
 const (
 	userVersion = "user_version_%v" // userver_version_{user id}
+	pwdFailure  = "pwd_failure_%v"  // pwd_failure_{user id}，连续输错密码的次数
+
+	loginFailureAccount = "login_failure_account_%v" // login_failure_account_{account}，该账号登录输错密码的次数
+	loginFailureIp      = "login_failure_ip_%v"      // login_failure_ip_{ip}，该ip登录输错密码的次数
 )
 
 type UserConfig struct {
@@ -31,6 +36,8 @@ type UserConfig struct {
 	UserDefaultPassword   string `mapstructure:"user_default_password"`
 	MaxPoliceNumberLength int    `mapstructure:"max_police_number_length"`
 	MaxNameLength         int    `mapstructure:"max_name_length"`
+	MaxPasswordFailure    int64  `mapstructure:"max_password_failure"`    // 连续输错密码达到该次数后，登录和重新验证身份须带验证码；0)不限制
+	PasswordFailureWindow int    `mapstructure:"password_failure_window"` // 输错次数的统计窗口，秒
 }
 
 var userCfg UserConfig
@@ -50,9 +57,13 @@ func NewUserService(me *ME) User {
 		s.ME = *me
 	}
 	s.Dao = model.NewUserDao()
+	s.ME.bindDao(&s.Dao.DataDao)
 	return s
 }
 
+/*
+ * 按账号查找，账号在租户内唯一
+ */
 func (s *User) GetByAccount(account string) (model.User, *radarerror.CommonError) {
 	filter := bson.M{
 		model.ColUserAccount: account,
@@ -68,6 +79,9 @@ func (s *User) GetByAccount(account string) (model.User, *radarerror.CommonError
 	return user, nil
 }
 
+/*
+ * 按警号查找，警号在租户内唯一
+ */
 func (s *User) GetByPoliceNumber(policeNumber string) (model.User, *radarerror.CommonError) {
 	filter := bson.M{
 		model.ColUserPoliceNumber: policeNumber,
@@ -99,9 +113,35 @@ func (s *User) GetById(id primitive.ObjectID) (model.User, *radarerror.CommonErr
 	return user, nil
 }
 
+/*
+ * 获取用户id到姓名的映射，用于列表展示；找不到的用户（如已物理删除）不在映射里
+ */
+func (s *User) GetNameMap(ids []primitive.ObjectID) (map[primitive.ObjectID]string, *radarerror.CommonError) {
+	var users []model.User
+	err := s.Dao.GetByIds(&users, ids)
+	if err != nil {
+		log.Errorf("fail to get users: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	names := make(map[primitive.ObjectID]string, len(users))
+	for _, user := range users {
+		names[user.Id] = user.Name
+	}
+	// 应急账号没有用户文档，但会作为创建人、编辑人写入数据
+	for _, id := range ids {
+		if _, ok := names[id]; ok {
+			continue
+		}
+		if account, ok := BreakGlassAccountById(id); ok {
+			names[id] = account
+		}
+	}
+	return names, nil
+}
+
 type FilterUser struct {
 	Department *primitive.ObjectID // 部门id
-	Role       *primitive.ObjectID // 角色id
+	Role       *primitive.ObjectID // 角色id；拥有该角色即匹配
 	Name       *string             // 搜索用户名、姓名或警号；模糊匹配
 }
 
@@ -113,7 +153,7 @@ func (s *User) ConvertFilter(filter FilterUser) bson.M {
 		mFilter[model.ColUserDepartment] = *filter.Department
 	}
 	if filter.Role != nil {
-		mFilter[model.ColUserRole] = *filter.Role
+		mFilter[model.ColUserRoles] = *filter.Role
 	}
 	if filter.Name != nil {
 		mFilter["$or"] = []bson.M{
@@ -131,6 +171,10 @@ func (s *User) ConvertFilter(filter FilterUser) bson.M {
  */
 func (s *User) Gets(page, pageSize int64, filter FilterUser) ([]model.User, *radarerror.CommonError) {
 	mFilter := s.ConvertFilter(filter)
+	cerr := scopeUserFilter(&s.ME, mFilter)
+	if cerr != nil {
+		return nil, cerr
+	}
 	opts := &options.FindOptions{}
 	if pageSize > 0 {
 		opts.SetLimit(pageSize)
@@ -151,6 +195,10 @@ func (s *User) Gets(page, pageSize int64, filter FilterUser) ([]model.User, *rad
  */
 func (s *User) GetCount(filter FilterUser) (int64, *radarerror.CommonError) {
 	mFilter := s.ConvertFilter(filter)
+	cerr := scopeUserFilter(&s.ME, mFilter)
+	if cerr != nil {
+		return 0, cerr
+	}
 	count, err := s.Dao.GetCount(mFilter)
 	if err != nil {
 		log.Errorf("fail to get user count: %v", err)
@@ -165,6 +213,10 @@ func (s *User) GetCount(filter FilterUser) (int64, *radarerror.CommonError) {
  */
 func (s *User) GetDeletedCount(filter FilterUser) (int64, *radarerror.CommonError) {
 	mFilter := s.ConvertFilter(filter)
+	cerr := scopeUserFilter(&s.ME, mFilter)
+	if cerr != nil {
+		return 0, cerr
+	}
 	(mFilter)[modelbase.ColIsDelete] = true
 	count, err := s.Dao.GetCount(mFilter)
 	if err != nil {
@@ -181,6 +233,10 @@ func (s *User) GetDeletedCount(filter FilterUser) (int64, *radarerror.CommonErro
  */
 func (s *User) GetsDeleted(page, pageSize int64, filter FilterUser) ([]model.User, *radarerror.CommonError) {
 	mFilter := s.ConvertFilter(filter)
+	cerr := scopeUserFilter(&s.ME, mFilter)
+	if cerr != nil {
+		return nil, cerr
+	}
 	(mFilter)[modelbase.ColIsDelete] = true
 	opts := &options.FindOptions{}
 	if pageSize > 0 {
@@ -197,6 +253,71 @@ func (s *User) GetsDeleted(page, pageSize int64, filter FilterUser) ([]model.Use
 	return models, nil
 }
 
+/*
+ * 统计各部门的用户数
+ */
+func (s *User) CountByDepartment() (map[primitive.ObjectID]int64, *radarerror.CommonError) {
+	pipeline := []bson.M{
+		{"$match": s.Dao.MatchTenant(bson.M{modelbase.ColIsDelete: false})},
+		{"$group": bson.M{
+			modelbase.ColId: "$" + model.ColUserDepartment,
+			"count":         bson.M{"$sum": 1},
+		}},
+	}
+	var results []struct {
+		Department primitive.ObjectID `bson:"_id"`
+		Count      int64              `bson:"count"`
+	}
+	err := s.Dao.Aggregate(&results, pipeline)
+	if err != nil {
+		log.Errorf("fail to count users by department: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	counts := make(map[primitive.ObjectID]int64, len(results))
+	for _, result := range results {
+		counts[result.Department] = result.Count
+	}
+	return counts, nil
+}
+
+/*
+ * 统计拥有各角色的用户数，受数据范围限制
+ */
+func (s *User) CountByRoles(roleIds []primitive.ObjectID) (map[primitive.ObjectID]int64, *radarerror.CommonError) {
+	counts := make(map[primitive.ObjectID]int64, len(roleIds))
+	if len(roleIds) == 0 {
+		return counts, nil
+	}
+	mFilter := bson.M{model.ColUserRoles: bson.M{"$in": roleIds}}
+	cerr := scopeUserFilter(&s.ME, mFilter)
+	if cerr != nil {
+		return nil, cerr
+	}
+	mFilter[modelbase.ColIsDelete] = false
+	pipeline := []bson.M{
+		{"$match": s.Dao.MatchTenant(mFilter)},
+		{"$unwind": "$" + model.ColUserRoles},
+		{"$match": bson.M{model.ColUserRoles: bson.M{"$in": roleIds}}},
+		{"$group": bson.M{
+			modelbase.ColId: "$" + model.ColUserRoles,
+			"count":         bson.M{"$sum": 1},
+		}},
+	}
+	var results []struct {
+		Role  primitive.ObjectID `bson:"_id"`
+		Count int64              `bson:"count"`
+	}
+	err := s.Dao.Aggregate(&results, pipeline)
+	if err != nil {
+		log.Errorf("fail to count users by roles: %v", err)
+		return nil, &radarerror.InternalServerError
+	}
+	for _, result := range results {
+		counts[result.Role] = result.Count
+	}
+	return counts, nil
+}
+
 /*
  * 添加
  */
@@ -214,7 +335,11 @@ func (s *User) Add(user model.User) (primitive.ObjectID, *radarerror.CommonError
 		log.Errorf("account cannot empty")
 		return primitive.NilObjectID, &radarerror.InvalidArgs
 	}
-	// account去重
+	// account去重，也不能与应急账号同名
+	if IsBreakGlassAccount(user.Account) {
+		log.Errorf("account used by break-glass: %v", user.Account)
+		return primitive.NilObjectID, &radarerror.DuplicatedAccount
+	}
 	_, cerr := s.GetByAccount(user.Account)
 	if cerr == nil {
 		log.Errorf("duplicated account: %v", user.Account)
@@ -223,6 +348,36 @@ func (s *User) Add(user model.User) (primitive.ObjectID, *radarerror.CommonError
 		return primitive.NilObjectID, cerr
 	}
 
+	// check department
+	svcDepartment := NewDepartmentService(&s.ME)
+	_, cerr = svcDepartment.GetById(user.Department)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+	cerr = CheckDepartmentInScope(&s.ME, user.Department)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+
+	// check roles
+	if len(user.Roles) == 0 {
+		log.Errorf("roles cannot empty")
+		return primitive.NilObjectID, &radarerror.InvalidArgs
+	}
+	svcRole := NewRoleService(&s.ME)
+	user.Roles, cerr = svcRole.CheckIds(user.Roles)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+	cerr = CheckSodRoles(s.ME.Tenant, user.Roles, nil)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+	cerr = CheckRolesWithinMe(&s.ME, user.Roles)
+	if cerr != nil {
+		return primitive.NilObjectID, cerr
+	}
+
 	// 加密密码
 	if user.Password == "" {
 		user.Password = crypt.CalMd5(userCfg.UserDefaultPassword) // 默认密码
@@ -263,25 +418,75 @@ func (s *User) Add(user model.User) (primitive.ObjectID, *radarerror.CommonError
 }
 
 type SetUser struct {
-	Department   *string `bson:"department"`    // 部门id
-	Role         *string `bson:"role"`          // 角色id
-	PoliceNumber *string `bson:"police_number"` // 警号
-	Phone        *string `bson:"phone"`         // 手机号
+	Department   *string   `bson:"department"`    // 部门id
+	Roles        *[]string `bson:"roles"`         // 角色id
+	PoliceNumber *string   `bson:"police_number"` // 警号
+	Phone        *string   `bson:"phone"`         // 手机号
 }
 
 /*
  * 编辑
  */
 func (s *User) Update(id primitive.ObjectID, setCVs SetUser) *radarerror.CommonError {
+	user, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+	cerr = CheckUserInScope(&s.ME, user)
+	if cerr != nil {
+		return cerr
+	}
+
 	update := bson.M{"$set": bson.M{}}
 
 	if setCVs.Department != nil {
 		deptId := mongodao.Hex2Id(*setCVs.Department)
+		svcDepartment := NewDepartmentService(&s.ME)
+		_, cerr := svcDepartment.GetById(deptId)
+		if cerr != nil {
+			return cerr
+		}
+		cerr = CheckDepartmentInScope(&s.ME, deptId)
+		if cerr != nil {
+			return cerr
+		}
 		update["$set"].(bson.M)[model.ColUserDepartment] = deptId
 	}
-	if setCVs.Role != nil {
-		roleId := mongodao.Hex2Id(*setCVs.Role)
-		update["$set"].(bson.M)[model.ColUserRole] = roleId
+	if setCVs.Roles != nil {
+		// 不能变更自己的角色
+		if id == s.ME.Id && !s.ME.BreakGlass {
+			log.Errorf("cannot change own roles: %v", id.Hex())
+			return &radarerror.ExceedAuthority
+		}
+		if len(*setCVs.Roles) == 0 {
+			log.Errorf("roles cannot empty")
+			return &radarerror.InvalidArgs
+		}
+		roleIds := make([]primitive.ObjectID, 0, len(*setCVs.Roles))
+		for _, hex := range *setCVs.Roles {
+			roleIds = append(roleIds, mongodao.Hex2Id(hex))
+		}
+		svcRole := NewRoleService(&s.ME)
+		roleIds, cerr := svcRole.CheckIds(roleIds)
+		if cerr != nil {
+			return cerr
+		}
+		svcGrant := NewGrantService(SystemME(s.ME.Tenant))
+		grants, cerr := svcGrant.GetsUnexpiredByUser(id)
+		if cerr != nil {
+			return cerr
+		}
+		sodRoleIds, grantAuths := mergeGrantHoldings(roleIds, grants)
+		cerr = CheckSodRoles(s.ME.Tenant, sodRoleIds, grantAuths)
+		if cerr != nil {
+			return cerr
+		}
+		// 新加的角色不能超出自己的权限和数据范围，已有的角色可以保留
+		cerr = CheckRolesWithinMe(&s.ME, newRoleIds(user.Roles, roleIds))
+		if cerr != nil {
+			return cerr
+		}
+		update["$set"].(bson.M)[model.ColUserRoles] = roleIds
 	}
 	if setCVs.PoliceNumber != nil {
 		// check police_number
@@ -311,6 +516,72 @@ func (s *User) Update(id primitive.ObjectID, setCVs SetUser) *radarerror.CommonE
 		log.Errorf("fail to update user: %v", err)
 		return &radarerror.InternalServerError
 	}
+
+	// 角色变更后权限随之变化，需要重新登录
+	if setCVs.Roles != nil {
+		RefreshSessionVersion(id)
+	}
+	return nil
+}
+
+/*
+ * 给用户加上角色，用于审批通过的申请，权限来自审批流程，不受审批人自身权限和数据范围的限制
+ */
+func (s *User) AddRoles(id primitive.ObjectID, roleIds []primitive.ObjectID) *radarerror.CommonError {
+	svcRole := NewRoleService(&s.ME)
+	roleIds, cerr := svcRole.CheckIds(roleIds)
+	if cerr != nil {
+		return cerr
+	}
+	user, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+	svcGrant := NewGrantService(SystemME(s.ME.Tenant))
+	grants, cerr := svcGrant.GetsUnexpiredByUser(id)
+	if cerr != nil {
+		return cerr
+	}
+	sodRoleIds, grantAuths := mergeGrantHoldings(append(append([]primitive.ObjectID{}, user.Roles...), roleIds...), grants)
+	cerr = CheckSodRoles(s.ME.Tenant, sodRoleIds, grantAuths)
+	if cerr != nil {
+		return cerr
+	}
+
+	update := bson.M{"$addToSet": bson.M{model.ColUserRoles: bson.M{"$each": roleIds}}}
+	modified, err := s.Dao.UpdateById(s.ME.Id, id, update)
+	if err != nil {
+		log.Errorf("fail to add roles: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if modified > 0 {
+		RefreshSessionVersion(id)
+	}
+	return nil
+}
+
+/*
+ * 撤销用户的某个角色，可以撤销到没有角色（访问审查的结论）
+ */
+func (s *User) RevokeRole(id primitive.ObjectID, roleId primitive.ObjectID) *radarerror.CommonError {
+	user, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+	cerr = CheckUserInScope(&s.ME, user)
+	if cerr != nil {
+		return cerr
+	}
+
+	update := bson.M{"$pull": bson.M{model.ColUserRoles: roleId}}
+	modified, err := s.Dao.UpdateById(s.ME.Id, id, update)
+	if err != nil {
+		log.Errorf("fail to revoke role: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if modified > 0 {
+		RefreshSessionVersion(id)
+	}
 	return nil
 }
 
@@ -318,6 +589,15 @@ func (s *User) Update(id primitive.ObjectID, setCVs SetUser) *radarerror.CommonE
  * 删除
  */
 func (s *User) Delete(id primitive.ObjectID) *radarerror.CommonError {
+	user, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+	cerr = CheckUserInScope(&s.ME, user)
+	if cerr != nil {
+		return cerr
+	}
+
 	_, err := s.Dao.DelById(s.ME.Id, id)
 	if err != nil {
 		log.Debugf("fail to delete user: %v", err)
@@ -330,6 +610,15 @@ func (s *User) Delete(id primitive.ObjectID) *radarerror.CommonError {
  * UpdatePassword 修改密码
  */
 func (s *User) UpdatePassword(id primitive.ObjectID, password string, needReset bool) *radarerror.CommonError {
+	user, cerr := s.GetById(id)
+	if cerr != nil {
+		return cerr
+	}
+	cerr = CheckUserInScope(&s.ME, user)
+	if cerr != nil {
+		return cerr
+	}
+
 	// 加密密码
 	if password == "" {
 		password = crypt.CalMd5(userCfg.UserDefaultPassword) // 默认密码
@@ -372,10 +661,79 @@ func (s *User) RefreshSessionVersionByRole(roleId primitive.ObjectID) *radarerro
 	for _, user := range users {
 		RefreshSessionVersion(user.Id)
 	}
+
+	// 通过临时授权获得该角色的用户
+	svcGrant := NewGrantService(&s.ME)
+	grants, cerr := svcGrant.GetsActiveByRole(roleId)
+	if cerr != nil {
+		return cerr
+	}
+	for _, grant := range grants {
+		RefreshSessionVersion(grant.User)
+	}
+	return nil
+}
+
+/*
+ * 把旧版本的单个角色迁移为角色列表，可重复执行
+ */
+func (s *User) MigrateRoles() *radarerror.CommonError {
+	filter := bson.M{
+		model.ColUserRole:     bson.M{"$exists": true},
+		modelbase.ColIsDelete: bson.M{"$in": []bool{true, false}},
+	}
+	var users []struct {
+		Id   primitive.ObjectID `bson:"_id"`
+		Role primitive.ObjectID `bson:"role"`
+	}
+	err := s.Dao.Gets(&users, filter)
+	if err != nil {
+		log.Errorf("fail to get users: %v", err)
+		return &radarerror.InternalServerError
+	}
+	if len(users) > 0 {
+		log.Infof("migrate user roles: %v", len(users))
+	}
+
+	for _, user := range users {
+		roles := []primitive.ObjectID{}
+		if user.Role != primitive.NilObjectID {
+			roles = append(roles, user.Role)
+		}
+		update := bson.M{
+			"$set":   bson.M{model.ColUserRoles: roles},
+			"$unset": bson.M{model.ColUserRole: ""},
+		}
+		filter := bson.M{
+			modelbase.ColId:       user.Id,
+			modelbase.ColIsDelete: bson.M{"$in": []bool{true, false}},
+		}
+		_, err = s.Dao.Update(primitive.NilObjectID, filter, update)
+		if err != nil {
+			log.Errorf("fail to migrate user roles: %v", err)
+			return &radarerror.InternalServerError
+		}
+	}
 	return nil
 }
 
 /***** 辅助函数 *****/
+
+// roleIds中不在old里的角色
+func newRoleIds(old, roleIds []primitive.ObjectID) []primitive.ObjectID {
+	existed := make(map[primitive.ObjectID]bool, len(old))
+	for _, id := range old {
+		existed[id] = true
+	}
+	var added []primitive.ObjectID
+	for _, id := range roleIds {
+		if !existed[id] {
+			added = append(added, id)
+		}
+	}
+	return added
+}
+
 func CheckPassword(user model.User, password string) bool {
 	err := bcrypt.CompareHashAndPassword(
 		[]byte(user.Password),
@@ -399,6 +757,66 @@ func IsSessionVersionValid(id primitive.ObjectID, version int64) bool {
 	return true
 }
 
+/*
+ * 重新验证身份时的输错密码计数，达到上限后须带验证码
+ */
+func NeedPasswordCaptcha(id primitive.ObjectID) bool {
+	if userCfg.MaxPasswordFailure <= 0 {
+		return false
+	}
+	n, _ := redisdao.GetInt64(fmt.Sprintf(pwdFailure, id.Hex()))
+	return n >= userCfg.MaxPasswordFailure
+}
+
+func AddPasswordFailure(id primitive.ObjectID) {
+	incrFailure(fmt.Sprintf(pwdFailure, id.Hex()))
+}
+
+func ClearPasswordFailure(id primitive.ObjectID) {
+	err := redisdao.Del(fmt.Sprintf(pwdFailure, id.Hex()))
+	if err != nil {
+		log.Errorf("fail to clear password failure: %v", err)
+	}
+}
+
+/*
+ * 登录时的输错密码计数，按账号和来源ip分别统计，任一达到上限后须带验证码
+ * 应急账号和不存在的账号同样计数
+ */
+func NeedLoginCaptcha(account, ip string) bool {
+	if userCfg.MaxPasswordFailure <= 0 {
+		return false
+	}
+	n, _ := redisdao.GetInt64(fmt.Sprintf(loginFailureAccount, account))
+	if n >= userCfg.MaxPasswordFailure {
+		return true
+	}
+	n, _ = redisdao.GetInt64(fmt.Sprintf(loginFailureIp, ip))
+	return n >= userCfg.MaxPasswordFailure
+}
+
+func AddLoginFailure(account, ip string) {
+	incrFailure(fmt.Sprintf(loginFailureAccount, account))
+	incrFailure(fmt.Sprintf(loginFailureIp, ip))
+}
+
+// 登录成功只清除账号的计数，ip的计数到期自然清除，避免用一个可登录的账号重置
+func ClearLoginFailure(account string) {
+	err := redisdao.Del(fmt.Sprintf(loginFailureAccount, account))
+	if err != nil {
+		log.Errorf("fail to clear login failure: %v", err)
+	}
+}
+
+func incrFailure(key string) {
+	if redisdao.IncrBy(key, 1) == 1 {
+		err := redisdao.Expire(key, time.Duration(userCfg.PasswordFailureWindow)*time.Second)
+		if err != nil {
+			log.Errorf("fail to expire password failure: %v", err)
+		}
+	}
+}
+
 func (s *User) GetCreateAccount(name string) (string, *radarerror.CommonError) {
 	var nameStr string
 	//检查姓名长度
@@ -0,0 +1,13 @@
+package crypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+func CalHmacSha256(key, str string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(str))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -1,7 +1,10 @@
 package jwt
 
 import (
+	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
@@ -32,6 +35,10 @@ func SetConfig(c Config) {
 	}
 }
 
+func GetKeyFactory() string {
+	return cfg.KeyFactory
+}
+
 func load() error {
 	data, err := ioutil.ReadFile(cfg.PrivateKeyPath)
 	if err != nil {
@@ -121,3 +128,28 @@ func DecodeB64Token(b64Token string) (*Claims, error) {
 	}
 	return &claims, nil
 }
+
+/*
+ * 用会话私钥对数据签名（RSA PKCS1v15 SHA256），返回base64
+ */
+func Sign(data []byte) (string, error) {
+	digest := sha256.Sum256(data)
+	sign, err := rsa.SignPKCS1v15(rand.Reader, cfg.PrivateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		log.Errorf("fail to sign data: %v", err)
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sign), nil
+}
+
+/*
+ * 用会话公钥校验Sign生成的签名
+ */
+func VerifySign(data []byte, b64Sign string) error {
+	sign, err := base64.StdEncoding.DecodeString(b64Sign)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(cfg.PublicKey, crypto.SHA256, digest[:], sign)
+}
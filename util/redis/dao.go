@@ -53,6 +53,26 @@ func IncrBy(key string, num int64) int64 {
 	return newNum
 }
 
+func Expire(key string, expiration time.Duration) error {
+	return GetClient().Expire(key, expiration).Err()
+}
+
 func GetInt64(key string) (int64, error) {
 	return GetClient().Get(key).Int64()
 }
+
+func Set(key string, value interface{}, expiration time.Duration) error {
+	return GetClient().Set(key, value, expiration).Err()
+}
+
+func Get(key string) (string, error) {
+	return GetClient().Get(key).Result()
+}
+
+func Del(keys ...string) error {
+	return GetClient().Del(keys...).Err()
+}
+
+func Publish(channel string, message interface{}) error {
+	return GetClient().Publish(channel, message).Err()
+}
@@ -1,6 +1,9 @@
 package mstring
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -8,3 +11,12 @@ import (
 func GetUUID() string {
 	return uuid.NewV4().String()
 }
+
+// GetRandomHex 生成n字节的安全随机数，以16进制字符串返回
+func GetRandomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}